@@ -0,0 +1,158 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"semay.com/i18n"
+)
+
+// Fieldset is the set of response fields asked for with ?fields=, by json name in the asked order.
+// A nil Fieldset stands for every field.
+type Fieldset struct {
+	Names []string
+}
+
+// ParseFields reads ?fields=a,b against the json names of the Get DTO dto, an empty value selects every field
+func ParseFields(raw string, dto interface{}) (*Fieldset, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+
+	allowed := make(map[string]bool)
+	for _, name := range jsonNames(reflect.TypeOf(dto)) {
+		allowed[name] = true
+	}
+
+	fieldset := &Fieldset{}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(raw, ",") {
+		name = strings.TrimSpace(name)
+		if !allowed[name] {
+			return nil, InvalidQuery(ErrInvalidQuery, "query.not_selectable", i18n.Params{"field": name})
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		fieldset.Names = append(fieldset.Names, name)
+	}
+	return fieldset, nil
+}
+
+// jsonNames lists the json names of a struct type, the fields of embedded structs count as its own
+func jsonNames(kind reflect.Type) []string {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+	names := make([]string, 0, kind.NumField())
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		tag := field.Tag.Get("json")
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			names = append(names, jsonNames(field.Type)...)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+// Select narrows the columns the query reads to the fieldset plus the needed ones, such as the
+// sort columns cursors are made of. The id is always read, associations are preloaded by it.
+// Selected names that are no column of the model, like associations, leave the query alone.
+func (f *Fieldset) Select(query *gorm.DB, needed ...string) (*gorm.DB, error) {
+	if f == nil {
+		return query, nil
+	}
+	if query.Statement.Model == nil {
+		return nil, fmt.Errorf("fieldsets need a query with a model")
+	}
+	model_schema, err := schema.Parse(query.Statement.Model, schemaCache, query.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make(map[string]string)
+	for _, field := range model_schema.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			continue
+		}
+		columns[name] = field.DBName
+	}
+
+	selected := []string{tiebreakColumn}
+	seen := map[string]bool{tiebreakColumn: true}
+	add := func(column string) {
+		if column != "" && !seen[column] {
+			seen[column] = true
+			selected = append(selected, column)
+		}
+	}
+	for _, name := range f.Names {
+		add(columns[name])
+	}
+	for _, column := range needed {
+		add(column)
+	}
+
+	// qualified so joined tables do not make the columns ambiguous
+	for i, column := range selected {
+		selected[i] = model_schema.Table + "." + column
+	}
+	return query.Select(selected), nil
+}
+
+// Shape keeps only the fieldset members of value, or of every element when value is a slice
+func (f *Fieldset) Shape(value interface{}) (interface{}, error) {
+	if f == nil {
+		return value, nil
+	}
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if kind := reflect.TypeOf(value); kind != nil && (kind.Kind() == reflect.Slice || kind.Kind() == reflect.Array) {
+		var rows []map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &rows); err != nil {
+			return nil, err
+		}
+		shaped := make([]map[string]json.RawMessage, 0, len(rows))
+		for _, row := range rows {
+			shaped = append(shaped, f.keep(row))
+		}
+		return shaped, nil
+	}
+
+	var row map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &row); err != nil {
+		return nil, err
+	}
+	return f.keep(row), nil
+}
+
+func (f *Fieldset) keep(row map[string]json.RawMessage) map[string]json.RawMessage {
+	kept := make(map[string]json.RawMessage, len(f.Names))
+	for _, name := range f.Names {
+		if value, ok := row[name]; ok {
+			kept[name] = value
+		}
+	}
+	return kept
+}
@@ -0,0 +1,286 @@
+package common
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"semay.com/i18n"
+)
+
+// FilterTag lists on a model field the operators it can be filtered with, e.g. `filter:"eq,in,ilike"`
+const FilterTag = "filter"
+
+// most values an in or nin filter may list
+const maxFilterValues = 100
+
+// filter[field][op]=value, the operator part may be left out for eq
+var filterKey = regexp.MustCompile(`^filter\[([^\[\]]+)\](?:\[([^\[\]]+)\])?$`)
+
+var filterOperators = map[string]bool{
+	"eq": true, "ne": true, "gt": true, "gte": true, "lt": true, "lte": true,
+	"in": true, "nin": true, "like": true, "ilike": true, "null": true,
+}
+
+// FilterError lists every malformed filter of a request
+type FilterError struct {
+	Problems []*QueryError
+}
+
+func (e *FilterError) Error() string {
+	problems := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		problems = append(problems, problem.Error())
+	}
+	return "invalid filter: " + strings.Join(problems, "; ")
+}
+
+// Is makes filter errors match ErrInvalidQuery like the other bad list parameters
+func (e *FilterError) Is(target error) bool {
+	return target == ErrInvalidQuery
+}
+
+// Filter is one parsed condition
+type Filter struct {
+	Field  string
+	Column string
+	Op     string
+	Value  interface{}
+}
+
+// filterField is a filterable field of a model
+type filterField struct {
+	column    string
+	kind      reflect.Type
+	operators map[string]bool
+}
+
+// filterFields reads the filter tags of the model of query, keyed by json name
+func filterFields(query *gorm.DB) (map[string]filterField, error) {
+	if query.Statement.Model == nil {
+		return nil, fmt.Errorf("filters need a query with a model")
+	}
+	model_schema, err := schema.Parse(query.Statement.Model, schemaCache, query.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]filterField)
+	for _, field := range model_schema.Fields {
+		tag := field.Tag.Get(FilterTag)
+		if tag == "" || field.DBName == "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" {
+			name = field.DBName
+		}
+
+		kind := field.FieldType
+		if kind.Kind() == reflect.Ptr {
+			kind = kind.Elem()
+		}
+		operators := make(map[string]bool)
+		for _, op := range strings.Split(tag, ",") {
+			operators[strings.TrimSpace(op)] = true
+		}
+		fields[name] = filterField{column: field.DBName, kind: kind, operators: operators}
+	}
+	return fields, nil
+}
+
+// ParseFilters reads the filter[field][op]=value parameters against the filter tags of the model of query
+func ParseFilters(query *gorm.DB, params url.Values) ([]Filter, error) {
+	fields, err := filterFields(query)
+	if err != nil {
+		return nil, err
+	}
+
+	filters := make([]Filter, 0)
+	problems := make([]*QueryError, 0)
+	// sorted so problems and conditions come in a stable order
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if strings.HasPrefix(key, "filter") {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		values := params[key]
+		match := filterKey.FindStringSubmatch(key)
+		if match == nil {
+			problems = append(problems, InvalidQuery(ErrInvalidQuery, "query.filter_malformed", i18n.Params{"key": key}))
+			continue
+		}
+
+		name, op := match[1], match[2]
+		if op == "" {
+			op = "eq"
+		}
+		field, ok := fields[name]
+		if !ok {
+			problems = append(problems, InvalidQuery(ErrInvalidQuery, "query.not_filterable", i18n.Params{"field": name}))
+			continue
+		}
+		if !filterOperators[op] {
+			problems = append(problems, InvalidQuery(ErrInvalidQuery, "query.unknown_operator", i18n.Params{"op": op}))
+			continue
+		}
+		if !field.operators[op] {
+			problems = append(problems, InvalidQuery(ErrInvalidQuery, "query.operator_not_allowed", i18n.Params{"field": name, "op": op}))
+			continue
+		}
+
+		for _, raw := range values {
+			value, err := filterValue(field, op, raw)
+			if err != nil {
+				// the value problems name the filter they come from
+				err.Params["field"], err.Params["op"] = name, op
+				problems = append(problems, err)
+				continue
+			}
+			filters = append(filters, Filter{Field: name, Column: field.column, Op: op, Value: value})
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &FilterError{Problems: problems}
+	}
+	return filters, nil
+}
+
+// filterValue converts the raw parameter to the type of the field
+func filterValue(field filterField, op string, raw string) (interface{}, *QueryError) {
+	switch op {
+	case "null":
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, valueProblem("query.value_not_boolean", raw)
+		}
+		return value, nil
+	case "like", "ilike":
+		if field.kind.Kind() != reflect.String {
+			return nil, valueProblem("query.value_not_text", raw)
+		}
+		return raw, nil
+	case "in", "nin":
+		parts := strings.Split(raw, ",")
+		if len(parts) > maxFilterValues {
+			problem := valueProblem("query.too_many_values", raw)
+			problem.Params["max"] = maxFilterValues
+			return nil, problem
+		}
+		values := make([]interface{}, 0, len(parts))
+		for _, part := range parts {
+			value, err := convertFilterValue(field.kind, strings.TrimSpace(part))
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		return values, nil
+	}
+	return convertFilterValue(field.kind, raw)
+}
+
+// valueProblem is a filter value that can not be used, the caller adds the field and operator
+func valueProblem(detail string, raw string) *QueryError {
+	return InvalidQuery(ErrInvalidQuery, detail, i18n.Params{"value": raw})
+}
+
+func convertFilterValue(kind reflect.Type, raw string) (interface{}, *QueryError) {
+	if kind == reflect.TypeOf(time.Time{}) {
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02"} {
+			if parsed, err := time.Parse(layout, raw); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, valueProblem("query.value_not_time", raw)
+	}
+
+	switch kind.Kind() {
+	case reflect.String:
+		return raw, nil
+	case reflect.Bool:
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, valueProblem("query.value_not_boolean", raw)
+		}
+		return value, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, valueProblem("query.value_not_number", raw)
+		}
+		return value, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return nil, valueProblem("query.value_not_positive_number", raw)
+		}
+		return value, nil
+	case reflect.Float32, reflect.Float64:
+		value, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return nil, valueProblem("query.value_not_number", raw)
+		}
+		return value, nil
+	}
+	return nil, valueProblem("query.value_not_filterable", raw)
+}
+
+// likePattern matches value anywhere, with the wildcards it contains taken literally
+func likePattern(value string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+	return "%" + escaper.Replace(value) + "%"
+}
+
+// ApplyFilters adds the filters to query as parameterized conditions
+func ApplyFilters(query *gorm.DB, filters []Filter) *gorm.DB {
+	for _, filter := range filters {
+		column := clause.Column{Name: filter.Column}
+		var condition clause.Expression
+		switch filter.Op {
+		case "eq":
+			condition = clause.Eq{Column: column, Value: filter.Value}
+		case "ne":
+			condition = clause.Neq{Column: column, Value: filter.Value}
+		case "gt":
+			condition = clause.Gt{Column: column, Value: filter.Value}
+		case "gte":
+			condition = clause.Gte{Column: column, Value: filter.Value}
+		case "lt":
+			condition = clause.Lt{Column: column, Value: filter.Value}
+		case "lte":
+			condition = clause.Lte{Column: column, Value: filter.Value}
+		case "in":
+			condition = clause.IN{Column: column, Values: filter.Value.([]interface{})}
+		case "nin":
+			condition = clause.Not(clause.IN{Column: column, Values: filter.Value.([]interface{})})
+		case "like":
+			condition = clause.Expr{SQL: `? LIKE ? ESCAPE '\'`, Vars: []interface{}{column, likePattern(filter.Value.(string))}}
+		case "ilike":
+			// lower on both sides works on every database, unlike ILIKE
+			condition = clause.Expr{SQL: `LOWER(?) LIKE LOWER(?) ESCAPE '\'`, Vars: []interface{}{column, likePattern(filter.Value.(string))}}
+		case "null":
+			if filter.Value.(bool) {
+				condition = clause.Eq{Column: column, Value: nil}
+			} else {
+				condition = clause.Neq{Column: column, Value: nil}
+			}
+		}
+		query = query.Where(condition)
+	}
+	return query
+}
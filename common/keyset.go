@@ -0,0 +1,307 @@
+package common
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+	"semay.com/configs"
+	"semay.com/i18n"
+)
+
+// ResponseCursorPagination is the list response of the keyset mode
+type ResponseCursorPagination struct {
+	Success bool        `json:"success"`
+	Items   interface{} `json:"data"`
+	Message string      `json:"details"`
+	Size    uint        `json:"size"`
+	Sort    string      `json:"sort"`
+	Next    string      `json:"next,omitempty"`
+	Prev    string      `json:"prev,omitempty"`
+}
+
+// KeysetParams reads ?cursor= and ?limit=, a missing limit takes the default page size
+func KeysetParams(contx echo.Context) (string, int, error) {
+	limit := 0
+	if raw := contx.QueryParam("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return "", 0, InvalidQuery(ErrInvalidQuery, "query.invalid_limit", nil)
+		}
+		limit = parsed
+	}
+	return contx.QueryParam("cursor"), limit, nil
+}
+
+// IsKeysetRequest tells whether a list request asked for the cursor mode
+func IsKeysetRequest(contx echo.Context) bool {
+	return contx.QueryParams().Has("cursor") || contx.QueryParams().Has("limit")
+}
+
+// cursorPayload is what a cursor carries, values are the sort keys of the boundary row
+type cursorPayload struct {
+	Sort     string            `json:"s"`
+	Values   []json.RawMessage `json:"v"`
+	Backward bool              `json:"b,omitempty"`
+}
+
+// cursorKey derives the key signing cursors from the app salt
+func cursorKey() []byte {
+	sum := sha256.Sum256([]byte("cursor:" + configs.AppConfig.Get("SECRETE_SALT")))
+	return sum[:]
+}
+
+func encodeCursor(payload cursorPayload) (string, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+	mac := hmac.New(sha256.New, cursorKey())
+	mac.Write(raw)
+	return base64.RawURLEncoding.EncodeToString(raw) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeCursor(cursor string) (cursorPayload, error) {
+	var payload cursorPayload
+
+	encoded, signature, found := strings.Cut(cursor, ".")
+	if !found {
+		return payload, ErrInvalidCursor
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return payload, ErrInvalidCursor
+	}
+	sum, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		return payload, ErrInvalidCursor
+	}
+
+	mac := hmac.New(sha256.New, cursorKey())
+	mac.Write(raw)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return payload, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(raw, &payload); err != nil {
+		return payload, ErrInvalidCursor
+	}
+	return payload, nil
+}
+
+var schemaCache = &sync.Map{}
+
+// sortSchemaFields finds the struct fields of T holding the sort columns
+func sortSchemaFields[T any](query *gorm.DB, sort []SortField) ([]*schema.Field, error) {
+	item_schema, err := schema.Parse(new(T), schemaCache, query.NamingStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]*schema.Field, 0, len(sort))
+	for _, sort_field := range sort {
+		field := item_schema.LookUpField(sort_field.Column)
+		if field == nil {
+			return nil, InvalidQuery(ErrInvalidSort, "query.not_sortable", i18n.Params{"field": sort_field.Name})
+		}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// isNullable tells whether a column can hold NULL, pointers and sql.Null* fields can
+func isNullable(field *schema.Field) bool {
+	if field.FieldType.Kind() == reflect.Pointer {
+		return true
+	}
+	_, valuer := reflect.New(field.FieldType).Interface().(driver.Valuer)
+	return valuer && strings.HasPrefix(field.FieldType.Name(), "Null")
+}
+
+// keysetCondition selects the rows after values in the ordering, as
+// (a > va) OR (a = va AND b > vb) ... which works for mixed directions
+func keysetCondition(sort []SortField, values []interface{}) clause.Expression {
+	ors := make([]clause.Expression, 0, len(sort))
+	for i, field := range sort {
+		ands := make([]clause.Expression, 0, i+1)
+		for j := 0; j < i; j++ {
+			ands = append(ands, keysetEqual(sort[j], values[j]))
+		}
+		ors = append(ors, clause.And(append(ands, keysetAfter(field, values[i]))...))
+	}
+	return clause.Or(ors...)
+}
+
+// keysetEqual matches the rows holding value, NULL included
+func keysetEqual(field SortField, value interface{}) clause.Expression {
+	column := clause.Column{Name: field.Column}
+	if isNull(value) {
+		return clause.Eq{Column: column, Value: nil}
+	}
+	return clause.Eq{Column: column, Value: value}
+}
+
+// keysetAfter matches the rows coming after value in the ordering of field,
+// NULL sorts after every value as orderBy places it
+func keysetAfter(field SortField, value interface{}) clause.Expression {
+	column := clause.Column{Name: field.Column}
+	null := isNull(value)
+	switch {
+	case field.Desc && null:
+		return clause.Neq{Column: column, Value: nil}
+	case field.Desc:
+		return clause.Lt{Column: column, Value: value}
+	case null:
+		// nothing comes after NULL going up
+		return clause.Expr{SQL: "1 = 0"}
+	case field.Nullable:
+		return clause.Or(clause.Gt{Column: column, Value: value}, clause.Eq{Column: column, Value: nil})
+	default:
+		return clause.Gt{Column: column, Value: value}
+	}
+}
+
+func isNull(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	reflected := reflect.ValueOf(value)
+	return reflected.Kind() == reflect.Pointer && reflected.IsNil()
+}
+
+// PaginateKeyset fetches the limit rows of query following (or with a backward cursor preceding)
+// the cursor in the given ordering, an empty cursor starts at the beginning.
+// The returned next and prev cursors are signed so clients can not forge sort keys.
+func PaginateKeyset[T any](ctx context.Context, query *gorm.DB, sort []SortField, cursor string, limit int) (ResponseCursorPagination, error) {
+	default_size, max_size := PageSizes()
+	if limit <= 0 {
+		limit = default_size
+	}
+	if limit > max_size {
+		limit = max_size
+	}
+
+	sort = slices.Clone(withTiebreak(sort))
+	sort_string := sortString(sort)
+	fields, err := sortSchemaFields[T](query, sort)
+	if err != nil {
+		return ResponseCursorPagination{}, err
+	}
+	for i, field := range fields {
+		sort[i].Nullable = isNullable(field)
+	}
+
+	base := query.Session(&gorm.Session{Context: ctx})
+
+	backward := false
+	if cursor != "" {
+		payload, err := decodeCursor(cursor)
+		if err != nil {
+			return ResponseCursorPagination{}, err
+		}
+		if payload.Sort != sort_string || len(payload.Values) != len(sort) {
+			return ResponseCursorPagination{}, ErrInvalidCursor
+		}
+
+		// the values are read back into the types of the fields they came from
+		values := make([]interface{}, len(fields))
+		for i, field := range fields {
+			value := reflect.New(field.FieldType)
+			if err := json.Unmarshal(payload.Values[i], value.Interface()); err != nil {
+				return ResponseCursorPagination{}, ErrInvalidCursor
+			}
+			values[i] = value.Elem().Interface()
+		}
+
+		backward = payload.Backward
+		walk := sort
+		if backward {
+			walk = reversed(sort)
+		}
+		base = base.Where(keysetCondition(walk, values))
+	}
+
+	// going backward reads the reversed ordering and flips the rows back afterwards
+	order := sort
+	if backward {
+		order = reversed(sort)
+	}
+	base = orderBy(base, order)
+
+	// one row more than asked tells whether there is a further page
+	items := make([]T, 0, limit+1)
+	if err := base.Limit(limit + 1).Find(&items).Error; err != nil {
+		return ResponseCursorPagination{}, err
+	}
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if backward {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	result := ResponseCursorPagination{
+		Success: true,
+		Items:   items,
+		Size:    uint(limit),
+		Sort:    sort_string,
+	}
+	if len(items) == 0 {
+		return result, nil
+	}
+
+	// forward there is a next page when more rows came, and a previous one when we started from a cursor
+	has_next, has_prev := more, cursor != ""
+	if backward {
+		has_next, has_prev = true, more
+	}
+	if has_next {
+		if result.Next, err = rowCursor(ctx, fields, sort_string, items[len(items)-1], false); err != nil {
+			return ResponseCursorPagination{}, err
+		}
+	}
+	if has_prev {
+		if result.Prev, err = rowCursor(ctx, fields, sort_string, items[0], true); err != nil {
+			return ResponseCursorPagination{}, err
+		}
+	}
+	return result, nil
+}
+
+// rowCursor signs the sort keys of a row
+func rowCursor[T any](ctx context.Context, fields []*schema.Field, sort_string string, item T, backward bool) (string, error) {
+	payload := cursorPayload{Sort: sort_string, Backward: backward}
+	row := reflect.ValueOf(&item).Elem()
+	for _, field := range fields {
+		value, _ := field.ValueOf(ctx, row)
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return "", err
+		}
+		payload.Values = append(payload.Values, raw)
+	}
+	return encodeCursor(payload)
+}
+
+func reversed(sort []SortField) []SortField {
+	flipped := make([]SortField, len(sort))
+	for i, field := range sort {
+		field.Desc = !field.Desc
+		flipped[i] = field
+	}
+	return flipped
+}
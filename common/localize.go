@@ -0,0 +1,63 @@
+package common
+
+import (
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"semay.com/i18n"
+)
+
+// LocaleKey is the context key of the caller's preferred locale, set when authenticating
+const LocaleKey = "locale"
+
+// Translate writes a message id with its parameters in the language of a request
+type Translate func(id string, params i18n.Params) string
+
+// Localizer is a response holding message ids, Respond has it write them in the language of the request
+type Localizer interface {
+	Localize(translate Translate) interface{}
+}
+
+// Languages are the languages a request is answered in, most preferred first:
+// the caller's own preference, then those of the Accept-Language header
+func Languages(contx echo.Context) []string {
+	languages := i18n.Languages(contx.Request().Header.Get("Accept-Language"))
+	if locale, ok := contx.Get(LocaleKey).(string); ok && locale != "" {
+		languages = append(i18n.Languages(locale), languages...)
+	}
+	return languages
+}
+
+// T writes the message id in the language of the request
+func T(contx echo.Context, id string, params i18n.Params) string {
+	return i18n.Messages().Translate(Languages(contx), id, params)
+}
+
+// translator binds T to a request and tells the response which language it is in
+func translator(contx echo.Context) Translate {
+	languages := Languages(contx)
+	header := contx.Response().Header()
+	header.Set("Content-Language", strings.ReplaceAll(i18n.Messages().Match(languages), "_", "-"))
+	header.Add(echo.HeaderVary, "Accept-Language")
+	return func(id string, params i18n.Params) string {
+		return i18n.Messages().Translate(languages, id, params)
+	}
+}
+
+func (r ResponseHTTP) Localize(translate Translate) interface{} {
+	r.Message = translate(r.Message, r.Params)
+	if data, ok := r.Data.(Localizer); ok {
+		r.Data = data.Localize(translate)
+	}
+	return r
+}
+
+func (r ResponsePagination) Localize(translate Translate) interface{} {
+	r.Message = translate(r.Message, nil)
+	return r
+}
+
+func (r ResponseCursorPagination) Localize(translate Translate) interface{} {
+	r.Message = translate(r.Message, nil)
+	return r
+}
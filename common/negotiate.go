@@ -0,0 +1,372 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/labstack/echo/v4"
+	"github.com/mitchellh/mapstructure"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec writes and reads one body format. Every format carries the JSON form of a value,
+// so field names, omitted fields and fieldsets are the same whatever the client asks for.
+type Codec struct {
+	// MediaType is sent as the content type, Aliases are accepted as well
+	MediaType string
+	Aliases   []string
+	Marshal   func(value interface{}) ([]byte, error)
+	Unmarshal func(data []byte, value interface{}) error
+}
+
+var cborDecoding, _ = cbor.DecOptions{DefaultMapType: reflect.TypeOf(map[string]interface{}{})}.DecMode()
+
+// Codecs are the supported body formats, the first is the default
+var Codecs = []Codec{
+	{
+		MediaType: echo.MIMEApplicationJSON,
+		Marshal:   json.Marshal,
+		Unmarshal: json.Unmarshal,
+	},
+	{
+		MediaType: echo.MIMEApplicationXML,
+		Aliases:   []string{echo.MIMETextXML},
+		Marshal:   marshalXML,
+		Unmarshal: unmarshalXML,
+	},
+	{
+		MediaType: "application/msgpack",
+		Aliases:   []string{"application/x-msgpack", "application/vnd.msgpack"},
+		Marshal:   viaTree(msgpack.Marshal),
+		Unmarshal: fromTree(msgpack.Unmarshal),
+	},
+	{
+		MediaType: "application/cbor",
+		Marshal:   viaTree(cbor.Marshal),
+		Unmarshal: fromTree(cborDecoding.Unmarshal),
+	},
+}
+
+func (c Codec) matches(media_type string) bool {
+	if media_type == c.MediaType {
+		return true
+	}
+	for _, alias := range c.Aliases {
+		if media_type == alias {
+			return true
+		}
+	}
+	return false
+}
+
+// CodecFor finds the codec of a Content-Type header
+func CodecFor(content_type string) (Codec, bool) {
+	media_type, _, err := mime.ParseMediaType(content_type)
+	if err != nil {
+		return Codec{}, false
+	}
+	for _, codec := range Codecs {
+		if codec.matches(media_type) {
+			return codec, true
+		}
+	}
+	return Codec{}, false
+}
+
+// Negotiate picks the codec an Accept header prefers, the default one when the header is empty.
+// It is false when the client accepts none of them.
+func Negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return Codecs[0], true
+	}
+
+	best, best_quality := -1, 0.0
+	for _, part := range strings.Split(accept, ",") {
+		media_type, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if raw, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(raw, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= best_quality {
+			continue
+		}
+
+		for i, codec := range Codecs {
+			prefix, _, _ := strings.Cut(codec.MediaType, "/")
+			if media_type == "*/*" || media_type == prefix+"/*" || codec.matches(media_type) {
+				best, best_quality = i, quality
+				break
+			}
+		}
+	}
+	if best < 0 {
+		return Codec{}, false
+	}
+	return Codecs[best], true
+}
+
+// Respond writes value with status in the format the request accepts, JSON when it accepts none.
+// The messages of Localizer values are written in the language of the request.
+func Respond(contx echo.Context, status int, value interface{}) error {
+	if localizer, ok := value.(Localizer); ok {
+		value = localizer.Localize(translator(contx))
+	}
+
+	codec, ok := Negotiate(contx.Request().Header.Get(echo.HeaderAccept))
+	if !ok || codec.MediaType == echo.MIMEApplicationJSON {
+		return contx.JSON(status, value)
+	}
+
+	body, err := codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	content_type := codec.MediaType
+	if codec.MediaType == echo.MIMEApplicationXML {
+		content_type = echo.MIMEApplicationXMLCharsetUTF8
+	}
+	contx.Response().Header().Add(echo.HeaderVary, echo.HeaderAccept)
+	return contx.Blob(status, content_type, body)
+}
+
+// Binder reads request bodies of every codec, other bodies are left to echo.DefaultBinder
+type Binder struct {
+	echo.DefaultBinder
+}
+
+// Bind binds the path parameters, the query parameters of GET and DELETE requests, then the body
+func (b *Binder) Bind(value interface{}, contx echo.Context) error {
+	codec, ok := CodecFor(contx.Request().Header.Get(echo.HeaderContentType))
+	if !ok || codec.MediaType == echo.MIMEApplicationJSON {
+		return b.DefaultBinder.Bind(value, contx)
+	}
+
+	if err := b.BindPathParams(contx, value); err != nil {
+		return err
+	}
+	method := contx.Request().Method
+	if method == http.MethodGet || method == http.MethodDelete || method == http.MethodHead {
+		if err := b.BindQueryParams(contx, value); err != nil {
+			return err
+		}
+	}
+	if contx.Request().ContentLength == 0 {
+		return nil
+	}
+
+	body, err := io.ReadAll(contx.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	if err := codec.Unmarshal(body, value); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err)
+	}
+	return nil
+}
+
+// tree is the JSON form of value as maps, slices and plain values
+func tree(value interface{}) (interface{}, error) {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.UseNumber()
+	var generic interface{}
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return numbers(generic), nil
+}
+
+// numbers turns json numbers into integers when they are whole and floats otherwise
+func numbers(value interface{}) interface{} {
+	switch value := value.(type) {
+	case json.Number:
+		if integer, err := value.Int64(); err == nil {
+			return integer
+		}
+		float, _ := value.Float64()
+		return float
+	case map[string]interface{}:
+		for key, item := range value {
+			value[key] = numbers(item)
+		}
+	case []interface{}:
+		for i, item := range value {
+			value[i] = numbers(item)
+		}
+	}
+	return value
+}
+
+func viaTree(marshal func(interface{}) ([]byte, error)) func(interface{}) ([]byte, error) {
+	return func(value interface{}) ([]byte, error) {
+		generic, err := tree(value)
+		if err != nil {
+			return nil, err
+		}
+		return marshal(generic)
+	}
+}
+
+// fromTree decodes a body to maps and plain values, then into value by its json names
+func fromTree(unmarshal func([]byte, interface{}) error) func([]byte, interface{}) error {
+	return func(data []byte, value interface{}) error {
+		var generic interface{}
+		if err := unmarshal(data, &generic); err != nil {
+			return err
+		}
+		raw, err := json.Marshal(generic)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(raw, value)
+	}
+}
+
+// xmlItem names the elements of lists
+const xmlItem = "item"
+
+// marshalXML writes the JSON form of value under a response element,
+// objects become child elements and lists repeat an item element
+func marshalXML(value interface{}) ([]byte, error) {
+	generic, err := tree(value)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	out.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&out)
+	if err := writeXML(encoder, "response", generic); err != nil {
+		return nil, err
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func writeXML(encoder *xml.Encoder, name string, value interface{}) error {
+	start := xml.StartElement{Name: xml.Name{Local: xmlName(name)}}
+	if err := encoder.EncodeToken(start); err != nil {
+		return err
+	}
+	switch value := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if err := writeXML(encoder, key, value[key]); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for _, item := range value {
+			if err := writeXML(encoder, xmlItem, item); err != nil {
+				return err
+			}
+		}
+	case nil:
+	default:
+		if err := encoder.EncodeToken(xml.CharData(fmt.Sprint(value))); err != nil {
+			return err
+		}
+	}
+	return encoder.EncodeToken(start.End())
+}
+
+// xmlName makes a json name a valid element name
+func xmlName(name string) string {
+	valid := []rune(name)
+	for i, r := range valid {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' && r != '-' && r != '.' {
+			valid[i] = '_'
+		}
+	}
+	if len(valid) == 0 || !unicode.IsLetter(valid[0]) && valid[0] != '_' {
+		return "_" + string(valid)
+	}
+	return string(valid)
+}
+
+// xmlNode is an element read back, with either text or children
+type xmlNode struct {
+	XMLName  xml.Name
+	Text     string    `xml:",chardata"`
+	Children []xmlNode `xml:",any"`
+}
+
+// generic turns an element into what its JSON form would be, elements with only
+// item children are lists. The text of leaves is converted to the target types when decoding.
+func (n xmlNode) generic() interface{} {
+	if len(n.Children) == 0 {
+		return strings.TrimSpace(n.Text)
+	}
+	list := true
+	for _, child := range n.Children {
+		list = list && child.XMLName.Local == xmlItem
+	}
+	if list {
+		items := make([]interface{}, 0, len(n.Children))
+		for _, child := range n.Children {
+			items = append(items, child.generic())
+		}
+		return items
+	}
+	object := make(map[string]interface{}, len(n.Children))
+	for _, child := range n.Children {
+		object[child.XMLName.Local] = child.generic()
+	}
+	return object
+}
+
+// unmarshalXML reads the element layout marshalXML writes, whatever the root element is named
+func unmarshalXML(data []byte, value interface{}) error {
+	var root xmlNode
+	if err := xml.Unmarshal(data, &root); err != nil {
+		return err
+	}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:          "json",
+		WeaklyTypedInput: true,
+		Result:           value,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeHookFunc(time.RFC3339),
+			rawMessageHook,
+		),
+	})
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(root.generic())
+}
+
+// rawMessageHook keeps the subtree of json.RawMessage fields as JSON
+func rawMessageHook(from reflect.Type, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(json.RawMessage{}) {
+		return data, nil
+	}
+	return json.Marshal(data)
+}
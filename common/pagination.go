@@ -0,0 +1,116 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/configs"
+	"semay.com/i18n"
+)
+
+var (
+	// ErrInvalidQuery is wrapped by every error caused by bad list parameters
+	ErrInvalidQuery  = errors.New("invalid list query")
+	ErrInvalidPage   = fmt.Errorf("%w: page and size must be positive numbers", ErrInvalidQuery)
+	ErrInvalidCursor = fmt.Errorf("%w: cursor is malformed or was issued for another sort", ErrInvalidQuery)
+	ErrInvalidSort   = fmt.Errorf("%w: sort field is not sortable", ErrInvalidQuery)
+)
+
+// QueryError is a bad list parameter answered with the message id Detail and its Params
+type QueryError struct {
+	// the sentinel the error is, ErrInvalidQuery or one wrapping it
+	Kind   error
+	Detail string
+	Params i18n.Params
+}
+
+// InvalidQuery builds the error of a bad list parameter of the kind
+func InvalidQuery(kind error, detail string, params i18n.Params) *QueryError {
+	return &QueryError{Kind: kind, Detail: detail, Params: params}
+}
+
+func (e *QueryError) Error() string {
+	return fmt.Sprintf("%v: %v %v", e.Kind, e.Detail, e.Params)
+}
+
+func (e *QueryError) Unwrap() error {
+	return e.Kind
+}
+
+// PageSizes returns the configured default and maximum page sizes
+func PageSizes() (int, int) {
+	default_size := configs.AppConfig.GetIntOrDefault("PAGINATION_DEFAULT_SIZE", 10)
+	max_size := configs.AppConfig.GetIntOrDefault("PAGINATION_MAX_SIZE", 50)
+	if max_size <= 0 {
+		max_size = 50
+	}
+	if default_size <= 0 || default_size > max_size {
+		default_size = max_size
+	}
+	return default_size, max_size
+}
+
+// PageParams reads ?page= and ?size=, missing values fall back to the first page and default size
+func PageParams(contx echo.Context) (int, int, error) {
+	page, size := 1, 0
+	if raw := contx.QueryParam("page"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return 0, 0, ErrInvalidPage
+		}
+		page = parsed
+	}
+	if raw := contx.QueryParam("size"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			return 0, 0, ErrInvalidPage
+		}
+		size = parsed
+	}
+	return page, size, nil
+}
+
+// Paginate counts the rows of query and fetches one page of them into T in the given ordering.
+// The query carries the model and any scopes of the caller, e.g. db.Model(&models.Role{}).Where(...).
+// A size of 0 takes the default size, larger sizes than the maximum are capped.
+func Paginate[T any](ctx context.Context, query *gorm.DB, sort []SortField, page int, size int) (ResponsePagination, error) {
+	default_size, max_size := PageSizes()
+	if size <= 0 {
+		size = default_size
+	}
+	if size > max_size {
+		size = max_size
+	}
+	if page < 1 {
+		page = 1
+	}
+
+	// a new session so the count and the fetch do not share statement state
+	base := query.Session(&gorm.Session{Context: ctx})
+
+	var total int64
+	if err := base.Count(&total).Error; err != nil {
+		return ResponsePagination{}, err
+	}
+
+	items := make([]T, 0, size)
+	sort = withTiebreak(sort)
+	if err := orderBy(base, sort).Limit(size).Offset((page - 1) * size).Find(&items).Error; err != nil {
+		return ResponsePagination{}, err
+	}
+
+	return ResponsePagination{
+		Success: true,
+		Items:   items,
+		Total:   uint(total),
+		Page:    uint(page),
+		Size:    uint(size),
+		Pages:   uint(math.Ceil(float64(total) / float64(size))),
+		Sort:    sortString(sort),
+	}, nil
+}
@@ -0,0 +1,324 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/configs"
+	"semay.com/i18n"
+	"semay.com/validation"
+)
+
+// MIMEApplicationProblemJSON is the media type of RFC 7807 problem details
+const MIMEApplicationProblemJSON = "application/problem+json"
+
+// stable codes of the error kinds, clients switch on these rather than on messages
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidQuery       = "invalid_query"
+	CodeValidation         = "validation_failed"
+	CodeUnauthorized       = "unauthorized"
+	CodeForbidden          = "forbidden"
+	CodeNotFound           = "not_found"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeNotAcceptable      = "not_acceptable"
+	CodeConflict           = "conflict"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeUnprocessable      = "unprocessable"
+	CodeLocked             = "locked"
+	CodeTooManyRequests    = "too_many_requests"
+	CodeInternal           = "internal_error"
+	CodeServiceUnavailable = "service_unavailable"
+)
+
+// codes of the statuses errors not built here come with
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            CodeBadRequest,
+	http.StatusUnauthorized:          CodeUnauthorized,
+	http.StatusForbidden:             CodeForbidden,
+	http.StatusNotFound:              CodeNotFound,
+	http.StatusMethodNotAllowed:      CodeMethodNotAllowed,
+	http.StatusNotAcceptable:         CodeNotAcceptable,
+	http.StatusConflict:              CodeConflict,
+	http.StatusRequestEntityTooLarge: CodePayloadTooLarge,
+	http.StatusUnsupportedMediaType:  CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:   CodeUnprocessable,
+	http.StatusLocked:                CodeLocked,
+	http.StatusTooManyRequests:       CodeTooManyRequests,
+	http.StatusInternalServerError:   CodeInternal,
+	http.StatusServiceUnavailable:    CodeServiceUnavailable,
+}
+
+// Error is a domain error with the status and code it is answered with.
+// Detail is the message id shown to clients, Err is the internal cause and stays out of production responses.
+type Error struct {
+	Status int
+	Code   string
+	Detail string
+	// field problems of validation errors, validator.ValidationErrors are translated when answered
+	Errors interface{}
+	// values of the detail message, see i18n.Params
+	Params i18n.Params
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Detail + ": " + e.Err.Error()
+	}
+	return e.Detail
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// With sets the values of the detail message
+func (e *Error) With(params i18n.Params) *Error {
+	e.Params = params
+	return e
+}
+
+// NewError builds an error of any status, the code defaults to the one of the status
+func NewError(status int, code string, detail string) *Error {
+	if code == "" {
+		code = statusCodes[status]
+	}
+	return &Error{Status: status, Code: code, Detail: detail}
+}
+
+// BadRequest is a malformed request
+func BadRequest(detail string) *Error {
+	return NewError(http.StatusBadRequest, CodeBadRequest, detail)
+}
+
+// Validation is a well formed request breaking the rules, problems lists them
+func Validation(detail string, problems interface{}) *Error {
+	err := NewError(http.StatusBadRequest, CodeValidation, detail)
+	err.Errors = problems
+	return err
+}
+
+// Invalid turns the error of a struct validation into a validation error listing the failed rules,
+// a conflict when the only rules failed are unique ones
+func Invalid(err error) *Error {
+	var validation_errors validator.ValidationErrors
+	if !errors.As(err, &validation_errors) {
+		// the text of other errors is no message of the catalogue, it stays internal
+		invalid := BadRequest("error.invalid")
+		invalid.Err = err
+		return invalid
+	}
+	taken := true
+	for _, field_error := range validation_errors {
+		taken = taken && field_error.Tag() == "unique"
+	}
+	if taken {
+		conflict := Conflict("error.exists")
+		conflict.Errors = validation_errors
+		return conflict
+	}
+	return Validation("error.invalid", validation_errors)
+}
+
+// Unauthorized is a caller that could not be authenticated
+func Unauthorized(detail string) *Error {
+	return NewError(http.StatusUnauthorized, CodeUnauthorized, detail)
+}
+
+// Forbidden is an authenticated caller without the permission
+func Forbidden(detail string) *Error {
+	return NewError(http.StatusForbidden, CodeForbidden, detail)
+}
+
+// NotFound is a missing resource
+func NotFound(detail string) *Error {
+	return NewError(http.StatusNotFound, CodeNotFound, detail)
+}
+
+// Conflict is a write clashing with the current state, like a taken unique value
+func Conflict(detail string) *Error {
+	return NewError(http.StatusConflict, CodeConflict, detail)
+}
+
+// Internal is a failure of ours, detail says what failed without the cause
+func Internal(detail string, err error) *Error {
+	internal := NewError(http.StatusInternalServerError, CodeInternal, detail)
+	internal.Err = err
+	return internal
+}
+
+// IsDuplicate tells whether a database error comes from a unique constraint
+func IsDuplicate(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return true
+	}
+	message := strings.ToLower(err.Error())
+	return strings.Contains(message, "unique constraint") || strings.Contains(message, "duplicate key")
+}
+
+// Problem is an RFC 7807 problem details body
+type Problem struct {
+	Type      string      `json:"type"`
+	Title     string      `json:"title"`
+	Status    int         `json:"status"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	Code      string      `json:"code"`
+	RequestID string      `json:"request_id,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
+	// the internal cause, outside of production only
+	Internal string `json:"internal,omitempty"`
+}
+
+// IsProduction tells whether internal details must stay out of responses, unless APP_ENV says otherwise it does
+func IsProduction() bool {
+	return configs.AppConfig.GetOrDefault("APP_ENV", "production") == "production"
+}
+
+// asError classifies any error into a domain error
+func asError(err error) *Error {
+	var domain *Error
+	if errors.As(err, &domain) {
+		return domain
+	}
+
+	var http_error *echo.HTTPError
+	if errors.As(err, &http_error) {
+		if internal, ok := http_error.Internal.(*echo.HTTPError); ok {
+			http_error = internal
+		}
+		result := NewError(http_error.Code, "", http.StatusText(http_error.Code))
+		if message, ok := http_error.Message.(string); ok && http_error.Code < http.StatusInternalServerError {
+			result.Detail = message
+		}
+		result.Err = http_error.Internal
+		return result
+	}
+
+	var validation_errors validator.ValidationErrors
+	switch {
+	case errors.As(err, &validation_errors):
+		return Invalid(err)
+	case errors.Is(err, ErrInvalidQuery):
+		return invalidQuery(err)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return NotFound("error.not_found")
+	case IsDuplicate(err):
+		result := Conflict("error.exists")
+		result.Err = err
+		return result
+	}
+	return Internal("error.internal", err)
+}
+
+// messages of the list parameter errors returned as they are
+var queryMessages = map[error]string{
+	ErrInvalidPage:   "query.invalid_page",
+	ErrInvalidCursor: "query.invalid_cursor",
+	ErrInvalidSort:   "query.invalid_sort",
+}
+
+// invalidQuery answers bad list parameters with their message, errors only wrapping
+// ErrInvalidQuery get a generic one and keep their text internal
+func invalidQuery(err error) *Error {
+	result := NewError(http.StatusBadRequest, CodeInvalidQuery, "query.invalid")
+	result.Err = err
+
+	var filter_error *FilterError
+	var query_error *QueryError
+	switch {
+	case errors.As(err, &filter_error):
+		result.Detail = "query.invalid_filter"
+		result.Errors = filter_error.Problems
+	case errors.As(err, &query_error):
+		result.Detail, result.Params = query_error.Detail, query_error.Params
+	default:
+		for sentinel, detail := range queryMessages {
+			if errors.Is(err, sentinel) {
+				result.Detail = detail
+			}
+		}
+	}
+	return result
+}
+
+// ProblemFor builds the problem details answering err to the request
+func ProblemFor(contx echo.Context, err error) Problem {
+	domain := asError(err)
+	translate := translator(contx)
+	problem := Problem{
+		Type:      configs.AppConfig.GetOrDefault("PROBLEM_TYPE_BASE", "about:blank"),
+		Title:     http.StatusText(domain.Status),
+		Status:    domain.Status,
+		Detail:    translate(domain.Detail, domain.Params),
+		Instance:  contx.Request().URL.Path,
+		Code:      domain.Code,
+		RequestID: contx.Response().Header().Get(echo.HeaderXRequestID),
+		Errors:    domain.Errors,
+	}
+	switch problems := domain.Errors.(type) {
+	case validator.ValidationErrors:
+		problem.Errors = validation.Errors(problems, validation.Translator(Languages(contx)...))
+	case []*QueryError:
+		messages := make([]string, 0, len(problems))
+		for _, query_error := range problems {
+			messages = append(messages, translate(query_error.Detail, query_error.Params))
+		}
+		problem.Errors = messages
+	}
+	if problem.Type != "about:blank" {
+		problem.Type = strings.TrimSuffix(problem.Type, "/") + "/" + domain.Code
+	}
+	if problem.Code == "" {
+		problem.Code = CodeInternal
+	}
+	if domain.Err != nil && !IsProduction() {
+		problem.Internal = domain.Err.Error()
+	}
+	return problem
+}
+
+// Fail answers the request with the problem details of err in the negotiated format
+func Fail(contx echo.Context, err error) error {
+	problem := ProblemFor(contx, err)
+	if problem.Status >= http.StatusInternalServerError {
+		contx.Logger().Errorf("request %v failed: %v", problem.RequestID, err)
+	}
+
+	codec, ok := Negotiate(contx.Request().Header.Get(echo.HeaderAccept))
+	content_type := codec.MediaType
+	switch {
+	case !ok || codec.MediaType == echo.MIMEApplicationJSON:
+		codec, content_type = Codecs[0], MIMEApplicationProblemJSON
+	case codec.MediaType == echo.MIMEApplicationXML:
+		content_type = "application/problem+xml"
+	}
+
+	body, err := codec.Marshal(problem)
+	if err != nil {
+		return err
+	}
+	if contx.Request().Method == http.MethodHead {
+		return contx.NoContent(problem.Status)
+	}
+	return contx.Blob(problem.Status, content_type, body)
+}
+
+// HTTPErrorHandler answers the errors handlers and middlewares return with problem details
+func HTTPErrorHandler(err error, contx echo.Context) {
+	if contx.Response().Committed {
+		return
+	}
+	if fail_error := Fail(contx, err); fail_error != nil {
+		contx.Logger().Error(fail_error)
+	}
+}
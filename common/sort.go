@@ -0,0 +1,92 @@
+package common
+
+import (
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/i18n"
+)
+
+// tiebreaker closing every ordering so rows with equal sort values keep a stable order
+const tiebreakColumn = "id"
+
+// SortField is one column of a list ordering
+type SortField struct {
+	// name of the field in the query string
+	Name   string
+	Column string
+	Desc   bool
+	// set on columns holding NULL, which then sort after every value
+	Nullable bool
+}
+
+func (f SortField) String() string {
+	if f.Desc {
+		return "-" + f.Name
+	}
+	return f.Name
+}
+
+// ParseSort reads a comma separated ordering like -name,id, a - prefix sorts descending.
+// allowed maps the sortable query names of a model to their columns.
+func ParseSort(raw string, allowed map[string]string) ([]SortField, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+
+	sort := make([]SortField, 0)
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(raw, ",") {
+		part = strings.TrimSpace(part)
+		field := SortField{Name: strings.TrimPrefix(part, "-"), Desc: strings.HasPrefix(part, "-")}
+		column, ok := allowed[field.Name]
+		if !ok {
+			return nil, InvalidQuery(ErrInvalidSort, "query.not_sortable", i18n.Params{"field": field.Name})
+		}
+		if seen[column] {
+			return nil, InvalidQuery(ErrInvalidQuery, "query.sorted_twice", i18n.Params{"field": field.Name})
+		}
+		seen[column] = true
+		field.Column = column
+		sort = append(sort, field)
+	}
+	return sort, nil
+}
+
+// withTiebreak appends the tiebreaker column unless the ordering already ends the ties
+func withTiebreak(sort []SortField) []SortField {
+	for _, field := range sort {
+		if field.Column == tiebreakColumn {
+			return sort
+		}
+	}
+	return append(sort[:len(sort):len(sort)], SortField{Name: tiebreakColumn, Column: tiebreakColumn})
+}
+
+// orderBy adds the ordering to query with quoted columns
+func orderBy(query *gorm.DB, sort []SortField) *gorm.DB {
+	for _, field := range sort {
+		// databases disagree on where NULL goes, so it is placed explicitly
+		if field.Nullable {
+			nulls := query.Statement.Quote(clause.Column{Name: field.Column}) + " IS NULL"
+			query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: nulls, Raw: true}, Desc: field.Desc})
+		}
+		query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: field.Column}, Desc: field.Desc})
+	}
+	return query
+}
+
+func sortString(sort []SortField) string {
+	names := make([]string, 0, len(sort))
+	for _, field := range sort {
+		names = append(names, field.String())
+	}
+	return strings.Join(names, ",")
+}
+
+// Sorted orders query by sort with the tiebreaker, the same ordering the paginated lists use
+func Sorted(query *gorm.DB, sort []SortField) *gorm.DB {
+	return orderBy(query, withTiebreak(sort))
+}
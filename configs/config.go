@@ -3,6 +3,8 @@ package configs
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -69,3 +71,22 @@ func (e *EnvConfig) GetOrDefault(key, defaultValue string) string {
 
 	return defaultValue
 }
+
+func (e *EnvConfig) GetIntOrDefault(key string, defaultValue int) int {
+	// values may carry an inline unit comment, e.g. 60 #in minutes
+	val := strings.TrimSpace(strings.SplitN(os.Getenv(key), "#", 2)[0])
+	if parsed, err := strconv.Atoi(val); err == nil {
+		return parsed
+	}
+
+	return defaultValue
+}
+
+func (e *EnvConfig) GetBoolOrDefault(key string, defaultValue bool) bool {
+	val := strings.TrimSpace(strings.SplitN(os.Getenv(key), "#", 2)[0])
+	if parsed, err := strconv.ParseBool(val); err == nil {
+		return parsed
+	}
+
+	return defaultValue
+}
@@ -0,0 +1,234 @@
+package export
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrUnknownFormat is returned for formats not in Formats
+var ErrUnknownFormat = errors.New("unknown export format, use csv, ndjson or xlsx")
+
+// Format is an export file format
+type Format struct {
+	Name        string
+	ContentType string
+	Extension   string
+}
+
+// Formats are the supported export formats by name
+var Formats = map[string]Format{
+	"csv":    {Name: "csv", ContentType: "text/csv; charset=utf-8", Extension: "csv"},
+	"ndjson": {Name: "ndjson", ContentType: "application/x-ndjson", Extension: "ndjson"},
+	"xlsx":   {Name: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", Extension: "xlsx"},
+}
+
+// Lookup finds a format by name, an empty name is csv
+func Lookup(name string) (Format, error) {
+	if name == "" {
+		name = "csv"
+	}
+	format, ok := Formats[strings.ToLower(name)]
+	if !ok {
+		return Format{}, ErrUnknownFormat
+	}
+	return format, nil
+}
+
+// Writer writes exported items one at a time, Close must be called to complete the file
+type Writer interface {
+	Write(item interface{}) error
+	Close() error
+}
+
+// Column is an exported field of the DTO, named after its json name
+type Column struct {
+	Name  string
+	index []int
+}
+
+// Columns lists the json named fields of a DTO, the fields of embedded structs count as its own
+func Columns(dto interface{}) []Column {
+	return columnsOf(reflect.TypeOf(dto), nil)
+}
+
+func columnsOf(kind reflect.Type, parent []int) []Column {
+	for kind.Kind() == reflect.Ptr {
+		kind = kind.Elem()
+	}
+	columns := make([]Column, 0, kind.NumField())
+	for i := 0; i < kind.NumField(); i++ {
+		field := kind.Field(i)
+		index := append(parent[:len(parent):len(parent)], i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, columnsOf(field.Type, index)...)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, Column{Name: name, index: index})
+	}
+	return columns
+}
+
+// values reads the columns of item, nil pointers are nil
+func values(columns []Column, item interface{}) []interface{} {
+	row := reflect.Indirect(reflect.ValueOf(item))
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		field := row.FieldByIndex(column.index)
+		for field.Kind() == reflect.Ptr {
+			if field.IsNil() {
+				break
+			}
+			field = field.Elem()
+		}
+		if field.Kind() == reflect.Ptr {
+			continue
+		}
+		values[i] = field.Interface()
+	}
+	return values
+}
+
+// text formats a value for text cells
+func text(value interface{}) string {
+	switch value := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return value
+	case time.Time:
+		return value.Format(time.RFC3339)
+	case fmt.Stringer:
+		return value.String()
+	case []string:
+		return strings.Join(value, ",")
+	}
+	kind := reflect.ValueOf(value)
+	if kind.Kind() == reflect.Slice || kind.Kind() == reflect.Map || kind.Kind() == reflect.Struct {
+		raw, _ := json.Marshal(value)
+		return string(raw)
+	}
+	return fmt.Sprint(value)
+}
+
+// NewWriter starts an export of items shaped like dto to out, writing the header when the format has one
+func NewWriter(format Format, out io.Writer, dto interface{}) (Writer, error) {
+	columns := Columns(dto)
+	switch format.Name {
+	case "csv":
+		return newCSVWriter(out, columns)
+	case "ndjson":
+		return &ndjsonWriter{encoder: json.NewEncoder(out)}, nil
+	case "xlsx":
+		return newXLSXWriter(out, columns)
+	}
+	return nil, ErrUnknownFormat
+}
+
+// Stream writes every row of rows in format to out, each scanned into T which is also the shape of the export
+func Stream[T any](db *gorm.DB, rows *sql.Rows, format Format, out io.Writer) error {
+	writer, err := NewWriter(format, out, new(T))
+	if err != nil {
+		rows.Close()
+		return err
+	}
+	if err := Rows[T](db, rows, writer); err != nil {
+		return err
+	}
+	return writer.Close()
+}
+
+// Rows writes every row of rows, scanning them one by one into T so the
+// result set is never held in memory. It closes rows but not the writer.
+func Rows[T any](db *gorm.DB, rows *sql.Rows, writer Writer) error {
+	defer rows.Close()
+	for rows.Next() {
+		var item T
+		if err := db.ScanRows(rows, &item); err != nil {
+			return err
+		}
+		if err := writer.Write(&item); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+type csvWriter struct {
+	writer  *csv.Writer
+	columns []Column
+}
+
+func newCSVWriter(out io.Writer, columns []Column) (*csvWriter, error) {
+	writer := &csvWriter{writer: csv.NewWriter(out), columns: columns}
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return writer, writer.writer.Write(header)
+}
+
+func (w *csvWriter) Write(item interface{}) error {
+	record := make([]string, len(w.columns))
+	for i, value := range values(w.columns, item) {
+		record[i] = text(value)
+		if _, ok := value.(string); ok {
+			record[i] = defuse(record[i])
+		}
+	}
+	return w.writer.Write(record)
+}
+
+func (w *csvWriter) Close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// defuse keeps spreadsheets from running text cells starting like a formula
+func defuse(cell string) string {
+	if cell != "" && strings.ContainsRune("=+-@\t\r", rune(cell[0])) {
+		return "'" + cell
+	}
+	return cell
+}
+
+type ndjsonWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(item interface{}) error {
+	return w.encoder.Encode(item)
+}
+
+func (w *ndjsonWriter) Close() error {
+	return nil
+}
+
+// cellNumber formats the numbers xlsx stores as numeric cells
+func cellNumber(value interface{}) (string, bool) {
+	switch value := value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return fmt.Sprint(value), true
+	case float32:
+		return strconv.FormatFloat(float64(value), 'g', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(value, 'g', -1, 64), true
+	}
+	return "", false
+}
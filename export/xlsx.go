@@ -0,0 +1,127 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// the parts of a workbook with a single sheet, besides the sheet itself
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+</Types>`},
+	{"_rels/.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`},
+	{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="export" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`},
+	{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+</Relationships>`},
+}
+
+// xlsxWriter streams the rows into the sheet entry of the zip, with inline strings
+// so nothing like a shared string table has to be kept until the end
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+	columns []Column
+	row     int
+}
+
+func newXLSXWriter(out io.Writer, columns []Column) (*xlsxWriter, error) {
+	archive := zip.NewWriter(out)
+	for _, part := range xlsxParts {
+		entry, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(entry, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	entry, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	writer := &xlsxWriter{archive: archive, sheet: bufio.NewWriter(entry), columns: columns}
+	writer.sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	return writer, writer.writeRow(header)
+}
+
+func (w *xlsxWriter) Write(item interface{}) error {
+	return w.writeRow(values(w.columns, item))
+}
+
+func (w *xlsxWriter) writeRow(values []interface{}) error {
+	w.row++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.row)
+	for i, value := range values {
+		ref := fmt.Sprintf("%v%d", columnName(i), w.row)
+		switch value := value.(type) {
+		case nil:
+			continue
+		case bool:
+			cell := "0"
+			if value {
+				cell = "1"
+			}
+			fmt.Fprintf(w.sheet, `<c r="%v" t="b"><v>%v</v></c>`, ref, cell)
+			continue
+		}
+		if number, ok := cellNumber(value); ok {
+			fmt.Fprintf(w.sheet, `<c r="%v"><v>%v</v></c>`, ref, number)
+			continue
+		}
+		fmt.Fprintf(w.sheet, `<c r="%v" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		if err := xml.EscapeText(w.sheet, []byte(text(value))); err != nil {
+			return err
+		}
+		w.sheet.WriteString(`</t></is></c>`)
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+func (w *xlsxWriter) Close() error {
+	w.sheet.WriteString("</sheetData></worksheet>")
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.archive.Close()
+}
+
+// columnName is the spreadsheet name of the column at index, A to Z then AA and on
+func columnName(index int) string {
+	var name strings.Builder
+	for index++; index > 0; index = (index - 1) / 26 {
+		name.WriteByte(byte('A' + (index-1)%26))
+	}
+	letters := []byte(name.String())
+	for i, j := 0, len(letters)-1; i < j; i, j = i+1, j-1 {
+		letters[i], letters[j] = letters[j], letters[i]
+	}
+	return string(letters)
+}
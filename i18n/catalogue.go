@@ -0,0 +1,182 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/locales"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	"semay.com/configs"
+)
+
+//go:embed locales/*.json
+var bundles embed.FS
+
+// Params are the values put in place of the {name} markers of a message, count also picks the plural form
+type Params map[string]interface{}
+
+// Message is a catalogue entry, a text or one text per plural category (zero, one, two, few, many, other)
+type Message struct {
+	Text   string
+	Plural map[string]string
+}
+
+// UnmarshalJSON reads a string as a text and an object as plural forms
+func (m *Message) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &m.Text); err == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, &m.Plural); err != nil {
+		return fmt.Errorf("a message is a string or an object of plural forms: %w", err)
+	}
+	if _, ok := m.Plural["other"]; !ok {
+		return fmt.Errorf("plural messages need an other form")
+	}
+	return nil
+}
+
+// plural rules of the languages bundles can be written in, others tell one from other only
+var pluralRules = map[string]locales.Translator{
+	"en": en.New(),
+	"fr": fr.New(),
+	"es": es.New(),
+}
+
+// Catalogue holds the messages of every locale by their ids
+type Catalogue struct {
+	fallback string
+	messages map[string]map[string]Message
+}
+
+// NewCatalogue builds an empty catalogue, messages missing in a locale come from the fallback one
+func NewCatalogue(fallback string) *Catalogue {
+	return &Catalogue{fallback: Normalize(fallback), messages: make(map[string]map[string]Message)}
+}
+
+// Load reads the bundles of a directory, one <locale>.json file per locale.
+// Messages of a locale loaded before are replaced one by one.
+func (c *Catalogue) Load(fsys fs.FS, dir string) error {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		raw, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return err
+		}
+		var bundle map[string]Message
+		if err := json.Unmarshal(raw, &bundle); err != nil {
+			return fmt.Errorf("bundle %v: %w", file, err)
+		}
+
+		locale := Normalize(strings.TrimSuffix(path.Base(file), ".json"))
+		if c.messages[locale] == nil {
+			c.messages[locale] = make(map[string]Message, len(bundle))
+		}
+		for id, message := range bundle {
+			c.messages[locale][id] = message
+		}
+	}
+	return nil
+}
+
+// Locales lists the locales having a bundle
+func (c *Catalogue) Locales() []string {
+	names := make([]string, 0, len(c.messages))
+	for locale := range c.messages {
+		names = append(names, locale)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Match picks the first of the languages having a bundle, the fallback locale when none has
+func (c *Catalogue) Match(languages []string) string {
+	for _, language := range languages {
+		if _, ok := c.messages[Normalize(language)]; ok {
+			return Normalize(language)
+		}
+	}
+	return c.fallback
+}
+
+// Translate writes the message id in the first of the languages having it, in the fallback locale otherwise.
+// Ids found in no bundle are written as they are, so texts that are no ids pass through.
+func (c *Catalogue) Translate(languages []string, id string, params Params) string {
+	for _, language := range append(languages, c.fallback) {
+		locale := Normalize(language)
+		if message, ok := c.messages[locale][id]; ok {
+			return format(locale, message, params)
+		}
+	}
+	return id
+}
+
+// format picks the plural form of the count parameter and puts the parameters in
+func format(locale string, message Message, params Params) string {
+	text := message.Text
+	if message.Plural != nil {
+		text = message.Plural[pluralCategory(locale, params["count"])]
+		if text == "" {
+			text = message.Plural["other"]
+		}
+	}
+	if len(params) == 0 {
+		return text
+	}
+
+	replacements := make([]string, 0, 2*len(params))
+	for name, value := range params {
+		replacements = append(replacements, "{"+name+"}", fmt.Sprint(value))
+	}
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// pluralCategory is the plural category of a whole count in the language of locale
+func pluralCategory(locale string, count interface{}) string {
+	var number float64
+	if _, err := fmt.Sscan(fmt.Sprint(count), &number); err != nil {
+		return "other"
+	}
+	base, _, _ := strings.Cut(locale, "_")
+	rules, ok := pluralRules[base]
+	if !ok {
+		if number == 1 {
+			return "one"
+		}
+		return "other"
+	}
+	return strings.ToLower(rules.CardinalPluralRule(number, 0).String())
+}
+
+var (
+	loadOnce sync.Once
+	messages *Catalogue
+)
+
+// Messages is the catalogue of the app: the bundles built in, then those of the LOCALES_DIR directory
+// adding locales or replacing messages. It is loaded on first use, once the environment is read.
+func Messages() *Catalogue {
+	loadOnce.Do(func() {
+		messages = NewCatalogue(configs.AppConfig.GetOrDefault("DEFAULT_LOCALE", "en"))
+		if err := messages.Load(bundles, "locales"); err != nil {
+			panic(err)
+		}
+		if dir := configs.AppConfig.GetOrDefault("LOCALES_DIR", ""); dir != "" {
+			if err := messages.Load(os.DirFS(dir), "."); err != nil {
+				panic(err)
+			}
+		}
+	})
+	return messages
+}
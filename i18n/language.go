@@ -0,0 +1,69 @@
+package i18n
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Languages lists the language tags of an Accept-Language header, most preferred first.
+// Regional tags are followed by their base language, e.g. fr-CA, fr. Wildcards and tags
+// with a zero quality are left out.
+func Languages(accept_language string) []string {
+	type weighted struct {
+		tag     string
+		quality float64
+	}
+	tags := make([]weighted, 0)
+	for _, part := range strings.Split(accept_language, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		tag = strings.TrimSpace(tag)
+		if tag == "" || tag == "*" {
+			continue
+		}
+		quality := 1.0
+		for _, param := range strings.Split(params, ";") {
+			key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if key == "q" {
+				if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+					quality = parsed
+				}
+			}
+		}
+		if quality > 0 {
+			tags = append(tags, weighted{Normalize(tag), quality})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].quality > tags[j].quality })
+
+	languages := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+	add := func(tag string) {
+		if !seen[tag] {
+			seen[tag] = true
+			languages = append(languages, tag)
+		}
+	}
+	for _, tag := range tags {
+		add(tag.tag)
+		if base, _, regional := strings.Cut(tag.tag, "_"); regional {
+			add(base)
+		}
+	}
+	return languages
+}
+
+// Normalize writes a language tag the way locale names are written, e.g. pt-br as pt_BR
+func Normalize(tag string) string {
+	parts := strings.FieldsFunc(tag, func(r rune) bool { return r == '-' || r == '_' })
+	if len(parts) == 0 {
+		return ""
+	}
+	parts[0] = strings.ToLower(parts[0])
+	for i := 1; i < len(parts); i++ {
+		if len(parts[i]) == 2 {
+			parts[i] = strings.ToUpper(parts[i])
+		}
+	}
+	return strings.Join(parts, "_")
+}
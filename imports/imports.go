@@ -0,0 +1,162 @@
+package imports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+)
+
+var (
+	// ErrUnknownFormat is returned for files that are neither CSV nor JSON
+	ErrUnknownFormat = errors.New("unknown import format, send CSV or a JSON array")
+	// ErrTooManyRows is returned for files with more rows than allowed
+	ErrTooManyRows = errors.New("too many rows to import")
+	// ErrMalformed is returned for files that are not valid CSV or no JSON array
+	ErrMalformed = errors.New("malformed import file")
+	// ErrWrongType is the Err of rows with values that do not convert to their field
+	ErrWrongType = errors.New("values of the wrong type")
+)
+
+// UnknownFieldsError is the Err of rows with names the item does not have
+type UnknownFieldsError struct {
+	Fields []string
+}
+
+func (e *UnknownFieldsError) Error() string {
+	return "unknown fields: " + strings.Join(e.Fields, ", ")
+}
+
+// Row is a record read from a file, Err tells why it could not be read into Item
+type Row[T any] struct {
+	// position of the record in the file, from 1 and without the CSV header
+	Line int
+	Item T
+	Err  error
+}
+
+// FormatOf picks csv or json from a content type, or from the extension of a file name
+func FormatOf(content_type string, filename string) (string, error) {
+	media, _, _ := mime.ParseMediaType(content_type)
+	switch media {
+	case "text/csv", "application/csv":
+		return "csv", nil
+	case "application/json":
+		return "json", nil
+	}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return "csv", nil
+	case ".json":
+		return "json", nil
+	}
+	return "", ErrUnknownFormat
+}
+
+// Read reads at most max records of T from a CSV file with a header of json names, or a JSON array.
+// A malformed file is an error, records that do not fit T are returned with their Err set.
+func Read[T any](format string, reader io.Reader, max int) ([]Row[T], error) {
+	switch format {
+	case "csv":
+		return readCSV[T](reader, max)
+	case "json":
+		return readJSON[T](reader, max)
+	}
+	return nil, ErrUnknownFormat
+}
+
+func readCSV[T any](reader io.Reader, max int) ([]Row[T], error) {
+	records := csv.NewReader(reader)
+	records.TrimLeadingSpace = true
+	header, err := records.Read()
+	if err == io.EOF {
+		return []Row[T]{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: error reading csv header: %v", ErrMalformed, err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(strings.TrimPrefix(header[i], "\ufeff"))
+	}
+
+	rows := make([]Row[T], 0)
+	for {
+		record, err := records.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: error reading csv: %v", ErrMalformed, err)
+		}
+		if len(rows) == max {
+			return nil, fmt.Errorf("%w, at most %d are allowed", ErrTooManyRows, max)
+		}
+
+		values := make(map[string]interface{}, len(header))
+		for i, name := range header {
+			values[name] = record[i]
+		}
+		row := Row[T]{Line: len(rows) + 1}
+		row.Err = decode(values, &row.Item)
+		rows = append(rows, row)
+	}
+}
+
+func readJSON[T any](reader io.Reader, max int) ([]Row[T], error) {
+	decoder := json.NewDecoder(reader)
+	if token, err := decoder.Token(); err != nil || token != json.Delim('[') {
+		return nil, fmt.Errorf("%w: a JSON array is expected", ErrMalformed)
+	}
+
+	rows := make([]Row[T], 0)
+	for decoder.More() {
+		if len(rows) == max {
+			return nil, fmt.Errorf("%w, at most %d are allowed", ErrTooManyRows, max)
+		}
+		var values map[string]interface{}
+		if err := decoder.Decode(&values); err != nil {
+			return nil, fmt.Errorf("%w: error reading json record %d: %v", ErrMalformed, len(rows)+1, err)
+		}
+		row := Row[T]{Line: len(rows) + 1}
+		row.Err = decode(values, &row.Item)
+		rows = append(rows, row)
+	}
+	if _, err := decoder.Token(); err != nil {
+		return nil, fmt.Errorf("%w: error reading json: %v", ErrMalformed, err)
+	}
+	return rows, nil
+}
+
+// decode fills item from the values by json name, unknown names and unconvertible values are an error
+func decode(values map[string]interface{}, item interface{}) error {
+	var metadata mapstructure.Metadata
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		TagName:          "json",
+		WeaklyTypedInput: true,
+		Metadata:         &metadata,
+		Result:           item,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := decoder.Decode(values); err != nil {
+		var decode_error *mapstructure.Error
+		if errors.As(err, &decode_error) {
+			return fmt.Errorf("%w: %s", ErrWrongType, strings.Join(decode_error.Errors, "; "))
+		}
+		return err
+	}
+	if len(metadata.Unused) > 0 {
+		sort.Strings(metadata.Unused)
+		return &UnknownFieldsError{Fields: metadata.Unused}
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/models"
+	"semay.com/models/controlers"
+)
+
+var (
+	apiKeyCmd = &cobra.Command{
+		Use:   "apikey",
+		Short: "Issue and revoke API keys for machine clients",
+		Long:  `Issue and revoke API keys for machine clients`,
+	}
+
+	apiKeyCreateCmd = &cobra.Command{
+		Use:   "create",
+		Short: "Issue a new API key",
+		Long:  `Issue a new API key, the key is printed once and only its hash is stored`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			name, _ := cmd.Flags().GetString("name")
+			scopes, _ := cmd.Flags().GetString("scopes")
+			expires_in, _ := cmd.Flags().GetInt("expires-in")
+			return createAPIKey(name, scopes, expires_in)
+		},
+	}
+
+	apiKeyRevokeCmd = &cobra.Command{
+		Use:   "revoke",
+		Short: "Revoke an API key by its prefix",
+		Long:  `Revoke an API key by its prefix, it is rejected from the next request on`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prefix, _ := cmd.Flags().GetString("prefix")
+			return revokeAPIKey(prefix)
+		},
+	}
+)
+
+func createAPIKey(name string, scopes string, expires_in int) error {
+	if name == "" || scopes == "" {
+		return fmt.Errorf("name and scopes are required")
+	}
+
+	configs.NewEnvFile("./configs")
+	db := database.ReturnSession()
+
+	issued, err := controlers.IssueAPIKey(db, models.APIKeyPost{
+		Name:      name,
+		Scopes:    strings.Split(scopes, ","),
+		ExpiresIn: expires_in,
+	})
+	if err != nil {
+		return fmt.Errorf("error issuing api key: %v", err)
+	}
+
+	fmt.Printf("API key %v issued with prefix %v, store it now as it will not be shown again:\n%v\n", issued.Name, issued.Prefix, issued.Key)
+	return nil
+}
+
+func revokeAPIKey(prefix string) error {
+	if prefix == "" {
+		return fmt.Errorf("prefix is required")
+	}
+
+	configs.NewEnvFile("./configs")
+	db := database.ReturnSession()
+
+	var api_key models.APIKey
+	if err := db.Where("prefix = ?", prefix).First(&api_key).Error; err != nil {
+		return fmt.Errorf("error retrieving api key %v: %v", prefix, err)
+	}
+	if err := controlers.RevokeAPIKey(db, &api_key); err != nil {
+		return fmt.Errorf("error revoking api key: %v", err)
+	}
+
+	fmt.Printf("API key %v revoked.\n", prefix)
+	return nil
+}
+
+func init() {
+	apiKeyCreateCmd.Flags().String("name", "", "name identifying the client")
+	apiKeyCreateCmd.Flags().String("scopes", "", "comma separated permission names")
+	apiKeyCreateCmd.Flags().Int("expires-in", 0, "days until the key expires, 0 never expires")
+	apiKeyRevokeCmd.Flags().String("prefix", "", "visible prefix of the key")
+
+	apiKeyCmd.AddCommand(apiKeyCreateCmd)
+	apiKeyCmd.AddCommand(apiKeyRevokeCmd)
+	goBlueCmd.AddCommand(apiKeyCmd)
+
+}
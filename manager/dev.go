@@ -4,13 +4,19 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/labstack/echo-contrib/echoprometheus"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/labstack/gommon/log"
+	"semay.com/common"
 	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/middlewares"
 	"semay.com/models/controlers"
+	"semay.com/utils"
+	"semay.com/validation"
 
 	"github.com/spf13/cobra"
 )
@@ -43,7 +49,12 @@ func run() {
 		LogLevel:  log.ERROR,
 	}))
 
-	setupRoutes(app)
+	// revoked tokens are shared through the database unless configured otherwise
+	if configs.AppConfig.GetOrDefault("TOKEN_REVOCATION_STORE", "database") == "database" {
+		utils.TokenRevocations = utils.NewDBRevocationStore(database.ReturnSession(), time.Minute)
+	}
+
+	SetupRoutes(app)
 	// starting on provided port
 	go func(app *echo.Echo) {
 		//  Http serving port
@@ -69,12 +80,58 @@ func init() {
 
 }
 
-func setupRoutes(app *echo.Echo) {
-	gapp := app.Group("/admin")
-	gapp.GET("/role", controlers.GetRoles).Name = "get_all_roles"
-	gapp.GET("/role/:role_id", controlers.GetRoleByID).Name = "get_one_roles"
-	gapp.POST("/role", controlers.PostRole).Name = "post_role"
-	gapp.PATCH("/role/:role_id", controlers.PatchRole).Name = "patch_role"
-	gapp.DELETE("/role/:role_id", controlers.DeleteRole).Name = "delete_role"
+// SetupRoutes registers the middleware and every route of the server on app
+func SetupRoutes(app *echo.Echo) {
+	// every error is answered with problem details carrying the request id
+	app.Pre(middleware.RequestID())
+	app.HTTPErrorHandler = common.HTTPErrorHandler
+
+	// bodies and responses in every codec, the file routes take and send their own formats
+	file_routes := map[string]bool{"/admin/role/export": true, "/admin/role/import": true}
+	app.Binder = &common.Binder{}
+	app.Validator = validation.New(database.ReturnSession)
+	app.Use(middlewares.Negotiate(func(contx echo.Context) bool {
+		return file_routes[contx.Path()]
+	}))
+
+	gapp := app.Group("/admin", middlewares.Authenticate(), middlewares.Authorize())
+	controlers.Roles.Register(gapp)
+	gapp.PUT("/role/:role_id", controlers.PutRole).Name = "put_role"
+	gapp.POST("/role/:role_id/activate", controlers.ActivateRole).Name = "activate_role"
+	gapp.POST("/role/:role_id/deactivate", controlers.DeactivateRole).Name = "deactivate_role"
+	gapp.GET("/role/:role_id/tree", controlers.GetRoleTree).Name = "get_role_tree"
+	gapp.POST("/role/:role_id/child/:child_id", controlers.AddRoleChild).Name = "add_role_child"
+	gapp.DELETE("/role/:role_id/child/:child_id", controlers.DeleteRoleChild).Name = "delete_role_child"
+	gapp.GET("/role/export", controlers.ExportRoles).Name = "export_roles"
+	gapp.POST("/role/import", controlers.ImportRoles).Name = "import_roles"
+	gapp.POST("/role/batch", controlers.BatchRoles).Name = "batch_roles"
+
+	gapp.GET("/user", controlers.GetUsers).Name = "get_all_users"
+	gapp.GET("/user/:user_id", controlers.GetUserByID).Name = "get_one_users"
+	gapp.POST("/user", controlers.PostUser).Name = "post_user"
+	gapp.PATCH("/user/:user_id", controlers.PatchUser).Name = "patch_user"
+	gapp.DELETE("/user/:user_id", controlers.DeleteUser).Name = "delete_user"
+	gapp.POST("/user/:user_id/role/:role_id", controlers.AddUserRole).Name = "add_user_role"
+	gapp.DELETE("/user/:user_id/role/:role_id", controlers.DeleteUserRole).Name = "delete_user_role"
+	gapp.POST("/user/:user_id/revoke", controlers.RevokeUserTokens).Name = "revoke_user_tokens"
+	gapp.POST("/user/:user_id/mfa/reset", controlers.ResetUserMFA).Name = "reset_user_mfa"
+	gapp.POST("/user/:user_id/unlock", controlers.UnlockUser).Name = "unlock_user"
+
+	gapp.GET("/permission", controlers.GetPermissions).Name = "get_all_permissions"
+	gapp.POST("/role/:role_id/permission/:permission_id", controlers.AddRolePermission).Name = "add_role_permission"
+	gapp.DELETE("/role/:role_id/permission/:permission_id", controlers.DeleteRolePermission).Name = "delete_role_permission"
+
+	gapp.GET("/apikey", controlers.GetAPIKeys).Name = "get_all_apikeys"
+	gapp.POST("/apikey", controlers.PostAPIKey).Name = "post_apikey"
+	gapp.DELETE("/apikey/:key_id", controlers.DeleteAPIKey).Name = "delete_apikey"
+
+	aapp := app.Group("/auth")
+	aapp.POST("/login", controlers.Login).Name = "login"
+	aapp.POST("/logout", controlers.Logout, middlewares.Authenticate()).Name = "logout"
+	aapp.POST("/mfa/verify", controlers.VerifyMFA).Name = "mfa_verify"
+	aapp.POST("/mfa/enroll", controlers.EnrollMFA, middlewares.AuthenticateMFA()).Name = "mfa_enroll"
+	aapp.POST("/mfa/confirm", controlers.ConfirmMFA, middlewares.AuthenticateMFA()).Name = "mfa_confirm"
+	aapp.GET("/oidc/login", controlers.OIDCLogin).Name = "oidc_login"
+	aapp.GET("/oidc/callback", controlers.OIDCCallback).Name = "oidc_callback"
 
 }
@@ -0,0 +1,96 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/export"
+	"semay.com/models"
+	"semay.com/models/controlers"
+)
+
+var (
+	exportCmd = &cobra.Command{
+		Use:       "export roles",
+		Short:     "Export a resource as CSV, NDJSON or XLSX",
+		Long:      `Export the roles matching the same filters, search and sort as the list endpoint, streamed from the database to a file or stdout`,
+		ValidArgs: []string{"roles"},
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			format, _ := cmd.Flags().GetString("format")
+			output, _ := cmd.Flags().GetString("output")
+			sort, _ := cmd.Flags().GetString("sort")
+			filters, _ := cmd.Flags().GetStringArray("filter")
+			q, _ := cmd.Flags().GetString("q")
+			active, _ := cmd.Flags().GetString("active")
+			return exportRoles(format, output, sort, filters, q, active)
+		},
+	}
+)
+
+func exportRoles(format_name string, output string, sort string, filters []string, q string, active string) error {
+	format, err := export.Lookup(format_name)
+	if err != nil {
+		return err
+	}
+
+	// the filters are given like in the api, filter[name][ilike]=adm
+	params, err := url.ParseQuery(strings.Join(filters, "&"))
+	if err != nil {
+		return fmt.Errorf("error reading filters: %v", err)
+	}
+	for name, value := range map[string]string{"sort": sort, "q": q, "active": active} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+
+	configs.NewEnvFile("./configs")
+	db := database.ReturnSession()
+
+	// the rows are those the list endpoint answers to a request with the same parameters
+	request, err := http.NewRequest(http.MethodGet, "/?"+params.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("error reading filters: %v", err)
+	}
+	rows, err := controlers.RoleExportRows(echo.New().NewContext(request, nil), db)
+	if err != nil {
+		return fmt.Errorf("error exporting roles: %v", err)
+	}
+
+	var out io.Writer = os.Stdout
+	if output != "" && output != "-" {
+		file, err := os.Create(output)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("error creating %v: %v", output, err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := export.Stream[models.RoleGet](db, rows, format, out); err != nil {
+		return fmt.Errorf("error exporting roles: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	exportCmd.Flags().String("format", "csv", "csv, ndjson or xlsx")
+	exportCmd.Flags().String("output", "", "file to write, stdout when left out")
+	exportCmd.Flags().String("sort", "", "sort fields e.g. -name,id")
+	exportCmd.Flags().StringArray("filter", nil, "filter as in the api e.g. filter[name][ilike]=adm, can be repeated")
+	exportCmd.Flags().String("q", "", "words to search in name and description")
+	exportCmd.Flags().String("active", "", "true for the active roles, false for the deactivated ones")
+
+	goBlueCmd.AddCommand(exportCmd)
+
+}
@@ -0,0 +1,83 @@
+package manager
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/imports"
+	"semay.com/models"
+	"semay.com/models/controlers"
+)
+
+var (
+	importCmd = &cobra.Command{
+		Use:       "import roles",
+		Short:     "Import roles from a CSV or JSON file",
+		Long:      `Import roles from a CSV file with a name,description header or a JSON array, every row is validated and checked for duplicates first`,
+		ValidArgs: []string{"roles"},
+		Args:      cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			file, _ := cmd.Flags().GetString("file")
+			mode, _ := cmd.Flags().GetString("mode")
+			dry_run, _ := cmd.Flags().GetBool("dry-run")
+			return importRoles(file, mode, dry_run)
+		},
+	}
+)
+
+func importRoles(path string, mode string, dry_run bool) error {
+	if mode != models.ImportAtomic && mode != models.ImportBestEffort {
+		return fmt.Errorf("mode must be atomic or best_effort")
+	}
+	format, err := imports.FormatOf("", path)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("error opening %v: %v", path, err)
+	}
+	defer file.Close()
+
+	configs.NewEnvFile("./configs")
+	rows, err := imports.Read[models.RolePost](format, file, controlers.ImportMaxRows())
+	if err != nil {
+		return err
+	}
+
+	// the problems of the rows are written in the fallback language of the catalogue
+	db := database.ReturnSession()
+	report, err := controlers.ImportRoleRows(db, rows, mode, dry_run, nil)
+	if err != nil {
+		return fmt.Errorf("error importing roles: %v", err)
+	}
+
+	for _, row := range report.Rows {
+		fmt.Printf("line %d\t%v\t%v\n", row.Line, row.Status, row.Name)
+		for _, problem := range row.Errors {
+			fmt.Printf("\t%v\n", problem)
+		}
+	}
+	if dry_run {
+		fmt.Printf("Dry run, %d of %d roles are valid, nothing was created.\n", report.Total-report.Failed, report.Total)
+		return nil
+	}
+	fmt.Printf("%d of %d roles imported, %d rejected.\n", report.Created, report.Total, report.Failed)
+	if report.Failed > 0 && mode == models.ImportAtomic {
+		return fmt.Errorf("import rejected, nothing was created")
+	}
+	return nil
+}
+
+func init() {
+	importCmd.Flags().String("file", "", "CSV or JSON file to import")
+	importCmd.Flags().String("mode", models.ImportAtomic, "atomic creates every row or none, best_effort creates the valid rows")
+	importCmd.Flags().Bool("dry-run", false, "validate and report without creating anything")
+
+	goBlueCmd.AddCommand(importCmd)
+
+}
@@ -0,0 +1,36 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"semay.com/configs"
+	"semay.com/models"
+)
+
+var (
+	migrateCmd = &cobra.Command{
+		Use:   "migrate",
+		Short: "Create or update database tables",
+		Long:  `Create or update database tables for all registered models`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return migrate()
+		},
+	}
+)
+
+func migrate() error {
+	configs.NewEnvFile("./configs")
+
+	if err := models.InitDatabase(); err != nil {
+		return fmt.Errorf("error migrating database: %v", err)
+	}
+
+	fmt.Println("Migration completed successfully.")
+	return nil
+}
+
+func init() {
+	goBlueCmd.AddCommand(migrateCmd)
+
+}
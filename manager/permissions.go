@@ -0,0 +1,133 @@
+package manager
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/models"
+)
+
+var (
+	permissionsCmd = &cobra.Command{
+		Use:   "permissions",
+		Short: "Sync the permission catalogue from the registered routes",
+		Long:  `Create or update one permission per named admin route, the route name being the permission name`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			prune, _ := cmd.Flags().GetBool("prune")
+			grant_role, _ := cmd.Flags().GetString("grant-role")
+			return syncPermissions(prune, grant_role)
+		},
+	}
+)
+
+// permissionRoutes returns the routes guarded by the Authorize middleware
+func permissionRoutes(app *echo.Echo) []*echo.Route {
+	routes := make([]*echo.Route, 0)
+	for _, route := range app.Routes() {
+		if route.Method == echo.RouteNotFound || !strings.HasPrefix(route.Path, "/admin/") {
+			continue
+		}
+		routes = append(routes, route)
+	}
+	return routes
+}
+
+func syncPermissions(prune bool, grant_role string) error {
+	configs.NewEnvFile("./configs")
+	db := database.ReturnSession()
+
+	app := echo.New()
+	SetupRoutes(app)
+
+	synced, pruned, err := SyncPermissions(db, app, prune, grant_role)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Synced %v permissions.\n", synced)
+	if prune {
+		fmt.Printf("Deactivated %v stale permissions.\n", pruned)
+	}
+	if grant_role != "" {
+		fmt.Printf("Granted all permissions to role %v.\n", grant_role)
+	}
+	return nil
+}
+
+// SyncPermissions creates or reactivates one permission per admin route of app, deactivates the
+// permissions of routes that no longer exist when prune is set and grants every active permission
+// to grant_role when it is not empty. It returns how many permissions were synced and pruned.
+func SyncPermissions(db *gorm.DB, app *echo.Echo, prune bool, grant_role string) (int, int64, error) {
+	names, err := upsertPermissions(db, permissionRoutes(app))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// deactivating permissions of routes that no longer exist
+	var pruned int64
+	if prune {
+		res := db.Model(&models.Permission{}).Where("name NOT IN ?", names).Update("active", false)
+		if res.Error != nil {
+			return len(names), 0, fmt.Errorf("error pruning permissions: %v", res.Error)
+		}
+		pruned = res.RowsAffected
+	}
+
+	if grant_role != "" {
+		if err := grantAllPermissions(db, grant_role); err != nil {
+			return len(names), pruned, err
+		}
+	}
+	return len(names), pruned, nil
+}
+
+// upsertPermissions creates or reactivates one permission per route
+func upsertPermissions(db *gorm.DB, routes []*echo.Route) ([]string, error) {
+	names := make([]string, 0, len(routes))
+	for _, route := range routes {
+		permission := models.Permission{
+			Name:        route.Name,
+			Description: route.Method + " " + route.Path,
+			Active:      true,
+		}
+		err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "name"}},
+			DoUpdates: clause.AssignmentColumns([]string{"description", "active"}),
+		}).Create(&permission).Error
+		if err != nil {
+			return nil, fmt.Errorf("error syncing permission %v: %v", route.Name, err)
+		}
+		names = append(names, route.Name)
+	}
+	return names, nil
+}
+
+// grantAllPermissions attaches every active permission to the named role
+func grantAllPermissions(db *gorm.DB, role_name string) error {
+	var role models.Role
+	if err := db.Where("name = ?", role_name).First(&role).Error; err != nil {
+		return fmt.Errorf("error retrieving role %v: %v", role_name, err)
+	}
+
+	var permissions []models.Permission
+	if err := db.Where("active = ?", true).Find(&permissions).Error; err != nil {
+		return fmt.Errorf("error retrieving permissions: %v", err)
+	}
+
+	if err := db.Model(&role).Association("Permissions").Append(permissions); err != nil {
+		return fmt.Errorf("error granting permissions: %v", err)
+	}
+	return nil
+}
+
+func init() {
+	permissionsCmd.Flags().Bool("prune", false, "deactivate permissions whose route no longer exists")
+	permissionsCmd.Flags().String("grant-role", "", "grant every active permission to this role")
+	goBlueCmd.AddCommand(permissionsCmd)
+
+}
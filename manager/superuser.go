@@ -0,0 +1,73 @@
+package manager
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/spf13/cobra"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+var (
+	superuserCmd = &cobra.Command{
+		Use:   "superuser",
+		Short: "Create a user holding every permission",
+		Long:  `Create a user with the superuser role, syncing permissions and granting all of them to that role`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			email, _ := cmd.Flags().GetString("email")
+			password, _ := cmd.Flags().GetString("password")
+			return createSuperuser(email, password)
+		},
+	}
+)
+
+func createSuperuser(email string, password string) error {
+	if email == "" || password == "" {
+		return fmt.Errorf("email and password are required")
+	}
+
+	configs.NewEnvFile("./configs")
+	if err := utils.PasswordPolicyFromEnv().Validate(password, nil); err != nil {
+		return err
+	}
+	db := database.ReturnSession()
+
+	// making sure the catalogue is current before granting it
+	app := echo.New()
+	SetupRoutes(app)
+	if _, err := upsertPermissions(db, permissionRoutes(app)); err != nil {
+		return err
+	}
+
+	role := models.Role{Name: "superuser", Description: "Holds every permission"}
+	if err := db.Where("name = ?", role.Name).FirstOrCreate(&role).Error; err != nil {
+		return fmt.Errorf("error creating superuser role: %v", err)
+	}
+	if err := grantAllPermissions(db, role.Name); err != nil {
+		return err
+	}
+
+	user := models.User{
+		Email:    email,
+		Password: utils.HashFunc(password),
+		UUID:     uuid.New().String(),
+		Roles:    []models.Role{role},
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return fmt.Errorf("error creating user: %v", err)
+	}
+
+	fmt.Printf("Superuser %v created.\n", email)
+	return nil
+}
+
+func init() {
+	superuserCmd.Flags().String("email", "", "email of the superuser")
+	superuserCmd.Flags().String("password", "", "password of the superuser")
+	goBlueCmd.AddCommand(superuserCmd)
+
+}
@@ -0,0 +1,223 @@
+package middlewares
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+// context keys the authenticated caller is stored under
+const (
+	UserClaimKey = "user_claim"
+	APIKeyKey    = "api_key"
+)
+
+// header machine clients send their API key in
+const HeaderAPIKey = "X-APP-TOKEN"
+
+// GetUserClaim returns the claims set by Authenticate for a JWT authenticated request
+func GetUserClaim(contx echo.Context) (utils.UserClaim, bool) {
+	claim, ok := contx.Get(UserClaimKey).(utils.UserClaim)
+	return claim, ok
+}
+
+// GetAPIKey returns the key set by Authenticate for an API key authenticated request
+func GetAPIKey(contx echo.Context) (models.APIKey, bool) {
+	api_key, ok := contx.Get(APIKeyKey).(models.APIKey)
+	return api_key, ok
+}
+
+// Actor names the authenticated caller in audit records, the email of a user or api_key:<prefix>
+func Actor(contx echo.Context) string {
+	if claim, ok := GetUserClaim(contx); ok {
+		return claim.Email
+	}
+	if api_key, ok := GetAPIKey(contx); ok {
+		return "api_key:" + api_key.Prefix
+	}
+	return ""
+}
+
+// Authenticate accepts either an API key in the X-APP-TOKEN header or a bearer JWT
+// and stores the authenticated caller on the context
+func Authenticate() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(contx echo.Context) error {
+			if key := contx.Request().Header.Get(HeaderAPIKey); key != "" {
+				api_key, err := lookupAPIKey(key)
+				if err != nil {
+					return common.Fail(contx, common.Unauthorized("auth.invalid_api_key"))
+				}
+
+				contx.Set(APIKeyKey, api_key)
+				return next(contx)
+			}
+
+			header := contx.Request().Header.Get(echo.HeaderAuthorization)
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found || token == "" {
+				return common.Fail(contx, common.Unauthorized("auth.missing_token"))
+			}
+
+			claim, err := utils.ParseJWTToken(token)
+			if err != nil {
+				return common.Fail(contx, common.Unauthorized("auth.invalid_token"))
+			}
+
+			contx.Set(UserClaimKey, claim)
+			contx.Set(common.LocaleKey, claim.Locale)
+			return next(contx)
+		}
+	}
+}
+
+// AuthenticateMFA accepts a bearer access token or an MFA pending token,
+// it guards the endpoints completing or enrolling the second factor
+func AuthenticateMFA() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(contx echo.Context) error {
+			header := contx.Request().Header.Get(echo.HeaderAuthorization)
+			token, found := strings.CutPrefix(header, "Bearer ")
+			if !found || token == "" {
+				return common.Fail(contx, common.Unauthorized("auth.missing_token"))
+			}
+
+			claim, err := utils.ParseJWTToken(token)
+			if err != nil {
+				claim, err = utils.ParseMFAPendingToken(token)
+			}
+			if err != nil {
+				return common.Fail(contx, common.Unauthorized("auth.invalid_token"))
+			}
+
+			contx.Set(UserClaimKey, claim)
+			return next(contx)
+		}
+	}
+}
+
+// lookupAPIKey finds the key by its visible prefix and checks hash, revocation and expiry
+func lookupAPIKey(key string) (models.APIKey, error) {
+	var api_key models.APIKey
+
+	prefix, ok := utils.APIKeyPrefix(key)
+	if !ok {
+		return api_key, errors.New("malformed api key")
+	}
+
+	db := database.ReturnSession()
+	if err := db.Where("prefix = ?", prefix).First(&api_key).Error; err != nil {
+		return api_key, err
+	}
+
+	now := time.Now().UTC()
+	if !utils.APIKeyMatches(api_key.Hash, key) {
+		return api_key, errors.New("api key mismatch")
+	}
+	if api_key.RevokedAt != nil {
+		return api_key, errors.New("api key revoked")
+	}
+	if api_key.ExpiresAt != nil && api_key.ExpiresAt.Before(now) {
+		return api_key, errors.New("api key expired")
+	}
+
+	// last use is tracked with a minute resolution to spare a write per request
+	if api_key.LastUsedAt == nil || now.Sub(*api_key.LastUsedAt) > time.Minute {
+		db.Model(&api_key).UpdateColumn("last_used_at", now)
+	}
+	return api_key, nil
+}
+
+// Authorize checks the caller's effective permissions against the name of the route being hit.
+// Route names are the permission names, see the permissions command for syncing them.
+func Authorize() echo.MiddlewareFunc {
+	var (
+		once        sync.Once
+		route_names map[string]string
+	)
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(contx echo.Context) error {
+			// routes are all registered by the time the first request comes in
+			once.Do(func() {
+				route_names = RouteNames(contx.Echo())
+			})
+
+			permission, ok := route_names[contx.Request().Method+" "+contx.Path()]
+			if !ok {
+				return common.Fail(contx, common.Forbidden("auth.route_without_permission"))
+			}
+
+			permissions, err := CallerPermissions(contx)
+			if err != nil {
+				return common.Fail(contx, common.Internal("auth.permission_check_failed", err))
+			}
+
+			if !utils.ValueInSlice(permissions, permission) {
+				return common.Fail(contx, common.Forbidden("auth.missing_permission").With(i18n.Params{"permission": permission}))
+			}
+			return next(contx)
+		}
+	}
+}
+
+// CallerPermissions returns the scopes of an API key or the permissions of the JWT roles.
+// Scopes only count while their permission is active, like the permissions of roles.
+func CallerPermissions(contx echo.Context) ([]string, error) {
+	if api_key, ok := GetAPIKey(contx); ok {
+		scopes := make([]string, 0)
+		err := database.ReturnSession().Model(&models.Permission{}).
+			Where("name IN ? AND active = ?", strings.Split(api_key.Scopes, ","), true).
+			Pluck("name", &scopes).Error
+		return scopes, err
+	}
+	if claim, ok := GetUserClaim(contx); ok {
+		return EffectivePermissions(claim.Roles)
+	}
+	return []string{}, nil
+}
+
+// RouteNames maps "METHOD path" of every named route to its name
+func RouteNames(app *echo.Echo) map[string]string {
+	names := make(map[string]string)
+	for _, route := range app.Routes() {
+		names[route.Method+" "+route.Path] = route.Name
+	}
+	return names
+}
+
+// EffectivePermissions returns the names of the active permissions granted to the given roles
+// and to the roles they contain. Deactivated roles grant nothing, even to tokens issued while
+// they were active, and pass on none of their children.
+func EffectivePermissions(roles []string) ([]string, error) {
+	permissions := make([]string, 0)
+	if len(roles) == 0 {
+		return permissions, nil
+	}
+
+	db := database.ReturnSession()
+	held, err := models.EffectiveRoles(db, roles)
+	if err != nil || len(held) == 0 {
+		return permissions, err
+	}
+	ids := make([]uint, 0, len(held))
+	for _, role := range held {
+		ids = append(ids, role.ID)
+	}
+
+	err = db.Table("permissions").
+		Distinct("permissions.name").
+		Joins("JOIN role_permissions ON role_permissions.permission_id = permissions.id").
+		Where("role_permissions.role_id IN ? AND permissions.active = ?", ids, true).
+		Pluck("permissions.name", &permissions).Error
+
+	return permissions, err
+}
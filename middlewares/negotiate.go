@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"semay.com/common"
+	"semay.com/i18n"
+	"semay.com/patch"
+)
+
+// form bodies are read by the default binder and patch documents by the update handlers besides the codecs
+var bodyTypes = []string{echo.MIMEMultipartForm, echo.MIMEApplicationForm, patch.MIMEMergePatch, patch.MIMEJSONPatch}
+
+// Negotiate answers 406 to requests accepting none of the response codecs and 415 to
+// bodies of a type nothing reads, before any handler runs. Routes sending or taking
+// files in other formats are left to their handlers through skipper.
+func Negotiate(skipper middleware.Skipper) echo.MiddlewareFunc {
+	if skipper == nil {
+		skipper = middleware.DefaultSkipper
+	}
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(contx echo.Context) error {
+			if skipper(contx) {
+				return next(contx)
+			}
+
+			request := contx.Request()
+			if _, ok := common.Negotiate(request.Header.Get(echo.HeaderAccept)); !ok {
+				return common.Fail(contx, common.NewError(http.StatusNotAcceptable, "", "error.not_acceptable").With(i18n.Params{"types": mediaTypes()}))
+			}
+
+			if request.ContentLength != 0 && !readable(request.Header.Get(echo.HeaderContentType)) {
+				return common.Fail(contx, common.NewError(http.StatusUnsupportedMediaType, "", "error.unsupported_body").With(i18n.Params{"types": mediaTypes()}))
+			}
+			return next(contx)
+		}
+	}
+}
+
+// readable tells whether a body of the content type can be bound
+func readable(content_type string) bool {
+	if _, ok := common.CodecFor(content_type); ok {
+		return true
+	}
+	media_type, _, _ := mime.ParseMediaType(content_type)
+	for _, body_type := range bodyTypes {
+		if media_type == body_type {
+			return true
+		}
+	}
+	return false
+}
+
+func mediaTypes() string {
+	types := make([]string, 0, len(common.Codecs))
+	for _, codec := range common.Codecs {
+		types = append(types, codec.MediaType)
+	}
+	return strings.Join(types, ", ")
+}
@@ -0,0 +1,107 @@
+package models
+
+import "time"
+
+// APIKey Database model info
+// @Description API key for machine clients, only the hash of the key is stored
+type APIKey struct {
+	ID         uint       `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty" filter:"eq,in,gt,gte,lt,lte"`
+	Name       string     `gorm:"not null;" json:"name,omitempty" filter:"eq,ne,in,like,ilike"`
+	Prefix     string     `gorm:"not null; unique;" json:"prefix,omitempty" filter:"eq,in"`
+	Hash       string     `gorm:"not null;" json:"-"`
+	Scopes     string     `gorm:"not null;" json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at" filter:"gt,gte,lt,lte,null"`
+	LastUsedAt *time.Time `json:"last_used_at" filter:"gt,gte,lt,lte,null"`
+	RevokedAt  *time.Time `json:"revoked_at" filter:"null"`
+	CreatedAt  time.Time  `json:"created_at" filter:"gt,gte,lt,lte"`
+}
+
+// APIKeyPost model info
+// @Description APIKeyPost type information
+type APIKeyPost struct {
+	Name      string   `json:"name,omitempty" validate:"required"`
+	Scopes    []string `json:"scopes,omitempty" validate:"required,min=1"`
+	ExpiresIn int      `json:"expires_in,omitempty" validate:"gte=0"`
+}
+
+// APIKeyGet model info
+// @Description APIKeyGet type information
+type APIKeyGet struct {
+	ID         uint       `json:"id,omitempty"`
+	Name       string     `json:"name,omitempty"`
+	Prefix     string     `json:"prefix,omitempty"`
+	Scopes     string     `json:"scopes"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// APIKeyIssued model info
+// @Description APIKeyIssued carries the plain key, it is only returned once
+type APIKeyIssued struct {
+	APIKeyGet
+	Key string `json:"key"`
+}
+
+// RevokedToken Database model info
+// @Description RevokedToken keeps the jti of a logged out access token until it expires
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null; index;" json:"expires_at"`
+}
+
+// RecoveryCode Database model info
+// @Description RecoveryCode is a hashed single-use MFA fallback code of a user
+type RecoveryCode struct {
+	ID     uint       `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
+	UserID uint       `gorm:"not null; index;" json:"user_id"`
+	Hash   string     `gorm:"not null;" json:"-"`
+	UsedAt *time.Time `json:"used_at"`
+}
+
+// MFAChallenge model info
+// @Description MFAChallenge is returned by login when the second factor is still due
+type MFAChallenge struct {
+	MFAToken           string `json:"mfa_token"`
+	TokenType          string `json:"token_type"`
+	ExpiresIn          int    `json:"expires_in"`
+	EnrollmentRequired bool   `json:"enrollment_required"`
+}
+
+// MFAVerify model info
+// @Description MFAVerify type information, either code or recovery_code is required
+type MFAVerify struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code,omitempty" validate:"required_without=RecoveryCode"`
+	RecoveryCode string `json:"recovery_code,omitempty" validate:"required_without=Code"`
+}
+
+// MFAEnrollment model info
+// @Description MFAEnrollment carries the secret to add to an authenticator app
+type MFAEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// MFAConfirm model info
+// @Description MFAConfirm type information
+type MFAConfirm struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+// MFAConfirmed model info
+// @Description MFAConfirmed carries the recovery codes, they are only returned once
+type MFAConfirmed struct {
+	RecoveryCodes []string   `json:"recovery_codes"`
+	Token         *AuthToken `json:"token,omitempty"`
+}
+
+// PasswordHistory Database model info
+// @Description PasswordHistory keeps the hashes of passwords a user had so they are not reused
+type PasswordHistory struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
+	UserID    uint      `gorm:"not null; index;" json:"user_id"`
+	Hash      string    `gorm:"not null;" json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
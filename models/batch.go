@@ -0,0 +1,49 @@
+package models
+
+import (
+	"encoding/json"
+
+	"semay.com/common"
+)
+
+// batch operation kinds
+const (
+	BatchCreate = "create"
+	BatchPatch  = "patch"
+	BatchDelete = "delete"
+)
+
+// BatchRequest model info
+// @Description BatchRequest lists operations run in order, in one transaction when atomic
+type BatchRequest struct {
+	Atomic     bool             `json:"atomic"`
+	Operations []BatchOperation `json:"operations" validate:"required,min=1,dive"`
+}
+
+// BatchOperation model info
+// @Description BatchOperation creates, patches or deletes one item, data is the body the single item endpoint takes
+type BatchOperation struct {
+	Op   string          `json:"op" validate:"required,oneof=create patch delete"`
+	ID   uint            `json:"id,omitempty" validate:"required_unless=Op create"`
+	Data json.RawMessage `json:"data,omitempty" swaggertype:"object"`
+}
+
+// BatchResult model info
+// @Description BatchResult is the response one operation would get from the single item endpoint, with its status code
+type BatchResult struct {
+	Status int `json:"status"`
+	common.ResponseHTTP
+}
+
+// BatchResults are the results of the operations of a batch, in their order
+type BatchResults []BatchResult
+
+// Localize writes the message of every result in the language of the request
+func (results BatchResults) Localize(translate common.Translate) interface{} {
+	localized := make(BatchResults, len(results))
+	for i, result := range results {
+		localized[i] = result
+		localized[i].ResponseHTTP = result.ResponseHTTP.Localize(translate).(common.ResponseHTTP)
+	}
+	return localized
+}
@@ -0,0 +1,216 @@
+package controlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+// ErrUnknownScope is returned when an API key asks for a permission that does not exist
+var ErrUnknownScope = errors.New("unknown scope")
+
+// IssueAPIKey validates the scopes against the permission catalogue and stores a new key.
+// The returned plain key is not recoverable afterwards.
+func IssueAPIKey(db *gorm.DB, posted_key models.APIKeyPost) (models.APIKeyIssued, error) {
+	scopes := utils.UniqueSlice(posted_key.Scopes)
+
+	// every scope has to be a known permission
+	var known []string
+	if err := db.Model(&models.Permission{}).Where("name IN ? AND active = ?", scopes, true).Pluck("name", &known).Error; err != nil {
+		return models.APIKeyIssued{}, err
+	}
+	for _, scope := range scopes {
+		if !utils.ValueInSlice(known, scope) {
+			return models.APIKeyIssued{}, fmt.Errorf("%w: %v", ErrUnknownScope, scope)
+		}
+	}
+
+	key, prefix, err := utils.GenerateAPIKey()
+	if err != nil {
+		return models.APIKeyIssued{}, err
+	}
+
+	api_key := models.APIKey{
+		Name:   posted_key.Name,
+		Prefix: prefix,
+		Hash:   utils.HashAPIKey(key),
+		Scopes: strings.Join(scopes, ","),
+	}
+	if posted_key.ExpiresIn > 0 {
+		expires_at := time.Now().UTC().Add(time.Duration(posted_key.ExpiresIn) * 24 * time.Hour)
+		api_key.ExpiresAt = &expires_at
+	}
+	if err := db.Create(&api_key).Error; err != nil {
+		return models.APIKeyIssued{}, err
+	}
+
+	return models.APIKeyIssued{APIKeyGet: apiKeyGet(api_key), Key: key}, nil
+}
+
+// apiKeyGet copies the displayable fields, mapstructure would drop the time.Time values
+func apiKeyGet(api_key models.APIKey) models.APIKeyGet {
+	return models.APIKeyGet{
+		ID:         api_key.ID,
+		Name:       api_key.Name,
+		Prefix:     api_key.Prefix,
+		Scopes:     api_key.Scopes,
+		ExpiresAt:  api_key.ExpiresAt,
+		LastUsedAt: api_key.LastUsedAt,
+		RevokedAt:  api_key.RevokedAt,
+		CreatedAt:  api_key.CreatedAt,
+	}
+}
+
+// RevokeAPIKey marks the key as revoked, it is rejected from the next request on
+func RevokeAPIKey(db *gorm.DB, api_key *models.APIKey) error {
+	if api_key.RevokedAt != nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	api_key.RevokedAt = &now
+	return db.Model(api_key).UpdateColumn("revoked_at", now).Error
+}
+
+// GetAPIKeys is a function to get API keys
+// @Summary Get API keys
+// @Description Get API keys
+// @Tags APIKey
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "page"
+// @Param size query int false "page size"
+// @Param cursor query string false "cursor of the keyset mode"
+// @Param limit query int false "page size of the keyset mode"
+// @Param sort query string false "sort fields e.g. -name,id, - prefix for descending"
+// @Param filter query string false "filters as filter[field][operator]=value, e.g. filter[name][ilike]=adm"
+// @Param fields query string false "fields to return e.g. id,name, all of them when left out"
+// @Success 200 {object} common.ResponsePagination{data=[]APIKeyGet}
+// @Failure 400 {object} common.Problem
+// @Router /apikey [get]
+func GetAPIKeys(contx echo.Context) error {
+
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//  querying result with pagination using gorm function
+	result, err := listPage[models.APIKeyGet](contx, db.Model(&models.APIKey{}), apiKeyList)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return common.Fail(contx, err)
+		}
+		return common.Fail(contx, common.Internal("api_key.list_failed", err))
+	}
+
+	// returning result if all the above completed successfully
+	return common.Respond(contx, http.StatusOK, result)
+}
+
+// PostAPIKey issues a new API key, limited to scopes the caller holds
+// @Summary Issue a new API key
+// @Description Issue API key, the key itself is only part of this response. Every scope has to be a permission of the caller.
+// @Tags APIKey
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param apikey body APIKeyPost true "Issue API key"
+// @Success 200 {object} common.ResponseHTTP{data=APIKeyIssued}
+// @Failure 400 {object} common.Problem
+// @Failure 403 {object} common.Problem
+// @Failure 500 {object} common.Problem
+// @Router /apikey [post]
+func PostAPIKey(contx echo.Context) error {
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//first parse request data
+	posted_key := new(models.APIKeyPost)
+	if err := contx.Bind(&posted_key); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// then validate structure
+	if err := contx.Validate(posted_key); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	// a key can only carry what its issuer may do itself
+	held, err := middlewares.CallerPermissions(contx)
+	if err != nil {
+		return common.Fail(contx, common.Internal("auth.permission_check_failed", err))
+	}
+	for _, scope := range posted_key.Scopes {
+		if !utils.ValueInSlice(held, scope) {
+			return common.Fail(contx, common.Forbidden("api_key.scope_not_held").With(i18n.Params{"scope": scope}))
+		}
+	}
+
+	issued, err := IssueAPIKey(db, *posted_key)
+	if err != nil {
+		if errors.Is(err, ErrUnknownScope) {
+			unknown := common.BadRequest("api_key.unknown_scope")
+			unknown.Err = err
+			return common.Fail(contx, unknown)
+		}
+		return common.Fail(contx, common.Internal("api_key.create_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "api_key.created",
+		Data:    issued,
+	})
+}
+
+// DeleteAPIKey revokes an API key by ID
+// @Summary Revoke API key by ID
+// @Description Revoke API key by ID
+// @Tags APIKey
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "API key ID"
+// @Success 200 {object} common.ResponseHTTP{data=APIKeyGet}
+// @Failure 404 {object} common.Problem
+// @Router /apikey/{key_id} [delete]
+func DeleteAPIKey(contx echo.Context) error {
+
+	// validate path params
+	id, err := strconv.Atoi(contx.Param("key_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "key_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	var api_key models.APIKey
+	if err := db.Where("id = ?", id).First(&api_key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("api_key.not_found"))
+		}
+		return common.Fail(contx, common.Internal("api_key.retrieve_failed", err))
+	}
+
+	if err := RevokeAPIKey(db, &api_key); err != nil {
+		return common.Fail(contx, common.Internal("api_key.revoke_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "api_key.revoked",
+		Data:    apiKeyGet(api_key),
+	})
+}
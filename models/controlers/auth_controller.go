@@ -0,0 +1,270 @@
+package controlers
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+// Login verifies user credentials and issues an access token
+// @Summary Login
+// @Description Login with email and password
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param user body UserLogin true "Login"
+// @Success 200 {object} common.ResponseHTTP{data=AuthToken}
+// @Failure 400 {object} common.Problem
+// @Failure 401 {object} common.Problem
+// @Failure 423 {object} common.Problem
+// @Failure 429 {object} common.Problem
+// @Router /auth/login [post]
+func Login(contx echo.Context) error {
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//first parse request data
+	login := new(models.UserLogin)
+	if err := contx.Bind(&login); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// then validate structure
+	if err := contx.Validate(login); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	// clients failing from one address are slowed down whatever account they try
+	address := "ip:" + contx.RealIP()
+	if wait := addressThrottle().Wait(address); wait > 0 {
+		return loginDelayed(contx, http.StatusTooManyRequests, "auth.too_many_attempts", wait)
+	}
+
+	// fetching the user with only the active roles attached
+	var user models.User
+	if err := db.Preload("Roles", "active = ?", true).Where("email = ?", login.Email).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// unknown emails are delayed like accounts so the answers do not tell which exist
+			addressThrottle().Fail(address)
+			if wait := unknownAccountThrottle().Wait(login.Email); wait > 0 {
+				return loginDelayed(contx, http.StatusLocked, "auth.locked", wait)
+			}
+			unknownAccountThrottle().Fail(login.Email)
+			return common.Fail(contx, common.Unauthorized("auth.invalid_credentials"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	// the account waits out the delay of its previous failures, even with the right password
+	wait, err := claimLoginAttempt(db, user)
+	if err != nil {
+		return common.Fail(contx, common.Internal("user.update_failed", err))
+	}
+	if wait > 0 {
+		addressThrottle().Fail(address)
+		return loginDelayed(contx, http.StatusLocked, "auth.locked", wait)
+	}
+
+	// same response for unknown email and wrong password
+	if !user.Active || !utils.PasswordsMatch(user.Password, login.Password) {
+		addressThrottle().Fail(address)
+		return common.Fail(contx, common.Unauthorized("auth.invalid_credentials"))
+	}
+	addressThrottle().Reset(address)
+	if err := resetLoginFailures(db, user); err != nil {
+		return common.Fail(contx, common.Internal("user.update_failed", err))
+	}
+
+	// privileged or enrolled users still owe the second factor
+	required, err := mfaRequired(db, user)
+	if err != nil {
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
+	}
+	if required {
+		return mfaChallenge(contx, user)
+	}
+	return issueToken(contx, user)
+}
+
+var (
+	addressThrottleOnce sync.Once
+	loginThrottle       *utils.LoginThrottle
+	unknownThrottleOnce sync.Once
+	unknownThrottle     *utils.LoginThrottle
+)
+
+// addressThrottle returns the tracker of failed logins per client address
+func addressThrottle() *utils.LoginThrottle {
+	addressThrottleOnce.Do(func() {
+		// an address is shared by many users so it gets more attempts than an account
+		policy := utils.LockoutPolicyFromEnv()
+		policy.MaxAttempts = configs.AppConfig.GetIntOrDefault("LOGIN_IP_MAX_ATTEMPTS", 20)
+		policy.FreeAttempts = policy.MaxAttempts / 2
+		loginThrottle = utils.NewLoginThrottle(policy, policy.Lockout, time.Minute)
+	})
+	return loginThrottle
+}
+
+// unknownAccountThrottle returns the tracker of failed logins per email without an account,
+// it applies the policy of the accounts
+func unknownAccountThrottle() *utils.LoginThrottle {
+	unknownThrottleOnce.Do(func() {
+		policy := utils.LockoutPolicyFromEnv()
+		unknownThrottle = utils.NewLoginThrottle(policy, policy.Lockout, time.Minute)
+	})
+	return unknownThrottle
+}
+
+// accountLockedFor returns how long the user still has to wait after failed logins
+func accountLockedFor(user models.User) time.Duration {
+	if user.LockedUntil == nil {
+		return 0
+	}
+	if wait := time.Until(*user.LockedUntil); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// claimLoginAttempt counts an attempt of the user as failed and delays the next one, unless the
+// account is still waiting in which case the wait is returned. Checking and counting is a single
+// statement so concurrent guesses can not all pass the check, a success resets the count after.
+func claimLoginAttempt(db *gorm.DB, user models.User) (time.Duration, error) {
+	policy := utils.LockoutPolicyFromEnv()
+	now := time.Now().UTC()
+
+	// failures long after the last delay ran out start counting again
+	failures := gorm.Expr("CASE WHEN locked_until IS NOT NULL AND locked_until < ? THEN 1 ELSE failed_logins + 1 END", now.Add(-policy.Lockout))
+
+	// the delay of every count up to the lockout, the counts above wait as long as the last
+	last := policy.MaxAttempts
+	if last <= 0 {
+		last = policy.FreeAttempts + 32
+	}
+	cases := "CASE (?)"
+	vars := []interface{}{failures}
+	for count := 1; count < last; count++ {
+		cases += " WHEN ? THEN ?"
+		vars = append(vars, count, now.Add(policy.Delay(count)))
+	}
+	cases += " ELSE ? END"
+	vars = append(vars, now.Add(policy.Delay(last)))
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND (locked_until IS NULL OR locked_until <= ?)", user.ID, now).
+		UpdateColumns(map[string]interface{}{
+			"failed_logins": failures,
+			"locked_until":  gorm.Expr(cases, vars...),
+		})
+	if result.Error != nil || result.RowsAffected > 0 {
+		return 0, result.Error
+	}
+
+	// another attempt locked the account first
+	if err := db.Select("locked_until").First(&user, user.ID).Error; err != nil {
+		return 0, err
+	}
+	if wait := accountLockedFor(user); wait > 0 {
+		return wait, nil
+	}
+	return time.Second, nil
+}
+
+// resetLoginFailures forgets the failed logins and lockout of the user
+func resetLoginFailures(db *gorm.DB, user models.User) error {
+	return db.Model(&models.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error
+}
+
+// loginDelayed answers a login attempted before the imposed delay ran out
+func loginDelayed(contx echo.Context, status int, message string, wait time.Duration) error {
+	contx.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	return common.Fail(contx, common.NewError(status, "", message))
+}
+
+// newAuthToken creates the access token for the user and its loaded roles, deactivated roles are left out
+func newAuthToken(user models.User) (models.AuthToken, error) {
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		if role.Active {
+			roles = append(roles, role.Name)
+		}
+	}
+
+	// token life time in minutes
+	life_time := configMinutes("JWT_SALT_LIFE_TIME", 60)
+
+	token, err := utils.CreateJWTToken(user.Email, user.UUID, utils.UniqueSlice(roles), life_time, user.Locale)
+	if err != nil {
+		return models.AuthToken{}, err
+	}
+
+	return models.AuthToken{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   life_time * 60,
+	}, nil
+}
+
+// issueToken responds with the access token of the user
+func issueToken(contx echo.Context, user models.User) error {
+	token, err := newAuthToken(user)
+	if err != nil {
+		return common.Fail(contx, common.Internal("auth.token_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "auth.logged_in",
+		Data:    token,
+	})
+}
+
+// configMinutes reads a positive duration in minutes from config
+func configMinutes(key string, default_value int) int {
+	minutes := configs.AppConfig.GetIntOrDefault(key, default_value)
+	if minutes <= 0 {
+		return default_value
+	}
+	return minutes
+}
+
+// Logout revokes the access token the request was made with
+// @Summary Logout
+// @Description Revoke the current access token
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} common.ResponseHTTP{}
+// @Failure 401 {object} common.Problem
+// @Router /auth/logout [post]
+func Logout(contx echo.Context) error {
+	claim, ok := middlewares.GetUserClaim(contx)
+	if !ok {
+		return common.Fail(contx, common.Unauthorized("auth.access_token_only"))
+	}
+
+	if err := utils.RevokeJWTToken(claim); err != nil {
+		return common.Fail(contx, common.Internal("auth.revoke_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "auth.logged_out",
+		Data:    nil,
+	})
+}
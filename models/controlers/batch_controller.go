@@ -0,0 +1,275 @@
+package controlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/configs"
+	"semay.com/i18n"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/utils"
+	"semay.com/validation"
+)
+
+// BatchMaxOperations is the most operations one batch may hold
+func BatchMaxOperations() int {
+	return configs.AppConfig.GetIntOrDefault("BATCH_MAX_OPERATIONS", 100)
+}
+
+// batchContext is the context of one operation of a batch: the caller and languages of the batch
+// request, the row of the operation as path parameter, no query parameters and validation inside
+// the transaction of the operation
+type batchContext struct {
+	echo.Context
+	validator echo.Validator
+	id        string
+}
+
+func (b *batchContext) Param(name string) string {
+	if name == Roles.param() {
+		return b.id
+	}
+	return ""
+}
+
+func (b *batchContext) ParamNames() []string {
+	return []string{Roles.param()}
+}
+
+func (b *batchContext) ParamValues() []string {
+	return []string{b.id}
+}
+
+func (b *batchContext) QueryParam(name string) string {
+	return ""
+}
+
+func (b *batchContext) QueryParams() url.Values {
+	return url.Values{}
+}
+
+func (b *batchContext) Validate(value interface{}) error {
+	return b.validator.Validate(value)
+}
+
+// failedResult answers an operation failing with err like the single role endpoints would
+func failedResult(contx echo.Context, err error) models.BatchResult {
+	var domain *common.Error
+	if !errors.As(err, &domain) {
+		domain = common.Internal("error.internal", err)
+	}
+	var problems interface{}
+	if validation_errors, ok := domain.Errors.(validator.ValidationErrors); ok {
+		problems = validation.Errors(validation_errors, validation.Translator(common.Languages(contx)...))
+	}
+	result := batchResult(domain.Status, domain.Detail, problems)
+	result.Params = domain.Params
+	return result
+}
+
+func batchResult(status int, message string, data interface{}) models.BatchResult {
+	return models.BatchResult{
+		Status: status,
+		ResponseHTTP: common.ResponseHTTP{
+			Success: status < http.StatusBadRequest,
+			Message: message,
+			Data:    data,
+		},
+	}
+}
+
+// runRoleOperation runs one operation inside tx through the role endpoints, answering like they
+// would. The caller must hold the permission of the endpoint.
+func runRoleOperation(contx echo.Context, tx *gorm.DB, operation models.BatchOperation, permissions []string) models.BatchResult {
+	operation_contx := &batchContext{
+		Context:   contx,
+		validator: validation.New(func() *gorm.DB { return tx }),
+		id:        strconv.FormatUint(uint64(operation.ID), 10),
+	}
+
+	kind, ok := batchOperations[operation.Op]
+	if !ok {
+		result := batchResult(http.StatusBadRequest, "batch.unknown_operation", nil)
+		result.Params = i18n.Params{"op": operation.Op}
+		return result
+	}
+	if permission := Roles.RouteName(kind); !utils.ValueInSlice(permissions, permission) {
+		return failedResult(contx, common.Forbidden("auth.missing_permission").With(i18n.Params{"permission": permission}))
+	}
+
+	switch kind {
+	case OperationCreate:
+		posted_role := new(models.RolePost)
+		if err := json.Unmarshal(operation.Data, posted_role); err != nil {
+			return batchResult(http.StatusBadRequest, "batch.invalid_data", nil)
+		}
+		if err := operation_contx.Validate(posted_role); err != nil {
+			return failedResult(contx, common.Invalid(err))
+		}
+		role, err := Roles.create(operation_contx, tx, posted_role)
+		if err != nil {
+			return failedResult(contx, err)
+		}
+		return representedResult(contx, role, "role.created", "role.create_failed")
+
+	case OperationUpdate:
+		patch_role := new(models.RolePatch)
+		if err := json.Unmarshal(operation.Data, patch_role); err != nil {
+			return batchResult(http.StatusBadRequest, "batch.invalid_data", nil)
+		}
+		role, err := Roles.update(operation_contx, tx, echo.MIMEApplicationJSON, nil, patch_role)
+		if err != nil {
+			return failedResult(contx, err)
+		}
+		return representedResult(contx, role, "role.updated", "role.update_failed")
+	}
+
+	role, err := Roles.remove(operation_contx, tx)
+	if err != nil {
+		return failedResult(contx, err)
+	}
+	return batchResult(http.StatusOK, "role.deleted", role)
+}
+
+// batchOperations are the role endpoints each batch operation goes through
+var batchOperations = map[string]Operation{
+	models.BatchCreate: OperationCreate,
+	models.BatchPatch:  OperationUpdate,
+	models.BatchDelete: OperationDelete,
+}
+
+// representedResult answers the written role in the representation of the role endpoints
+func representedResult(contx echo.Context, role *models.Role, message string, failed string) models.BatchResult {
+	get, err := Roles.represent(role)
+	if err != nil {
+		return failedResult(contx, common.Internal(failed, err))
+	}
+	return batchResult(http.StatusOK, message, get)
+}
+
+// RunRoleBatch runs the operations in order for the caller of contx holding permissions. Atomic
+// batches run in one transaction that a failing operation rolls back, the operations before it are
+// reported rolled back and the ones after it not run. Otherwise every operation runs in a
+// transaction of its own. It reports whether every operation succeeded.
+func RunRoleBatch(contx echo.Context, db *gorm.DB, batch models.BatchRequest, permissions []string) (models.BatchResults, bool) {
+	results := make(models.BatchResults, 0, len(batch.Operations))
+
+	if !batch.Atomic {
+		succeeded := true
+		for _, operation := range batch.Operations {
+			tx := db.Begin()
+			result := runRoleOperation(contx, tx, operation, permissions)
+			if !result.Success {
+				tx.Rollback()
+			} else if err := tx.Commit().Error; err != nil {
+				result = batchResult(http.StatusInternalServerError, "batch.commit_failed", nil)
+			}
+			succeeded = succeeded && result.Success
+			results = append(results, result)
+		}
+		return results, succeeded
+	}
+
+	tx := db.Begin()
+	for i, operation := range batch.Operations {
+		result := runRoleOperation(contx, tx, operation, permissions)
+		if result.Success {
+			results = append(results, result)
+			continue
+		}
+
+		tx.Rollback()
+		for j := range results {
+			results[j] = batchResult(http.StatusFailedDependency, "batch.operation_rolled_back", nil)
+			results[j].Params = i18n.Params{"index": i}
+		}
+		results = append(results, result)
+		for range batch.Operations[i+1:] {
+			not_run := batchResult(http.StatusFailedDependency, "batch.operation_not_run", nil)
+			not_run.Params = i18n.Params{"index": i}
+			results = append(results, not_run)
+		}
+		return results, false
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		for j := range results {
+			results[j] = batchResult(http.StatusInternalServerError, "batch.commit_failed", nil)
+		}
+		return results, false
+	}
+	return results, true
+}
+
+// BatchRoles runs create, patch and delete operations on roles in one request
+// @Summary Batch Role operations
+// @Description Run create, patch and delete operations on roles in order, in one transaction when atomic.
+// @Description Every operation gets the status and response the single role endpoint would give, operations are counted from 0.
+// @Description Each operation needs the permission of its endpoint: post_role, patch_role or delete_role.
+// @Tags Role
+// @Security ApiKeyAuth
+// @Security Refresh
+// @Accept json
+// @Produce json
+// @Param batch body BatchRequest true "Operations"
+// @Success 200 {object} common.ResponseHTTP{data=[]BatchResult}
+// @Success 207 {object} common.ResponseHTTP{data=[]BatchResult}
+// @Failure 400 {object} common.Problem
+// @Failure 413 {object} common.Problem
+// @Failure 422 {object} common.ResponseHTTP{data=[]BatchResult}
+// @Router /role/batch [post]
+func BatchRoles(contx echo.Context) error {
+
+	//first parse request data
+	batch := new(models.BatchRequest)
+	if err := contx.Bind(batch); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	if max := BatchMaxOperations(); len(batch.Operations) > max {
+		return common.Fail(contx, common.NewError(http.StatusRequestEntityTooLarge, "", "batch.too_large").With(i18n.Params{"max": max}))
+	}
+
+	// then validate structure
+	if err := contx.Validate(batch); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	// every operation needs the permission of its single role endpoint
+	permissions, err := middlewares.CallerPermissions(contx)
+	if err != nil {
+		return common.Fail(contx, common.Internal("auth.permission_check_failed", err))
+	}
+
+	//  Getting Database connection of the role endpoints
+	db := Roles.session()
+	results, succeeded := RunRoleBatch(contx, db, *batch, permissions)
+
+	switch {
+	case succeeded:
+		return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+			Success: true,
+			Message: "batch.completed",
+			Data:    results,
+		})
+	case batch.Atomic:
+		return common.Respond(contx, http.StatusUnprocessableEntity, common.ResponseHTTP{
+			Success: false,
+			Message: "batch.rolled_back",
+			Data:    results,
+		})
+	}
+	return common.Respond(contx, http.StatusMultiStatus, common.ResponseHTTP{
+		Success: false,
+		Message: "batch.partial",
+		Data:    results,
+	})
+}
@@ -0,0 +1,629 @@
+package controlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/mitchellh/mapstructure"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/patch"
+	"semay.com/search"
+	"semay.com/validation"
+)
+
+// Operation is one of the endpoints a CRUD registers
+type Operation string
+
+const (
+	OperationList   Operation = "list"
+	OperationGet    Operation = "get"
+	OperationCreate Operation = "create"
+	OperationUpdate Operation = "update"
+	OperationDelete Operation = "delete"
+)
+
+// Hook runs inside the transaction of a write, an error rolls the write back and answers the request
+type Hook[Model any] func(contx echo.Context, tx *gorm.DB, model *Model) error
+
+// Filter narrows every query of a resource, rows left out of it are not found
+type Filter func(contx echo.Context, query *gorm.DB) *gorm.DB
+
+// BoolFilter narrows the rows to those whose column equals the ?<param>=true or false of the request.
+// Other values make the query fail with common.ErrInvalidQuery.
+func BoolFilter(param string, column string) Filter {
+	return func(contx echo.Context, query *gorm.DB) *gorm.DB {
+		raw := contx.QueryParam(param)
+		if raw == "" {
+			return query
+		}
+		value, err := strconv.ParseBool(raw)
+		if err != nil {
+			query.AddError(common.InvalidQuery(common.ErrInvalidQuery, "query.must_be_boolean", i18n.Params{"param": param}))
+			return query
+		}
+		return query.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: value})
+	}
+}
+
+// CRUD serves the list, get, create, patch and delete endpoints of a table.
+// Model is the table, Create and Patch the bodies of the writes and Get the fields returned.
+// Name is the singular of the resource, e.g. role, the rest is derived from it:
+//   - routes at /<name> and /<name>/:<name>_id
+//   - route and permission names get_all_<name>s, get_one_<name>s, post_<name>, patch_<name> and delete_<name>
+//   - message ids <name>.listed, <name>.not_found, <name>.created, ...
+type CRUD[Model any, Create any, Patch any, Get any] struct {
+	Name string
+	// DB opens the database of the resource, database.ReturnSession when nil
+	DB func() *gorm.DB
+
+	// sortable fields, query names to columns, the filter tags of Model say what can be filtered
+	Sortable map[string]string
+	// Filters narrow every query, e.g. to the rows of the caller
+	Filters []Filter
+	// associations loaded with the listed and the single rows
+	Preloads []string
+	// Search answers lists having a ?q=, nil when the resource is not searchable
+	Search func(contx echo.Context, query *gorm.DB) (interface{}, error)
+	// Middleware of each operation, run after those of the group
+	Middleware map[Operation][]echo.MiddlewareFunc
+
+	// BeforeCreate may complete the row built from the body before it is inserted
+	BeforeCreate func(contx echo.Context, tx *gorm.DB, create *Create, model *Model) error
+	AfterCreate  Hook[Model]
+	// BeforeUpdate sees the stored row and the validated patch before the patch is written
+	BeforeUpdate func(contx echo.Context, tx *gorm.DB, patch *Patch, model *Model) error
+	AfterUpdate  Hook[Model]
+	BeforeDelete Hook[Model]
+	AfterDelete  Hook[Model]
+}
+
+// Register adds the endpoints to group, each named after its permission
+func (c *CRUD[Model, Create, Patch, Get]) Register(group *echo.Group) {
+	path, one := "/"+c.Name, "/"+c.Name+"/:"+c.param()
+	group.GET(path, c.List, c.Middleware[OperationList]...).Name = c.RouteName(OperationList)
+	group.GET(one, c.Get, c.Middleware[OperationGet]...).Name = c.RouteName(OperationGet)
+	group.POST(path, c.Create, c.Middleware[OperationCreate]...).Name = c.RouteName(OperationCreate)
+	group.PATCH(one, c.Update, c.Middleware[OperationUpdate]...).Name = c.RouteName(OperationUpdate)
+	group.DELETE(one, c.Delete, c.Middleware[OperationDelete]...).Name = c.RouteName(OperationDelete)
+}
+
+// RouteName is the route and permission name of an operation
+func (c *CRUD[Model, Create, Patch, Get]) RouteName(operation Operation) string {
+	switch operation {
+	case OperationList:
+		return "get_all_" + c.Name + "s"
+	case OperationGet:
+		return "get_one_" + c.Name + "s"
+	case OperationCreate:
+		return "post_" + c.Name
+	case OperationUpdate:
+		return "patch_" + c.Name
+	}
+	return "delete_" + c.Name
+}
+
+// param is the path parameter of the row id
+func (c *CRUD[Model, Create, Patch, Get]) param() string {
+	return c.Name + "_id"
+}
+
+// message is the id of a message of the resource, e.g. role.created
+func (c *CRUD[Model, Create, Patch, Get]) message(name string) string {
+	return c.Name + "." + name
+}
+
+// session opens the database of a request
+func (c *CRUD[Model, Create, Patch, Get]) session() *gorm.DB {
+	if c.DB != nil {
+		return c.DB()
+	}
+	return database.ReturnSession()
+}
+
+// query is a query of the table narrowed by the filters
+func (c *CRUD[Model, Create, Patch, Get]) query(contx echo.Context, db *gorm.DB) *gorm.DB {
+	query := db.Model(new(Model))
+	for _, filter := range c.Filters {
+		query = filter(contx, query)
+	}
+	return query
+}
+
+// preload adds the associations read with the rows
+func (c *CRUD[Model, Create, Patch, Get]) preload(query *gorm.DB) *gorm.DB {
+	for _, association := range c.Preloads {
+		query = query.Preload(association)
+	}
+	return query
+}
+
+// represent shapes a row as the Get the list and get endpoints answer with
+func (c *CRUD[Model, Create, Patch, Get]) represent(model *Model) (Get, error) {
+	var get Get
+	err := mapstructure.Decode(model, &get)
+	return get, err
+}
+
+// id parses the row id of the path
+func (c *CRUD[Model, Create, Patch, Get]) id(contx echo.Context) (int, error) {
+	id, err := strconv.Atoi(contx.Param(c.param()))
+	if err != nil {
+		return 0, common.BadRequest("error.not_a_number").With(i18n.Params{"param": c.param()})
+	}
+	return id, nil
+}
+
+// find reads the row of the path inside tx
+func (c *CRUD[Model, Create, Patch, Get]) find(contx echo.Context, tx *gorm.DB) (*Model, error) {
+	id, err := c.id(contx)
+	if err != nil {
+		return nil, err
+	}
+	model := new(Model)
+	if err := c.query(contx, tx).Where("id = ?", id).First(model).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, common.NotFound(c.message("not_found"))
+		}
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return nil, err
+		}
+		return nil, common.Internal(c.message("retrieve_failed"), err)
+	}
+	return model, nil
+}
+
+// List answers a page of rows, see listPage for the parameters
+func (c *CRUD[Model, Create, Patch, Get]) List(contx echo.Context) error {
+
+	//  Getting Database connection
+	db := c.session()
+	query := c.preload(c.query(contx, db))
+
+	var result interface{}
+	var err error
+	if c.Search != nil && search.Terms(contx.QueryParam("q")) != nil {
+		result, err = c.Search(contx, query)
+	} else {
+		result, err = listPage[Model](contx, query, listOptions{
+			Sortable: c.Sortable,
+			DTO:      *new(Get),
+			Message:  c.message("listed"),
+		})
+	}
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return common.Fail(contx, err)
+		}
+		return common.Fail(contx, common.Internal(c.message("list_failed"), err))
+	}
+	return common.Respond(contx, http.StatusOK, result)
+}
+
+// Get answers the row of the path with the ?fields= asked for
+func (c *CRUD[Model, Create, Patch, Get]) Get(contx echo.Context) error {
+
+	id, err := c.id(contx)
+	if err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// only the asked fields are read and returned
+	fieldset, err := common.ParseFields(contx.QueryParam("fields"), *new(Get))
+	if err != nil {
+		return common.Fail(contx, err)
+	}
+
+	//  Getting Database connection
+	db := c.session()
+	query, err := fieldset.Select(c.query(contx, db))
+	if err != nil {
+		return common.Fail(contx, common.Internal(c.message("retrieve_failed"), err))
+	}
+
+	var model Model
+	if err := c.preload(query).Where("id = ?", id).First(&model).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound(c.message("not_found")))
+		}
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return common.Fail(contx, err)
+		}
+		return common.Fail(contx, common.Internal(c.message("retrieve_failed"), err))
+	}
+
+	// filtering response data according to the Get struct
+	get, err := c.represent(&model)
+	if err != nil {
+		return common.Fail(contx, common.Internal(c.message("retrieve_failed"), err))
+	}
+	data, err := fieldset.Shape(&get)
+	if err != nil {
+		return common.Fail(contx, common.Internal(c.message("retrieve_failed"), err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: c.message("retrieved"),
+		Data:    data,
+	})
+}
+
+// Create validates the body, builds the row from its fields of the same name and inserts it
+func (c *CRUD[Model, Create, Patch, Get]) Create(contx echo.Context) error {
+
+	//first parse request data, then validate structure
+	create := new(Create)
+	if err := contx.Bind(create); err != nil {
+		return common.Fail(contx, err)
+	}
+	if err := contx.Validate(create); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	//  start transaction to database
+	db := c.session()
+	tx := db.Begin()
+
+	model, err := c.create(contx, tx, create)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, err)
+	}
+
+	get, err := c.represent(model)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, common.Internal(c.message("create_failed"), err))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return common.Fail(contx, common.Internal(c.message("create_failed"), err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: c.message("created"),
+		Data:    get,
+	})
+}
+
+// create inserts the row built from the validated body inside tx, with the create hooks
+func (c *CRUD[Model, Create, Patch, Get]) create(contx echo.Context, tx *gorm.DB, create *Create) (*Model, error) {
+	model := new(Model)
+	if err := mapstructure.Decode(create, model); err != nil {
+		return nil, common.Internal(c.message("create_failed"), err)
+	}
+
+	if c.BeforeCreate != nil {
+		if err := c.BeforeCreate(contx, tx, create, model); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Create(model).Error; err != nil {
+		if common.IsDuplicate(err) {
+			return nil, common.Conflict(c.message("exists"))
+		}
+		return nil, common.Internal(c.message("create_failed"), err)
+	}
+
+	if c.AfterCreate != nil {
+		if err := c.AfterCreate(contx, tx, model); err != nil {
+			return nil, err
+		}
+	}
+	return model, nil
+}
+
+// Update changes the row of the path. Merge patches (RFC 7386) and JSON Patches (RFC 6902) are
+// applied to its Get representation, other bodies set their non zero fields. The changed row is
+// validated as a Patch, with the path parameters bound so unique rules leave the row out, and as
+// a Create apart from unique rules. Only the changed columns are written.
+func (c *CRUD[Model, Create, Patch, Get]) Update(contx echo.Context) error {
+
+	if _, err := c.id(contx); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// patch documents are read as they are, the fields of other bodies are bound
+	media_type, _, _ := mime.ParseMediaType(contx.Request().Header.Get(echo.HeaderContentType))
+	var document []byte
+	body := new(Patch)
+	if media_type == patch.MIMEMergePatch || media_type == patch.MIMEJSONPatch {
+		raw, err := io.ReadAll(contx.Request().Body)
+		if err != nil {
+			return common.Fail(contx, echo.NewHTTPError(http.StatusBadRequest, err.Error()).SetInternal(err))
+		}
+		document = raw
+	} else if err := contx.Bind(body); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// startng update transaction
+	db := c.session()
+	tx := db.Begin()
+
+	model, err := c.update(contx, tx, media_type, document, body)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, err)
+	}
+
+	get, err := c.represent(model)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, common.Internal(c.message("update_failed"), err))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return common.Fail(contx, common.Internal(c.message("update_failed"), err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: c.message("updated"),
+		Data:    get,
+	})
+}
+
+// update patches the row of the path inside tx with the update hooks, see Update
+func (c *CRUD[Model, Create, Patch, Get]) update(contx echo.Context, tx *gorm.DB, media_type string, document []byte, body *Patch) (*Model, error) {
+	model, err := c.find(contx, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	before, patched, err := c.patch(contx, model, media_type, document, body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the patched row must stay valid as a whole
+	if err := contx.Validate(patched); err != nil {
+		return nil, common.Invalid(err)
+	}
+	whole := new(Create)
+	if err := convert(patched, whole); err != nil {
+		return nil, common.Internal(c.message("update_failed"), err)
+	}
+	if err := validation.Without(contx.Validate(whole), "unique"); err != nil {
+		return nil, common.Invalid(err)
+	}
+
+	if c.BeforeUpdate != nil {
+		if err := c.BeforeUpdate(contx, tx, patched, model); err != nil {
+			return nil, err
+		}
+	}
+
+	columns, err := changedColumns(tx, model, before, patched)
+	if err != nil {
+		return nil, common.Internal(c.message("update_failed"), err)
+	}
+	if len(columns) > 0 {
+		if err := tx.Model(model).Updates(columns).Error; err != nil {
+			if common.IsDuplicate(err) {
+				return nil, common.Conflict(c.message("exists"))
+			}
+			return nil, common.Internal(c.message("update_failed"), err)
+		}
+		if model, err = c.find(contx, tx); err != nil {
+			return nil, err
+		}
+	}
+
+	if c.AfterUpdate != nil {
+		if err := c.AfterUpdate(contx, tx, model); err != nil {
+			return nil, err
+		}
+	}
+	return model, nil
+}
+
+// patch returns the Patch of the stored row and the one the request makes of it
+func (c *CRUD[Model, Create, Patch, Get]) patch(contx echo.Context, model *Model, media_type string, document []byte, body *Patch) (*Patch, *Patch, error) {
+
+	// the representation clients see is the one they patch
+	var get Get
+	if err := mapstructure.Decode(model, &get); err != nil {
+		return nil, nil, common.Internal(c.message("update_failed"), err)
+	}
+	representation, err := json.Marshal(get)
+	if err != nil {
+		return nil, nil, common.Internal(c.message("update_failed"), err)
+	}
+	before := new(Patch)
+	if err := json.Unmarshal(representation, before); err != nil {
+		return nil, nil, common.Internal(c.message("update_failed"), err)
+	}
+
+	patched := new(Patch)
+	switch media_type {
+	case patch.MIMEMergePatch, patch.MIMEJSONPatch:
+		apply := patch.Merge
+		if media_type == patch.MIMEJSONPatch {
+			apply = patch.Apply
+		}
+		changed, err := apply(representation, document)
+		if err != nil {
+			return nil, nil, patchProblem(err)
+		}
+		if err := readOnly(representation, changed, reflect.TypeOf(*patched)); err != nil {
+			return nil, nil, err
+		}
+		if err := json.Unmarshal(changed, patched); err != nil {
+			return nil, nil, common.NewError(http.StatusUnprocessableEntity, "", "patch.unprocessable").With(i18n.Params{"path": "", "reason": err.Error()})
+		}
+	default:
+		*patched = *before
+		overlay(reflect.ValueOf(patched).Elem(), reflect.ValueOf(body).Elem())
+	}
+
+	if err := (&echo.DefaultBinder{}).BindPathParams(contx, patched); err != nil {
+		return nil, nil, err
+	}
+	return before, patched, nil
+}
+
+// patchProblem answers a failed patch: 400 when it is malformed, 409 when a test fails
+// and 422 when it does not fit the row
+func patchProblem(err error) error {
+	var patch_error *patch.Error
+	if !errors.As(err, &patch_error) {
+		return err
+	}
+	params := i18n.Params{"path": patch_error.Path, "reason": patch_error.Reason}
+	switch {
+	case errors.Is(err, patch.ErrTestFailed):
+		return common.Conflict("patch.test_failed").With(params)
+	case errors.Is(err, patch.ErrUnprocessable):
+		return common.NewError(http.StatusUnprocessableEntity, "", "patch.unprocessable").With(params)
+	default:
+		return common.BadRequest("patch.invalid").With(params)
+	}
+}
+
+// readOnly refuses patched documents changing members that are no json field of the Patch kind
+func readOnly(representation []byte, changed []byte, kind reflect.Type) error {
+	var stored, changed_members map[string]interface{}
+	if err := json.Unmarshal(representation, &stored); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(changed, &changed_members); err != nil {
+		return common.NewError(http.StatusUnprocessableEntity, "", "patch.unprocessable").With(i18n.Params{"path": "", "reason": err.Error()})
+	}
+
+	writable := make(map[string]bool)
+	for i := 0; i < kind.NumField(); i++ {
+		name, _, _ := strings.Cut(kind.Field(i).Tag.Get("json"), ",")
+		if name != "-" && name != "" {
+			writable[name] = true
+		}
+	}
+	for _, members := range []map[string]interface{}{stored, changed_members} {
+		for name := range members {
+			if !writable[name] && !reflect.DeepEqual(stored[name], changed_members[name]) {
+				return common.NewError(http.StatusUnprocessableEntity, "", "patch.read_only").With(i18n.Params{"field": name})
+			}
+		}
+	}
+	return nil
+}
+
+// overlay sets the fields of target that are not zero in body
+func overlay(target reflect.Value, body reflect.Value) {
+	for i := 0; i < body.NumField(); i++ {
+		if !body.Field(i).IsZero() {
+			target.Field(i).Set(body.Field(i))
+		}
+	}
+}
+
+// convert copies value into target through its json form
+func convert(value interface{}, target interface{}) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// changedColumns maps the columns of model to the values of the Patch fields that differ between
+// before and patched. Nil pointers stand for fields left alone.
+func changedColumns(tx *gorm.DB, model interface{}, before interface{}, patched interface{}) (map[string]interface{}, error) {
+	statement := &gorm.Statement{DB: tx}
+	if err := statement.Parse(model); err != nil {
+		return nil, err
+	}
+
+	from, to := reflect.ValueOf(before).Elem(), reflect.ValueOf(patched).Elem()
+	columns := make(map[string]interface{})
+	for i := 0; i < to.NumField(); i++ {
+		field := to.Type().Field(i)
+		column := statement.Schema.LookUpField(field.Name)
+		if column == nil || column.DBName == "" || field.Tag.Get("gorm") == "-" {
+			continue
+		}
+		value := to.Field(i)
+		if value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		if !reflect.DeepEqual(reflect.Indirect(from.Field(i)).Interface(), value.Interface()) {
+			columns[column.DBName] = value.Interface()
+		}
+	}
+	return columns, nil
+}
+
+// Delete removes the row of the path and answers it
+func (c *CRUD[Model, Create, Patch, Get]) Delete(contx echo.Context) error {
+
+	if _, err := c.id(contx); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// perform delete operation if the object exists
+	db := c.session()
+	tx := db.Begin()
+
+	get, err := c.remove(contx, tx)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, err)
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return common.Fail(contx, common.Internal(c.message("delete_failed"), err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: c.message("deleted"),
+		Data:    get,
+	})
+}
+
+// remove deletes the row of the path inside tx with the delete hooks and returns what it was
+func (c *CRUD[Model, Create, Patch, Get]) remove(contx echo.Context, tx *gorm.DB) (Get, error) {
+	var get Get
+	model, err := c.find(contx, tx)
+	if err != nil {
+		return get, err
+	}
+
+	if c.BeforeDelete != nil {
+		if err := c.BeforeDelete(contx, tx, model); err != nil {
+			return get, err
+		}
+	}
+
+	// the answer is shaped before the row and its associations are gone
+	if get, err = c.represent(model); err != nil {
+		return get, common.Internal(c.message("delete_failed"), err)
+	}
+
+	if err := tx.Delete(model).Error; err != nil {
+		return get, common.Internal(c.message("delete_failed"), err)
+	}
+
+	if c.AfterDelete != nil {
+		if err := c.AfterDelete(contx, tx, model); err != nil {
+			return get, err
+		}
+	}
+	return get, nil
+}
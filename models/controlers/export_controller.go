@@ -0,0 +1,85 @@
+package controlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/export"
+	"semay.com/models"
+	"semay.com/search"
+)
+
+// RoleExportRows opens a cursor over the roles the list endpoint answers to the query of contx:
+// narrowed by the filters of Roles, the filter[field][op]= parameters and ?q=, ordered by ?sort=
+// or by relevance when searching
+func RoleExportRows(contx echo.Context, db *gorm.DB) (*sql.Rows, error) {
+	query, sort, err := listQuery(Roles.query(contx, db), contx.QueryParams(), roleList)
+	if err != nil {
+		return nil, err
+	}
+	if q := contx.QueryParam("q"); search.Terms(q) != nil {
+		query = models.RoleSearch.Apply(query, q)
+		if len(sort) == 0 {
+			query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "search_rank"}, Desc: true})
+		}
+	}
+	return common.Sorted(query, sort).Rows()
+}
+
+// ExportRoles streams every role matching the filters as a file
+// @Summary Export Roles
+// @Description Export the roles matching the list filters and sort as a CSV, NDJSON or XLSX download
+// @Tags Role
+// @Produce text/csv
+// @Produce application/x-ndjson
+// @Produce application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Security ApiKeyAuth
+// @Security Refresh
+// @Param format query string false "csv (default), ndjson or xlsx"
+// @Param sort query string false "sort fields e.g. -name,id, - prefix for descending"
+// @Param filter query string false "filters as filter[field][operator]=value, e.g. filter[name][ilike]=adm"
+// @Param q query string false "words to search in name and description"
+// @Param active query bool false "true for the active roles, false for the deactivated ones"
+// @Success 200 {file} file
+// @Failure 400 {object} common.Problem
+// @Router /role/export [get]
+func ExportRoles(contx echo.Context) error {
+
+	format, err := export.Lookup(contx.QueryParam("format"))
+	if err != nil {
+		unknown := common.BadRequest("export.unknown_format")
+		unknown.Err = err
+		return common.Fail(contx, unknown)
+	}
+
+	//  Getting Database connection, the cursor ends with the request
+	db := database.ReturnSession().WithContext(contx.Request().Context())
+
+	// the query runs before anything is sent so its errors can still be answered
+	rows, err := RoleExportRows(contx, db)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return common.Fail(contx, err)
+		}
+		return common.Fail(contx, common.Internal("role.export_failed", err))
+	}
+
+	filename := fmt.Sprintf("roles-%v.%v", time.Now().UTC().Format("20060102-150405"), format.Extension)
+	header := contx.Response().Header()
+	header.Set(echo.HeaderContentType, format.ContentType)
+	header.Set(echo.HeaderContentDisposition, fmt.Sprintf("attachment; filename=%q", filename))
+	header.Set("Cache-Control", "no-store")
+	header.Set(echo.HeaderXContentTypeOptions, "nosniff")
+	contx.Response().WriteHeader(http.StatusOK)
+
+	// past this point the status is sent, failures only cut the download short and get logged
+	return export.Stream[models.RoleGet](db, rows, format, contx.Response())
+}
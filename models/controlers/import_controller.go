@@ -0,0 +1,283 @@
+package controlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/imports"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/utils"
+	"semay.com/validation"
+)
+
+// ImportMaxRows is the most rows one import may hold
+func ImportMaxRows() int {
+	return configs.AppConfig.GetIntOrDefault("IMPORT_MAX_ROWS", 1000)
+}
+
+// ImportRoleRows validates the rows with the RolePost rules and finds the names and descriptions given
+// twice in the file or already taken, then creates the valid roles unless dry_run. In the atomic mode
+// one bad row creates nothing, in the best effort mode every valid row is created on its own.
+// The problems of the rows are written in the first of languages the catalogue has.
+func ImportRoleRows(db *gorm.DB, rows []imports.Row[models.RolePost], mode string, dry_run bool, languages []string) (models.ImportReport, error) {
+	translate := func(id string, params i18n.Params) string {
+		return i18n.Messages().Translate(languages, id, params)
+	}
+	report := models.ImportReport{Mode: mode, DryRun: dry_run, Total: len(rows), Rows: make([]models.ImportRowReport, len(rows))}
+
+	// the roles clashing with any row, in one query
+	names := make([]string, 0, len(rows))
+	descriptions := make([]string, 0, len(rows))
+	for _, row := range rows {
+		names = append(names, row.Item.Name)
+		descriptions = append(descriptions, row.Item.Description)
+	}
+	var existing []models.Role
+	if len(rows) > 0 {
+		if err := db.Where("name IN ?", names).Or("description IN ?", descriptions).Find(&existing).Error; err != nil {
+			return report, err
+		}
+	}
+	taken_names := make(map[string]bool)
+	taken_descriptions := make(map[string]bool)
+	for _, role := range existing {
+		taken_names[role.Name] = true
+		taken_descriptions[role.Description] = true
+	}
+
+	// names and descriptions taken are reported as duplicates below, not by the unique rules
+	validate := validation.New(nil)
+	name_lines := make(map[string]int)
+	description_lines := make(map[string]int)
+	for i, row := range rows {
+		entry := models.ImportRowReport{Line: row.Line, Name: row.Item.Name, Status: models.ImportValid}
+
+		if row.Err != nil {
+			entry.Status, entry.Errors = models.ImportInvalid, []string{rowProblem(row.Err, translate)}
+		} else if err := validate.Validate(row.Item); err != nil {
+			entry.Status, entry.Errors = models.ImportInvalid, validation.Messages(err, validation.Translator(languages...))
+		} else {
+			duplicates := make([]string, 0)
+			if line, ok := name_lines[row.Item.Name]; ok {
+				duplicates = append(duplicates, translate("import.name_repeated", i18n.Params{"line": line}))
+			} else if taken_names[row.Item.Name] {
+				duplicates = append(duplicates, translate("import.name_taken", nil))
+			}
+			if line, ok := description_lines[row.Item.Description]; ok {
+				duplicates = append(duplicates, translate("import.description_repeated", i18n.Params{"line": line}))
+			} else if taken_descriptions[row.Item.Description] {
+				duplicates = append(duplicates, translate("import.description_taken", nil))
+			}
+			if len(duplicates) > 0 {
+				entry.Status, entry.Errors = models.ImportDuplicate, duplicates
+			}
+		}
+
+		if _, ok := name_lines[row.Item.Name]; !ok && row.Err == nil {
+			name_lines[row.Item.Name] = row.Line
+		}
+		if _, ok := description_lines[row.Item.Description]; !ok && row.Err == nil {
+			description_lines[row.Item.Description] = row.Line
+		}
+		if entry.Status != models.ImportValid {
+			report.Failed++
+		}
+		report.Rows[i] = entry
+	}
+
+	if dry_run {
+		return report, nil
+	}
+	if mode == models.ImportAtomic {
+		if report.Failed > 0 {
+			skipValid(&report)
+			return report, nil
+		}
+		return report, importAtomic(db, rows, &report, translate)
+	}
+
+	for i, row := range rows {
+		entry := &report.Rows[i]
+		if entry.Status != models.ImportValid {
+			continue
+		}
+		role := models.Role{Name: row.Item.Name, Description: row.Item.Description}
+		if err := db.Create(&role).Error; err != nil {
+			entry.Status, entry.Errors = models.ImportFailed, []string{creationProblem(err, translate)}
+			report.Failed++
+			continue
+		}
+		entry.Status, entry.ID = models.ImportCreated, role.ID
+		report.Created++
+	}
+	return report, nil
+}
+
+// importAtomic creates every row in one transaction, a failing row rolls all of them back
+func importAtomic(db *gorm.DB, rows []imports.Row[models.RolePost], report *models.ImportReport, translate common.Translate) error {
+	tx := db.Begin()
+	for i, row := range rows {
+		role := models.Role{Name: row.Item.Name, Description: row.Item.Description}
+		if err := tx.Create(&role).Error; err != nil {
+			tx.Rollback()
+			report.Rows[i].Status, report.Rows[i].Errors = models.ImportFailed, []string{creationProblem(err, translate)}
+			report.Failed++
+			skipValid(report)
+			return nil
+		}
+		report.Rows[i].Status, report.Rows[i].ID = models.ImportCreated, role.ID
+	}
+	if err := tx.Commit().Error; err != nil {
+		skipValid(report)
+		return err
+	}
+	report.Created = len(rows)
+	return nil
+}
+
+// rowProblem says why a record of the file could not be read as a role
+func rowProblem(err error, translate common.Translate) string {
+	var unknown *imports.UnknownFieldsError
+	if errors.As(err, &unknown) {
+		return translate("import.unknown_fields", i18n.Params{"fields": strings.Join(unknown.Fields, ", ")})
+	}
+	return translate("import.wrong_type", nil)
+}
+
+// creationProblem says why the role of a row was not created, without the database details
+func creationProblem(err error, translate common.Translate) string {
+	if common.IsDuplicate(err) {
+		return translate("import.taken", nil)
+	}
+	return translate("import.create_failed", nil)
+}
+
+// skipValid marks the rows that would have been created as skipped, nothing was written
+func skipValid(report *models.ImportReport) {
+	for i := range report.Rows {
+		if report.Rows[i].Status == models.ImportValid || report.Rows[i].Status == models.ImportCreated {
+			report.Rows[i].Status, report.Rows[i].ID = models.ImportSkipped, 0
+		}
+	}
+	report.Created = 0
+}
+
+// ImportRoles creates roles from a CSV or JSON file
+// @Summary Import Roles
+// @Description Import roles from CSV (name,description header) or a JSON array, sent as the body or as the file field of a form.
+// @Description Every row is validated and checked for duplicates in the file and against the existing roles.
+// @Description Importing needs the post_role permission as well.
+// @Tags Role
+// @Accept text/csv
+// @Accept json
+// @Accept multipart/form-data
+// @Produce json
+// @Security ApiKeyAuth
+// @Security Refresh
+// @Param mode query string false "atomic (default) creates every row or none, best_effort creates the valid rows"
+// @Param dry_run query bool false "validate and report without creating anything"
+// @Param file formData file false "CSV or JSON file"
+// @Success 200 {object} common.ResponseHTTP{data=ImportReport}
+// @Failure 400 {object} common.Problem
+// @Failure 403 {object} common.Problem
+// @Failure 413 {object} common.Problem
+// @Failure 415 {object} common.Problem
+// @Failure 422 {object} common.ResponseHTTP{data=ImportReport}
+// @Router /role/import [post]
+func ImportRoles(contx echo.Context) error {
+
+	// importing creates roles, which needs the permission of the create endpoint
+	permissions, err := middlewares.CallerPermissions(contx)
+	if err != nil {
+		return common.Fail(contx, common.Internal("auth.permission_check_failed", err))
+	}
+	if permission := Roles.RouteName(OperationCreate); !utils.ValueInSlice(permissions, permission) {
+		return common.Fail(contx, common.Forbidden("auth.missing_permission").With(i18n.Params{"permission": permission}))
+	}
+
+	//  parsing Query Prameters
+	mode := contx.QueryParam("mode")
+	if mode == "" {
+		mode = models.ImportAtomic
+	}
+	if mode != models.ImportAtomic && mode != models.ImportBestEffort {
+		return common.Fail(contx, common.BadRequest("import.invalid_mode"))
+	}
+	dry_run := false
+	if raw := contx.QueryParam("dry_run"); raw != "" {
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return common.Fail(contx, common.BadRequest("import.invalid_dry_run"))
+		}
+		dry_run = parsed
+	}
+
+	// the file is the body or the file field of a form
+	var body io.Reader = contx.Request().Body
+	content_type, filename := contx.Request().Header.Get(echo.HeaderContentType), ""
+	if file, err := contx.FormFile("file"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			return common.Fail(contx, common.BadRequest("import.unreadable"))
+		}
+		defer opened.Close()
+		body, content_type, filename = opened, file.Header.Get(echo.HeaderContentType), file.Filename
+	}
+
+	format, err := imports.FormatOf(content_type, filename)
+	if err != nil {
+		unsupported := common.NewError(http.StatusUnsupportedMediaType, "", "import.unknown_format")
+		unsupported.Err = err
+		return common.Fail(contx, unsupported)
+	}
+	rows, err := imports.Read[models.RolePost](format, body, ImportMaxRows())
+	if err != nil {
+		unreadable := common.BadRequest("import.unreadable")
+		switch {
+		case errors.Is(err, imports.ErrTooManyRows):
+			unreadable = common.NewError(http.StatusRequestEntityTooLarge, "", "import.too_many_rows").With(i18n.Params{"max": ImportMaxRows()})
+		case errors.Is(err, imports.ErrMalformed):
+			unreadable = common.BadRequest("import.malformed").With(i18n.Params{"format": format})
+		}
+		unreadable.Err = err
+		return common.Fail(contx, unreadable)
+	}
+
+	//  Getting Database connection
+	db := database.ReturnSession()
+	report, err := ImportRoleRows(db, rows, mode, dry_run, common.Languages(contx))
+	if err != nil {
+		return common.Fail(contx, common.Internal("import.failed", err))
+	}
+
+	switch {
+	case dry_run:
+		return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+			Success: report.Failed == 0,
+			Message: "import.dry_run",
+			Data:    report,
+		})
+	case mode == models.ImportAtomic && report.Failed > 0:
+		return common.Respond(contx, http.StatusUnprocessableEntity, common.ResponseHTTP{
+			Success: false,
+			Message: "import.rejected",
+			Data:    report,
+		})
+	}
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: report.Failed == 0,
+		Message: "import.completed",
+		Params:  i18n.Params{"created": report.Created, "count": report.Total},
+		Data:    report,
+	})
+}
@@ -0,0 +1,344 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/configs"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+// number of recovery codes handed out on enrolment
+const recoveryCodeCount = 10
+
+// mfaRequired tells whether the login of the user needs the second factor, either because
+// the user enrolled or because one of its roles, or a role they contain, is listed in MFA_REQUIRED_ROLES
+func mfaRequired(db *gorm.DB, user models.User) (bool, error) {
+	if user.MFAEnabled {
+		return true, nil
+	}
+	names := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		names = append(names, role.Name)
+	}
+	roles, err := models.EffectiveRoles(db, names)
+	if err != nil {
+		return false, err
+	}
+	required := strings.Split(configs.AppConfig.GetOrDefault("MFA_REQUIRED_ROLES", "superuser"), ",")
+	for _, role := range roles {
+		if utils.ValueInSlice(required, role.Name) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// mfaChallenge responds with the pending token to complete the login with
+func mfaChallenge(contx echo.Context, user models.User) error {
+	life_time := configMinutes("MFA_PENDING_LIFE_TIME", 5)
+	token, err := utils.CreateMFAPendingToken(user.Email, user.UUID, life_time)
+	if err != nil {
+		return common.Fail(contx, common.Internal("auth.token_failed", err))
+	}
+
+	message := "mfa.verification_required"
+	if !user.MFAEnabled {
+		message = "mfa.enrolment_required"
+	}
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: message,
+		Data: models.MFAChallenge{
+			MFAToken:           token,
+			TokenType:          "MFA",
+			ExpiresIn:          life_time * 60,
+			EnrollmentRequired: !user.MFAEnabled,
+		},
+	})
+}
+
+// userFromClaim loads the user a token was issued to with its active roles
+func userFromClaim(db *gorm.DB, claim utils.UserClaim) (models.User, error) {
+	var user models.User
+	err := db.Preload("Roles", "active = ?", true).Where("uuid = ? AND active = ?", claim.UUID, true).First(&user).Error
+	return user, err
+}
+
+// consumeTOTP validates a code and records its step so it can not be used twice
+func consumeTOTP(db *gorm.DB, user models.User, code string) bool {
+	secret, err := utils.DecryptSecret(user.TOTPSecret)
+	if err != nil {
+		return false
+	}
+	step, ok := utils.ValidateTOTP(secret, code, time.Now(), user.TOTPLastStep)
+	if !ok {
+		return false
+	}
+
+	// conditional update so concurrent requests can not both use the step
+	res := db.Model(&models.User{}).Where("id = ? AND totp_last_step < ?", user.ID, step).UpdateColumn("totp_last_step", step)
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// consumeRecoveryCode marks a matching unused recovery code as used
+func consumeRecoveryCode(db *gorm.DB, user models.User, code string) bool {
+	hashed := utils.HashFunc(utils.NormalizeRecoveryCode(code))
+	res := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND hash = ? AND used_at IS NULL", user.ID, hashed).
+		UpdateColumn("used_at", time.Now().UTC())
+	return res.Error == nil && res.RowsAffected == 1
+}
+
+// VerifyMFA completes a login with a TOTP or recovery code
+// @Summary Verify second factor
+// @Description Exchange the MFA pending token and a code for an access token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param mfa body MFAVerify true "Verify MFA"
+// @Success 200 {object} common.ResponseHTTP{data=AuthToken}
+// @Failure 400 {object} common.Problem
+// @Failure 401 {object} common.Problem
+// @Router /auth/mfa/verify [post]
+func VerifyMFA(contx echo.Context) error {
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//first parse request data
+	verify := new(models.MFAVerify)
+	if err := contx.Bind(&verify); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// then validate structure
+	if err := contx.Validate(verify); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	claim, err := utils.ParseMFAPendingToken(verify.MFAToken)
+	if err != nil {
+		return common.Fail(contx, common.Unauthorized("auth.invalid_token"))
+	}
+
+	user, err := userFromClaim(db, claim)
+	if err != nil || !user.MFAEnabled {
+		return common.Fail(contx, common.Unauthorized("mfa.not_enabled"))
+	}
+
+	// guessing codes counts as failed logins of the account
+	wait, err := claimLoginAttempt(db, user)
+	if err != nil {
+		return common.Fail(contx, common.Internal("user.update_failed", err))
+	}
+	if wait > 0 {
+		return loginDelayed(contx, http.StatusLocked, "auth.locked", wait)
+	}
+
+	verified := false
+	if verify.Code != "" {
+		verified = consumeTOTP(db, user, verify.Code)
+	} else {
+		verified = consumeRecoveryCode(db, user, verify.RecoveryCode)
+	}
+	if !verified {
+		return common.Fail(contx, common.Unauthorized("mfa.invalid_code"))
+	}
+	if err := resetLoginFailures(db, user); err != nil {
+		return common.Fail(contx, common.Internal("user.update_failed", err))
+	}
+
+	// the pending token is single use
+	utils.RevokeJWTToken(claim)
+	return issueToken(contx, user)
+}
+
+// EnrollMFA creates a new TOTP secret for the caller
+// @Summary Enrol second factor
+// @Description Create a TOTP secret, MFA is enabled once a code is confirmed
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} common.ResponseHTTP{data=MFAEnrollment}
+// @Failure 401 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Router /auth/mfa/enroll [post]
+func EnrollMFA(contx echo.Context) error {
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	claim, _ := middlewares.GetUserClaim(contx)
+	user, err := userFromClaim(db, claim)
+	if err != nil {
+		return common.Fail(contx, common.Unauthorized("user.not_found"))
+	}
+	if user.MFAEnabled {
+		return common.Fail(contx, common.Conflict("mfa.already_enabled"))
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return common.Fail(contx, common.Internal("mfa.secret_failed", err))
+	}
+	sealed, err := utils.EncryptSecret(secret)
+	if err != nil {
+		return common.Fail(contx, common.Internal("mfa.secret_failed", err))
+	}
+	if err := db.Model(&user).UpdateColumns(map[string]interface{}{"totp_secret": sealed, "totp_last_step": 0}).Error; err != nil {
+		return common.Fail(contx, common.Internal("mfa.secret_save_failed", err))
+	}
+
+	issuer := configs.AppConfig.GetOrDefault("MFA_ISSUER", "Blue Admin")
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "mfa.enrolled",
+		Data: models.MFAEnrollment{
+			Secret:          secret,
+			ProvisioningURI: utils.TOTPProvisioningURI(issuer, user.Email, secret),
+		},
+	})
+}
+
+// ConfirmMFA enables MFA once the caller proves the secret was stored
+// @Summary Confirm second factor
+// @Description Enable MFA with a first code, returns the recovery codes
+// @Tags Auth
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param mfa body MFAConfirm true "Confirm MFA"
+// @Success 200 {object} common.ResponseHTTP{data=MFAConfirmed}
+// @Failure 400 {object} common.Problem
+// @Failure 401 {object} common.Problem
+// @Router /auth/mfa/confirm [post]
+func ConfirmMFA(contx echo.Context) error {
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//first parse request data
+	confirm := new(models.MFAConfirm)
+	if err := contx.Bind(&confirm); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// then validate structure
+	if err := contx.Validate(confirm); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	claim, _ := middlewares.GetUserClaim(contx)
+	user, err := userFromClaim(db, claim)
+	if err != nil {
+		return common.Fail(contx, common.Unauthorized("user.not_found"))
+	}
+	if user.MFAEnabled || user.TOTPSecret == "" {
+		return common.Fail(contx, common.BadRequest("mfa.no_pending_enrolment"))
+	}
+	if !consumeTOTP(db, user, confirm.Code) {
+		return common.Fail(contx, common.Unauthorized("mfa.invalid_code"))
+	}
+
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return common.Fail(contx, common.Internal("mfa.recovery_codes_failed", err))
+	}
+
+	// enabling MFA and replacing the recovery codes together
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		recovery_codes := make([]models.RecoveryCode, 0, len(codes))
+		for _, code := range codes {
+			recovery_codes = append(recovery_codes, models.RecoveryCode{UserID: user.ID, Hash: utils.HashFunc(code)})
+		}
+		if err := tx.Create(&recovery_codes).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).UpdateColumn("mfa_enabled", true).Error
+	})
+	if err != nil {
+		return common.Fail(contx, common.Internal("mfa.enable_failed", err))
+	}
+
+	// an enrolment forced at login completes the login as well
+	confirmed := models.MFAConfirmed{RecoveryCodes: codes}
+	if claim.Subject == utils.MFAPendingSubject {
+		utils.RevokeJWTToken(claim)
+		token, err := newAuthToken(user)
+		if err == nil {
+			confirmed.Token = &token
+		}
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "mfa.enabled",
+		Data:    confirmed,
+	})
+}
+
+// ResetUserMFA removes the second factor of a user who lost their device
+// @Summary Reset MFA of a User
+// @Description Remove the TOTP secret and recovery codes of a User
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} common.ResponseHTTP{}
+// @Failure 404 {object} common.Problem
+// @Router /user/{user_id}/mfa/reset [post]
+func ResetUserMFA(contx echo.Context) error {
+
+	// validate path params
+	id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	var user models.User
+	if err := db.Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).UpdateColumns(map[string]interface{}{
+			"totp_secret":    "",
+			"totp_last_step": 0,
+			"mfa_enabled":    false,
+		}).Error
+	})
+	if err != nil {
+		return common.Fail(contx, common.Internal("mfa.reset_failed", err))
+	}
+
+	// sessions established with the old factor are ended
+	if _, err := utils.TokenRevocations.RevokeAll(user.UUID); err != nil {
+		return common.Fail(contx, common.Internal("user.tokens_revoke_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "mfa.reset",
+		Data:    nil,
+	})
+}
@@ -0,0 +1,209 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/models"
+	"semay.com/sso"
+	"semay.com/utils"
+)
+
+// OIDCLogin redirects the browser to the single sign-on provider
+// @Summary Single sign-on login
+// @Description Redirect to the OpenID Connect provider
+// @Tags Auth
+// @Success 302
+// @Failure 503 {object} common.Problem
+// @Router /auth/oidc/login [get]
+func OIDCLogin(contx echo.Context) error {
+	client, err := sso.Default(contx.Request().Context())
+	if err != nil {
+		return common.Fail(contx, common.NewError(http.StatusServiceUnavailable, "", "sso.unavailable"))
+	}
+
+	auth_url, state, err := client.AuthCodeURL()
+	if err != nil {
+		return common.Fail(contx, common.Internal("sso.start_failed", err))
+	}
+
+	// the login can only be completed by this browser
+	contx.SetCookie(stateCookie(contx, state, int(sso.PendingLifeTime.Seconds())))
+	return contx.Redirect(http.StatusFound, auth_url)
+}
+
+// stateCookie is the StateCookie sent to the callback only, a negative max_age deletes it
+func stateCookie(contx echo.Context, value string, max_age int) *http.Cookie {
+	return &http.Cookie{
+		Name:     sso.StateCookie,
+		Value:    value,
+		Path:     "/auth/oidc",
+		MaxAge:   max_age,
+		HttpOnly: true,
+		Secure:   contx.Scheme() == "https",
+		// sent along the top level redirect back from the provider
+		SameSite: http.SameSiteLaxMode,
+	}
+}
+
+// OIDCCallback completes the single sign-on and exchanges the identity for our own token
+// @Summary Single sign-on callback
+// @Description Exchange the provider authorization code for an access token
+// @Tags Auth
+// @Produce json
+// @Param code query string true "authorization code"
+// @Param state query string true "login state"
+// @Success 200 {object} common.ResponseHTTP{data=AuthToken}
+// @Failure 401 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Router /auth/oidc/callback [get]
+func OIDCCallback(contx echo.Context) error {
+	client, err := sso.Default(contx.Request().Context())
+	if err != nil {
+		return common.Fail(contx, common.NewError(http.StatusServiceUnavailable, "", "sso.unavailable"))
+	}
+
+	// provider reported failures come back as error parameters
+	if provider_error := contx.QueryParam("error"); provider_error != "" {
+		return common.Fail(contx, common.Unauthorized("sso.provider_failed").With(i18n.Params{"reason": provider_error}))
+	}
+
+	// a login state is used once
+	state, err := contx.Cookie(sso.StateCookie)
+	if err != nil {
+		return common.Fail(contx, common.Unauthorized("sso.failed"))
+	}
+	contx.SetCookie(stateCookie(contx, "", -1))
+
+	identity, err := client.Exchange(contx.Request().Context(), state.Value, contx.QueryParam("state"), contx.QueryParam("code"))
+	if err != nil {
+		return common.Fail(contx, common.Unauthorized("sso.failed"))
+	}
+
+	db := database.ReturnSession()
+	user, err := ProvisionSSOUser(db, identity, client.MapRoles(identity.Groups))
+	if errors.Is(err, ErrSSOAccountExists) {
+		return common.Fail(contx, common.Conflict("sso.account_exists"))
+	}
+	if err != nil {
+		return common.Fail(contx, common.Internal("sso.provision_failed", err))
+	}
+	if !user.Active {
+		return common.Fail(contx, common.Unauthorized("user.disabled"))
+	}
+
+	// single sign-on is held to the same second factor policy as password logins
+	required, err := mfaRequired(db, user)
+	if err != nil {
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
+	}
+	if required {
+		return mfaChallenge(contx, user)
+	}
+	return issueToken(contx, user)
+}
+
+// ErrSSOAccountExists is returned when the email of a new identity belongs to a local account,
+// which is not taken over on the provider's word
+var ErrSSOAccountExists = errors.New("a local account already uses the email")
+
+// ProvisionSSOUser finds the user of an identity, creating it on its first login, and syncs the
+// roles granted by the provider with the existing roles named in role_names. Roles assigned here
+// are kept, and the tokens of the user are revoked when the provider takes a role away.
+// The returned user has only its active roles loaded.
+func ProvisionSSOUser(db *gorm.DB, identity sso.Identity, role_names []string) (models.User, error) {
+	var user models.User
+	revoke := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Preload("Roles").Where("sso_subject = ?", identity.Subject).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			var count int64
+			if err := tx.Model(&models.User{}).Where("email = ?", identity.Email).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return ErrSSOAccountExists
+			}
+
+			// single sign-on users get an unusable random password
+			user = models.User{
+				Email:      identity.Email,
+				UUID:       uuid.New().String(),
+				Password:   utils.HashFunc(uuid.New().String() + uuid.New().String()),
+				SSOSubject: &identity.Subject,
+			}
+			err = tx.Create(&user).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		granted := make([]models.Role, 0)
+		if len(role_names) > 0 {
+			if err := tx.Where("name IN ?", role_names).Find(&granted).Error; err != nil {
+				return err
+			}
+		}
+
+		// roles held before and not from the provider were assigned here
+		previous := strings.Split(user.SSORoles, ",")
+		manual := make([]string, 0)
+		held := make([]string, 0, len(user.Roles))
+		for _, role := range user.Roles {
+			held = append(held, role.Name)
+			if !utils.ValueInSlice(previous, role.Name) {
+				manual = append(manual, role.Name)
+			}
+		}
+
+		added := make([]models.Role, 0)
+		from_provider := make([]string, 0, len(granted))
+		for _, role := range granted {
+			if !utils.ValueInSlice(held, role.Name) {
+				added = append(added, role)
+			}
+			if !utils.ValueInSlice(manual, role.Name) {
+				from_provider = append(from_provider, role.Name)
+			}
+		}
+		removed := make([]models.Role, 0)
+		for _, role := range user.Roles {
+			if utils.ValueInSlice(previous, role.Name) && !utils.ValueInSlice(from_provider, role.Name) {
+				removed = append(removed, role)
+			}
+		}
+
+		if len(added) > 0 {
+			if err := tx.Model(&user).Association("Roles").Append(added); err != nil {
+				return err
+			}
+		}
+		if len(removed) > 0 {
+			if err := tx.Model(&user).Association("Roles").Delete(removed); err != nil {
+				return err
+			}
+			revoke = true
+		}
+		return tx.Model(&user).UpdateColumn("sso_roles", strings.Join(from_provider, ",")).Error
+	})
+	if err != nil {
+		return user, err
+	}
+
+	// tokens still carrying a role the provider took away are invalidated
+	if revoke {
+		if _, err := utils.TokenRevocations.RevokeAll(user.UUID); err != nil {
+			return user, err
+		}
+	}
+
+	err = db.Preload("Roles", "active = ?", true).First(&user, user.ID).Error
+	return user, err
+}
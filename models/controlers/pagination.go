@@ -0,0 +1,135 @@
+package controlers
+
+import (
+	"net/url"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/common"
+	"semay.com/models"
+	"semay.com/search"
+)
+
+// listOptions describe what a list endpoint lets clients ask for
+type listOptions struct {
+	// sortable fields, query names to columns
+	Sortable map[string]string
+	// Get DTO the ?fields= names are checked against
+	DTO interface{}
+	// full-text index searched with ?q=, nil when the list is not searchable
+	Search  *search.Index
+	Message string
+}
+
+var (
+	roleList = listOptions{
+		Sortable: map[string]string{"id": "id", "name": "name", "description": "description", "active": "active"},
+		DTO:      models.RoleGet{},
+		Message:  "role.listed",
+	}
+	roleSearchList = listOptions{
+		Sortable: roleList.Sortable,
+		DTO:      models.RoleSearchResult{},
+		Search:   &models.RoleSearch,
+		Message:  roleList.Message,
+	}
+	userList = listOptions{
+		Sortable: map[string]string{"id": "id", "email": "email", "active": "active"},
+		DTO:      models.UserGet{},
+		Message:  "user.listed",
+	}
+	permissionList = listOptions{
+		Sortable: map[string]string{"id": "id", "name": "name", "active": "active"},
+		DTO:      models.PermissionGet{},
+		Message:  "permission.listed",
+	}
+	apiKeyList = listOptions{
+		Sortable: map[string]string{"id": "id", "name": "name", "prefix": "prefix", "created_at": "created_at", "expires_at": "expires_at"},
+		DTO:      models.APIKeyGet{},
+		Message:  "api_key.listed",
+	}
+)
+
+// listQuery narrows query by the filter[field][op]= parameters and parses the ?sort= of a list
+func listQuery(query *gorm.DB, params url.Values, options listOptions) (*gorm.DB, []common.SortField, error) {
+	filters, err := common.ParseFilters(query, params)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sort, err := common.ParseSort(params.Get("sort"), options.Sortable)
+	if err != nil {
+		return nil, nil, err
+	}
+	return common.ApplyFilters(query, filters), sort, nil
+}
+
+// listPage answers a list request with a page of query narrowed by the filter[field][op]= parameters
+// and ordered by ?sort=, in cursor mode when ?cursor= or ?limit= are given and with page numbers otherwise.
+// ?fields= limits the columns read and the fields returned, searchable lists match ?q= and
+// put the most relevant rows first unless ?sort= is given or in cursor mode, which has no relevance order.
+// Errors wrapping common.ErrInvalidQuery come from bad parameters.
+func listPage[T any](contx echo.Context, query *gorm.DB, options listOptions) (interface{}, error) {
+	query, sort, err := listQuery(query, contx.QueryParams(), options)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sort columns are read whatever the fieldset, cursors are made of them
+	fieldset, err := common.ParseFields(contx.QueryParam("fields"), options.DTO)
+	if err != nil {
+		return nil, err
+	}
+	sort_columns := make([]string, 0, len(sort))
+	for _, field := range sort {
+		sort_columns = append(sort_columns, field.Column)
+	}
+	if query, err = fieldset.Select(query, sort_columns...); err != nil {
+		return nil, err
+	}
+
+	keyset := common.IsKeysetRequest(contx)
+	by_rank := false
+	if options.Search != nil && search.Terms(contx.QueryParam("q")) != nil {
+		query = options.Search.Apply(query, contx.QueryParam("q"))
+		if len(sort) == 0 && !keyset {
+			query = query.Order(clause.OrderByColumn{Column: clause.Column{Name: "search_rank"}, Desc: true})
+			by_rank = true
+		}
+	}
+
+	if keyset {
+		cursor, limit, err := common.KeysetParams(contx)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := common.PaginateKeyset[T](contx.Request().Context(), query, sort, cursor, limit)
+		if err != nil {
+			return nil, err
+		}
+		if result.Items, err = fieldset.Shape(result.Items); err != nil {
+			return nil, err
+		}
+		result.Message = options.Message
+		return result, nil
+	}
+
+	page, size, err := common.PageParams(contx)
+	if err != nil {
+		return nil, err
+	}
+	result, err := common.Paginate[T](contx.Request().Context(), query, sort, page, size)
+	if err != nil {
+		return nil, err
+	}
+	if result.Items, err = fieldset.Shape(result.Items); err != nil {
+		return nil, err
+	}
+	if by_rank {
+		result.Sort = "-rank," + result.Sort
+	}
+	result.Message = options.Message
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/models"
+)
+
+// GetPermissions is a function to get Permissions
+// @Summary Get Permissions
+// @Description Get Permissions
+// @Tags Permission
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Param page query int false "page"
+// @Param size query int false "page size"
+// @Param cursor query string false "cursor of the keyset mode"
+// @Param limit query int false "page size of the keyset mode"
+// @Param sort query string false "sort fields e.g. -name,id, - prefix for descending"
+// @Param filter query string false "filters as filter[field][operator]=value, e.g. filter[name][ilike]=adm"
+// @Param fields query string false "fields to return e.g. id,name, all of them when left out"
+// @Success 200 {object} common.ResponsePagination{data=[]PermissionGet}
+// @Failure 400 {object} common.Problem
+// @Router /permission [get]
+func GetPermissions(contx echo.Context) error {
+
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//  querying result with pagination using gorm function
+	result, err := listPage[models.PermissionGet](contx, db.Model(&models.Permission{}), permissionList)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return common.Fail(contx, err)
+		}
+		return common.Fail(contx, common.Internal("permission.list_failed", err))
+	}
+
+	// returning result if all the above completed successfully
+	return common.Respond(contx, http.StatusOK, result)
+}
+
+// AddRolePermission grants a permission to a role
+// @Summary Grant Permission to Role
+// @Description Grant Permission to Role
+// @Tags Permission
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param role_id path int true "Role ID"
+// @Param permission_id path int true "Permission ID"
+// @Success 200 {object} common.ResponseHTTP{data=[]PermissionGet}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Router /role/{role_id}/permission/{permission_id} [post]
+func AddRolePermission(contx echo.Context) error {
+	return changeRolePermission(contx, true)
+}
+
+// DeleteRolePermission revokes a permission from a role
+// @Summary Revoke Permission from Role
+// @Description Revoke Permission from Role
+// @Tags Permission
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param role_id path int true "Role ID"
+// @Param permission_id path int true "Permission ID"
+// @Success 200 {object} common.ResponseHTTP{data=[]PermissionGet}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Router /role/{role_id}/permission/{permission_id} [delete]
+func DeleteRolePermission(contx echo.Context) error {
+	return changeRolePermission(contx, false)
+}
+
+// changeRolePermission appends or removes the role_permissions row for the path params
+func changeRolePermission(contx echo.Context, grant bool) error {
+
+	// validate path params
+	role_id, err := strconv.Atoi(contx.Param("role_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "role_id"}))
+	}
+	permission_id, err := strconv.Atoi(contx.Param("permission_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "permission_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	// checking both sides of the relation exist
+	var role models.Role
+	if err := db.Where("id = ?", role_id).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("role.not_found"))
+		}
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
+	}
+	var permission models.Permission
+	if err := db.Where("id = ?", permission_id).First(&permission).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("permission.not_found"))
+		}
+		return common.Fail(contx, common.Internal("permission.retrieve_failed", err))
+	}
+
+	// appending or removing the association
+	message := "permission.granted"
+	association := db.Model(&role).Association("Permissions")
+	if grant {
+		err = association.Append(&permission)
+	} else {
+		err = association.Delete(&permission)
+		message = "permission.revoked"
+	}
+	if err != nil {
+		return common.Fail(contx, common.Internal("permission.update_failed", err))
+	}
+
+	// returning the permissions the role now holds
+	permissions := make([]models.PermissionGet, 0)
+	db.Model(&role).Association("Permissions").Find(&permissions)
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: message,
+		Data:    permissions,
+	})
+}
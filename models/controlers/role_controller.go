@@ -5,16 +5,38 @@ import (
 	"net/http"
 	"strconv"
 
-	"github.com/go-playground/validator/v10"
 	"github.com/labstack/echo/v4"
-	"github.com/mitchellh/mapstructure"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
 	"semay.com/common"
-	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/middlewares"
 	"semay.com/models"
 )
 
+// Roles serves the role endpoints, lists with a ?q= search the role full-text index
+// and ?active=true or false keeps the active or the deactivated roles
+var Roles = &CRUD[models.Role, models.RolePost, models.RolePatch, models.RoleGet]{
+	Name:     "role",
+	Sortable: roleList.Sortable,
+	Filters:  []Filter{BoolFilter("active", "active")},
+	Search: func(contx echo.Context, query *gorm.DB) (interface{}, error) {
+		return listPage[models.RoleSearchResult](contx, query, roleSearchList)
+	},
+	// patches switching the status are recorded like a deactivation
+	BeforeUpdate: func(contx echo.Context, tx *gorm.DB, patch *models.RolePatch, role *models.Role) error {
+		if patch.Active == nil || *patch.Active == role.Active {
+			return nil
+		}
+		return switchRoleStatus(contx, tx, role, *patch.Active, roleStatusPatched)
+	},
+}
+
+// reasons recorded for the status changes made by writing the role instead of activate and deactivate
+const (
+	roleStatusPatched  = "set by patching the role"
+	roleStatusReplaced = "set by replacing the role"
+)
+
 // GetRoles is a function to get a Roles by ID
 // @Summary Get Roles
 // @Description Get Roles
@@ -23,40 +45,20 @@ import (
 // @Produce json
 // @Security ApiKeyAuth
 // @Security Refresh
-// @Param page query int true "page"
-// @Param size query int true "page size"
+// @Param page query int false "page"
+// @Param size query int false "page size"
+// @Param cursor query string false "cursor of the keyset mode"
+// @Param limit query int false "page size of the keyset mode"
+// @Param sort query string false "sort fields e.g. -name,id, - prefix for descending"
+// @Param filter query string false "filters as filter[field][operator]=value, e.g. filter[name][ilike]=adm"
+// @Param fields query string false "fields to return e.g. id,name, all of them when left out"
+// @Param q query string false "words to search in name and description"
+// @Param active query bool false "true for the active roles, false for the deactivated ones"
 // @Success 200 {object} common.ResponsePagination{data=[]RoleGet}
-// @Failure 404 {object} common.ResponseHTTP{}
+// @Failure 404 {object} common.Problem
 // @Router /roles [get]
 func GetRoles(contx echo.Context) error {
-
-	//  parsing Query Prameters
-	Page, _ := strconv.Atoi(contx.QueryParam("page"))
-	Limit, _ := strconv.Atoi(contx.QueryParam("size"))
-	//  checking if query parameters  are correct
-	if Page == 0 || Limit == 0 {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: "Not Allowed, Bad request",
-			Data:    nil,
-		})
-	}
-
-	//  Getting Database connection
-	db := database.ReturnSession()
-
-	//  querying result with pagination using gorm function
-	result, err := common.PaginationPureModel(db, models.Role{}, []models.Role{}, uint(Page), uint(Limit))
-	if err != nil {
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: true,
-			Message: "Success get all roles.",
-			Data:    "something",
-		})
-	}
-
-	// returning result if all the above completed successfully
-	return contx.JSON(http.StatusOK, result)
+	return Roles.List(contx)
 }
 
 // GetRoleByID is a function to get a Roles by ID
@@ -67,51 +69,12 @@ func GetRoles(contx echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path int true "Role ID"
+// @Param fields query string false "fields to return e.g. id,name, all of them when left out"
 // @Success 200 {object} common.ResponseHTTP{data=RoleGet}
-// @Failure 404 {object} common.ResponseHTTP{}
+// @Failure 404 {object} common.Problem
 // @Router /roles/{role_id} [get]
 func GetRoleByID(contx echo.Context) error {
-
-	//  parsing Query Prameters
-	id, err := strconv.Atoi(contx.Param("role_id"))
-	if err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
-	}
-
-	//  Getting Database connection
-	db := database.ReturnSession()
-
-	// Preparing and querying database using Gorm
-	var roles_get models.RoleGet
-	var roles models.Role
-	if res := db.Model(&models.Role{}).Preload(clause.Associations).Where("id = ?", id).First(&roles); res.Error != nil {
-		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
-			return contx.JSON(http.StatusNotFound, common.ResponseHTTP{
-				Success: false,
-				Message: "Role not found",
-				Data:    nil,
-			})
-		}
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: false,
-			Message: "Error retrieving role",
-			Data:    nil,
-		})
-	}
-
-	// filtering response data according to filtered defined struct
-	mapstructure.Decode(roles, &roles_get)
-
-	//  Finally returing response if All the above compeleted successfully
-	return contx.JSON(http.StatusOK, common.ResponseHTTP{
-		Success: true,
-		Message: "Success got one role.",
-		Data:    &roles_get,
-	})
+	return Roles.Get(contx)
 }
 
 // Add Role to data
@@ -122,227 +85,385 @@ func GetRoleByID(contx echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param role body RolePost true "Add Role"
-// @Success 200 {object} common.ResponseHTTP{data=RolePost}
-// @Failure 400 {object} common.ResponseHTTP{}
-// @Failure 500 {object} common.ResponseHTTP{}
+// @Success 200 {object} common.ResponseHTTP{data=RoleGet}
+// @Failure 400 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Failure 500 {object} common.Problem
 // @Router /roles [post]
 func PostRole(contx echo.Context) error {
-	//  parsing Query Prameters
-	db := database.ReturnSession()
-
-	// validator initialization
-	validate := validator.New()
-
-	//validating post data
-	posted_role := new(models.RolePost)
-
-	//first parse request data
-	if err := contx.Bind(&posted_role); err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
-	}
+	return Roles.Create(contx)
+}
+
+// Patch Role to data
+// @Summary Patch Role
+// @Description Patch Role with the non zero fields of a body, a JSON merge patch (RFC 7386) or a JSON Patch (RFC 6902).
+// @Description A change of the status is recorded like a deactivation, with a default reason.
+// @Tags Role
+// @Security ApiKeyAuth
+// @Accept json
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param role body RolePatch true "Patch Role"
+// @Param id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleGet}
+// @Failure 400 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Failure 422 {object} common.Problem
+// @Failure 500 {object} common.Problem
+// @Router /role/{role_id} [patch]
+func PatchRole(contx echo.Context) error {
+	return Roles.Update(contx)
+}
 
-	// then validate structure
-	if err := validate.Struct(posted_role); err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
+// PutRole replaces every field of a role, or creates it at the ID of the path
+// @Summary Replace Role
+// @Description Replace every field of a role, a role missing at the ID is created there.
+// @Description A change of the status is recorded like a deactivation, with a default reason.
+// @Tags Role
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param role body RolePut true "Replace Role"
+// @Param id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleGet}
+// @Success 201 {object} common.ResponseHTTP{data=RoleGet}
+// @Failure 400 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Failure 500 {object} common.Problem
+// @Router /role/{role_id} [put]
+func PutRole(contx echo.Context) error {
+
+	// validate path params, ids start at one
+	id, err := strconv.Atoi(contx.Param("role_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "role_id"}))
+	}
+	if id < 1 {
+		return common.Fail(contx, common.BadRequest("error.not_an_id").With(i18n.Params{"param": "role_id"}))
 	}
 
-	//  initiate -> role
-	role := new(models.Role)
-	role.Name = posted_role.Name
-	role.Description = posted_role.Description
+	// every field is required, the path binds the ID so unique rules skip the role itself
+	put_role := new(models.RolePut)
+	if err := contx.Bind(put_role); err != nil {
+		return common.Fail(contx, err)
+	}
+	put_role.ID = uint(id)
+	if err := contx.Validate(put_role); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
 
-	//  start transaction to database
+	// Get database connection of the role endpoints and start the transaction
+	db := Roles.session()
 	tx := db.Begin()
 
-	// add  data using transaction if values are valid
-	if err := tx.Create(&role).Error; err != nil {
+	// new roles start active, the status is then switched like the one of a stored role
+	role := models.Role{ID: put_role.ID, Active: true}
+	found := tx.Where("id = ?", id).Limit(1).Find(&role)
+	if found.Error != nil {
+		tx.Rollback()
+		return common.Fail(contx, common.Internal("role.retrieve_failed", found.Error))
+	}
+	role.Name, role.Description = put_role.Name, put_role.Description
+
+	status, message := http.StatusOK, "role.updated"
+	if found.RowsAffected == 0 {
+		status, message = http.StatusCreated, "role.created"
+		err = tx.Create(&role).Error
+		if err == nil {
+			err = syncIDSequence(tx, "roles")
+		}
+	} else {
+		err = tx.Model(&role).Select("name", "description").Updates(&role).Error
+	}
+	if err == nil && role.Active != *put_role.Active {
+		err = switchRoleStatus(contx, tx, &role, *put_role.Active, roleStatusReplaced)
+	}
+	if err != nil {
 		tx.Rollback()
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: false,
-			Message: "Role Creation Failed",
-			Data:    err,
-		})
+		if common.IsDuplicate(err) {
+			return common.Fail(contx, common.Conflict("role.exists"))
+		}
+		return common.Fail(contx, common.Internal("role.update_failed", err))
 	}
 
-	// close transaction
-	tx.Commit()
+	if err := tx.Commit().Error; err != nil {
+		return common.Fail(contx, common.Internal("role.update_failed", err))
+	}
 
-	// return data if transaction is sucessfull
-	return contx.JSON(http.StatusOK, common.ResponseHTTP{
+	if status == http.StatusCreated {
+		contx.Response().Header().Set(echo.HeaderLocation, contx.Request().URL.Path)
+	}
+	return common.Respond(contx, status, common.ResponseHTTP{
 		Success: true,
-		Message: "Role created successfully.",
-		Data:    role,
+		Message: message,
+		Data:    roleGet(role),
 	})
 }
 
-// Patch Role to data
-// @Summary Patch Role
-// @Description Patch Role
+// syncIDSequence moves the id sequence of table past the ids given by clients, so the next
+// generated one is free. Sqlite always picks the highest id plus one.
+func syncIDSequence(tx *gorm.DB, table string) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec(
+		"SELECT setval(pg_get_serial_sequence(?, 'id'), (SELECT COALESCE(MAX(id), 1) FROM "+table+"))", table,
+	).Error
+}
+
+// ActivateRole switches a deactivated role back on
+// @Summary Activate Role
+// @Description Activate a role, recording why and by whom
 // @Tags Role
 // @Security ApiKeyAuth
 // @Accept json
 // @Produce json
-// @Param role body RolePost true "Patch Role"
+// @Param status body RoleStatus true "Reason"
 // @Param id path int true "Role ID"
-// @Success 200 {object} common.ResponseHTTP{data=RolePost}
-// @Failure 400 {object} common.ResponseHTTP{}
-// @Failure 500 {object} common.ResponseHTTP{}
-// @Router /role/{role_id} [patch]
-func PatchRole(contx echo.Context) error {
+// @Success 200 {object} common.ResponseHTTP{data=RoleGet}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Router /role/{role_id}/activate [post]
+func ActivateRole(contx echo.Context) error {
+	return setRoleActive(contx, true)
+}
 
-	// Get database connection
-	db := database.ReturnSession()
+// DeactivateRole switches a role off, its permissions stop applying to every holder at once
+// @Summary Deactivate Role
+// @Description Deactivate a role, recording why and by whom. Tokens stop carrying it and its permissions stop applying.
+// @Tags Role
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param status body RoleStatus true "Reason"
+// @Param id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleGet}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Router /role/{role_id}/deactivate [post]
+func DeactivateRole(contx echo.Context) error {
+	return setRoleActive(contx, false)
+}
 
-	//  initialize data validator
-	validate := validator.New()
+// setRoleActive changes the status of the role of the path and records the change
+func setRoleActive(contx echo.Context, active bool) error {
 
-	// validate path params
-	id, err := strconv.Atoi(contx.Param("role_id"))
-	if err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
+	status := new(models.RoleStatus)
+	if err := contx.Bind(status); err != nil {
+		return common.Fail(contx, err)
 	}
-
-	// validate data struct
-	patch_role := new(models.RolePatch)
-	if err := contx.Bind(&patch_role); err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
+	if err := contx.Validate(status); err != nil {
+		return common.Fail(contx, common.Invalid(err))
 	}
 
-	// then validating
-	if err := validate.Struct(patch_role); err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
-	}
-
-	// startng update transaction
-	var role models.Role
-	role.ID = uint(id)
+	// Get database connection of the role endpoints and start the transaction
+	db := Roles.session()
 	tx := db.Begin()
 
-	// Check if the record exists
-	if err := db.First(&role, role.ID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			// If the record doesn't exist, return an error response
-			tx.Rollback()
-			return contx.JSON(http.StatusNotFound, common.ResponseHTTP{
-				Success: false,
-				Message: "Role not found",
-				Data:    nil,
-			})
-		}
-		// If there's an unexpected error, return an internal server error response
+	role, err := Roles.find(contx, tx)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, err)
+	}
+
+	if role.Active == active {
 		tx.Rollback()
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
+		if active {
+			return common.Fail(contx, common.Conflict("role.already_active"))
+		}
+		return common.Fail(contx, common.Conflict("role.already_inactive"))
 	}
 
-	// Update the record
-	if err := db.Model(&role).UpdateColumns(*patch_role).Error; err != nil {
+	if err := switchRoleStatus(contx, tx, role, active, status.Reason); err != nil {
 		tx.Rollback()
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
+		return common.Fail(contx, common.Internal("role.update_failed", err))
 	}
 
-	// Return  success response
-	return contx.JSON(http.StatusOK, common.ResponseHTTP{
+	if err := tx.Commit().Error; err != nil {
+		return common.Fail(contx, common.Internal("role.update_failed", err))
+	}
+
+	message := "role.deactivated"
+	if active {
+		message = "role.activated"
+	}
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
 		Success: true,
-		Message: "Role updated successfully.",
-		Data:    role,
+		Message: message,
+		Data:    roleGet(*role),
 	})
 }
 
-// DeleteRoles function removes a role by ID
-// @Summary Remove Role by ID
-// @Description Remove role by ID
+// switchRoleStatus sets the status of role inside tx and records who changed it and why
+func switchRoleStatus(contx echo.Context, tx *gorm.DB, role *models.Role, active bool, reason string) error {
+	change := models.RoleStatusChange{
+		RoleID: role.ID,
+		Active: active,
+		Reason: reason,
+		Actor:  middlewares.Actor(contx),
+	}
+	if err := tx.Model(role).UpdateColumn("active", active).Error; err != nil {
+		return err
+	}
+	role.Active = active
+	return tx.Create(&change).Error
+}
+
+// AddRoleChild puts a role inside another, the parent then holds every permission of the child
+// @Summary Add child Role
+// @Description Put the child role inside the role, a role cannot end up inside itself
 // @Tags Role
 // @Security ApiKeyAuth
 // @Accept json
 // @Produce json
-// @Param id path int true "Role ID"
-// @Success 200 {object} common.ResponseHTTP{}
-// @Failure 404 {object} common.ResponseHTTP{}
-// @Failure 503 {object} common.ResponseHTTP{}
-// @Router /role/{role_id} [delete]
-func DeleteRole(contx echo.Context) error {
+// @Param role_id path int true "Role ID"
+// @Param child_id path int true "Child Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleTree}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Router /role/{role_id}/child/{child_id} [post]
+func AddRoleChild(contx echo.Context) error {
+	return changeRoleChild(contx, true)
+}
 
-	// get deleted role attributes to return
-	var role models.Role
+// DeleteRoleChild takes a role out of another
+// @Summary Remove child Role
+// @Description Take the child role out of the role
+// @Tags Role
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param role_id path int true "Role ID"
+// @Param child_id path int true "Child Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleTree}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Router /role/{role_id}/child/{child_id} [delete]
+func DeleteRoleChild(contx echo.Context) error {
+	return changeRoleChild(contx, false)
+}
+
+// changeRoleChild appends or removes the role_children row for the path params
+func changeRoleChild(contx echo.Context, add bool) error {
 
 	// validate path params
-	id, err := strconv.Atoi(contx.Param("role_id"))
+	child_id, err := strconv.Atoi(contx.Param("child_id"))
 	if err != nil {
-		return contx.JSON(http.StatusBadRequest, common.ResponseHTTP{
-			Success: false,
-			Message: err.Error(),
-			Data:    nil,
-		})
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "child_id"}))
 	}
 
-	// Getting Database connection
-	db := database.ReturnSession()
-
-	// perform delete operation if the object exists
+	// Get database connection of the role endpoints and start the transaction
+	db := Roles.session()
 	tx := db.Begin()
 
-	// first getting role and checking if it exists
-	if err := db.Where("id = ?", id).First(&role).Error; err != nil {
+	// checking both sides of the relation exist
+	role, err := Roles.find(contx, tx)
+	if err != nil {
+		tx.Rollback()
+		return common.Fail(contx, err)
+	}
+	var child models.Role
+	if err := tx.Where("id = ?", child_id).First(&child).Error; err != nil {
 		tx.Rollback()
 		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return contx.JSON(http.StatusNotFound, common.ResponseHTTP{
-				Success: false,
-				Message: "Role not found",
-				Data:    nil,
-			})
+			return common.Fail(contx, common.NotFound("role.not_found"))
 		}
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: false,
-			Message: "Error retrieving role",
-			Data:    nil,
-		})
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
 	}
 
-	// Delete the role
-	if err := db.Delete(&role).Error; err != nil {
+	// a role inside one of its descendants would hold its own permissions in a loop
+	message := "role.child_added"
+	association := tx.Model(role).Association("Children")
+	if add {
+		var cycle bool
+		if cycle, err = models.CreatesCycle(tx, role.ID, child.ID); err != nil {
+			tx.Rollback()
+			return common.Fail(contx, common.Internal("role.update_failed", err))
+		}
+		if cycle {
+			tx.Rollback()
+			return common.Fail(contx, common.Conflict("role.cycle").With(i18n.Params{"role": role.Name, "child": child.Name}))
+		}
+		err = association.Append(&child)
+	} else {
+		err = association.Delete(&child)
+		message = "role.child_removed"
+	}
+	if err != nil {
 		tx.Rollback()
-		return contx.JSON(http.StatusInternalServerError, common.ResponseHTTP{
-			Success: false,
-			Message: "Error deleting role",
-			Data:    nil,
-		})
+		return common.Fail(contx, common.Internal("role.update_failed", err))
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return common.Fail(contx, common.Internal("role.update_failed", err))
 	}
 
-	// Commit the transaction
-	tx.Commit()
+	// returning the hierarchy around the role as it now stands
+	tree, err := models.BuildRoleTree(db, roleGet(*role))
+	if err != nil {
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
+	}
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: message,
+		Data:    tree,
+	})
+}
+
+// GetRoleTree returns the roles containing a role and the roles it contains
+// @Summary Get Role tree
+// @Description Get the ancestors of a role nested under parents and its descendants nested under children
+// @Tags Role
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param role_id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleTree}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Router /role/{role_id}/tree [get]
+func GetRoleTree(contx echo.Context) error {
+
+	//  Getting Database connection
+	db := Roles.session()
+
+	role, err := Roles.find(contx, db)
+	if err != nil {
+		return common.Fail(contx, err)
+	}
 
-	// Return success respons
-	return contx.JSON(http.StatusOK, common.ResponseHTTP{
+	tree, err := models.BuildRoleTree(db, roleGet(*role))
+	if err != nil {
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
+	}
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
 		Success: true,
-		Message: "Role deleted successfully.",
-		Data:    role,
+		Message: "role.retrieved",
+		Data:    tree,
 	})
 }
+
+// roleGet is the representation of a role without its associations
+func roleGet(role models.Role) models.RoleGet {
+	return models.RoleGet{ID: role.ID, Name: role.Name, Description: role.Description, Active: role.Active}
+}
+
+// DeleteRoles function removes a role by ID
+// @Summary Remove Role by ID
+// @Description Remove role by ID
+// @Tags Role
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=RoleGet}
+// @Failure 404 {object} common.Problem
+// @Failure 503 {object} common.Problem
+// @Router /role/{role_id} [delete]
+func DeleteRole(contx echo.Context) error {
+	return Roles.Delete(contx)
+}
@@ -0,0 +1,577 @@
+package controlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/mitchellh/mapstructure"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/common"
+	"semay.com/database"
+	"semay.com/i18n"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+// GetUsers is a function to get a Users by ID
+// @Summary Get Users
+// @Description Get Users
+// @Tags User
+// @Accept json
+// @Produce json
+// @Security ApiKeyAuth
+// @Security Refresh
+// @Param page query int false "page"
+// @Param size query int false "page size"
+// @Param cursor query string false "cursor of the keyset mode"
+// @Param limit query int false "page size of the keyset mode"
+// @Param sort query string false "sort fields e.g. -name,id, - prefix for descending"
+// @Param filter query string false "filters as filter[field][operator]=value, e.g. filter[name][ilike]=adm"
+// @Param fields query string false "fields to return e.g. id,name, all of them when left out"
+// @Success 200 {object} common.ResponsePagination{data=[]UserGet}
+// @Failure 404 {object} common.Problem
+// @Router /user [get]
+func GetUsers(contx echo.Context) error {
+
+	//  Getting Database connection
+	db := database.ReturnSession()
+
+	//  querying result with pagination using gorm function
+	result, err := listPage[models.UserGet](contx, db.Model(&models.User{}), userList)
+	if err != nil {
+		if errors.Is(err, common.ErrInvalidQuery) {
+			return common.Fail(contx, err)
+		}
+		return common.Fail(contx, common.Internal("user.list_failed", err))
+	}
+
+	// returning result if all the above completed successfully
+	return common.Respond(contx, http.StatusOK, result)
+}
+
+// GetUserByID is a function to get a Users by ID
+// @Summary Get User by ID
+// @Description Get user by ID
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Param fields query string false "fields to return e.g. id,name, all of them when left out"
+// @Success 200 {object} common.ResponseHTTP{data=UserGet}
+// @Failure 404 {object} common.Problem
+// @Router /user/{user_id} [get]
+func GetUserByID(contx echo.Context) error {
+
+	//  parsing Query Prameters
+	id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+
+	// only the asked fields are read and returned
+	fieldset, err := common.ParseFields(contx.QueryParam("fields"), models.UserGet{})
+	if err != nil {
+		return common.Fail(contx, err)
+	}
+
+	//  Getting Database connection
+	db := database.ReturnSession()
+	query, err := fieldset.Select(db.Model(&models.User{}))
+	if err != nil {
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	// Preparing and querying database using Gorm
+	var users_get models.UserGet
+	var users models.User
+	if res := query.Preload(clause.Associations).Where("id = ?", id).First(&users); res.Error != nil {
+		if errors.Is(res.Error, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", res.Error))
+	}
+
+	// filtering response data according to filtered defined struct
+	mapstructure.Decode(users, &users_get)
+	data, err := fieldset.Shape(&users_get)
+	if err != nil {
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	//  Finally returing response if All the above compeleted successfully
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "user.retrieved",
+		Data:    data,
+	})
+}
+
+// Add User to data
+// @Summary Add a new User
+// @Description Add User
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param user body UserPost true "Add User"
+// @Success 200 {object} common.ResponseHTTP{data=UserGet}
+// @Failure 400 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Failure 500 {object} common.Problem
+// @Router /user [post]
+func PostUser(contx echo.Context) error {
+	//  parsing Query Prameters
+	db := database.ReturnSession()
+
+	//validating post data
+	posted_user := new(models.UserPost)
+
+	//first parse request data
+	if err := contx.Bind(&posted_user); err != nil {
+		return common.Fail(contx, err)
+	}
+
+	// then validate structure
+	if err := contx.Validate(posted_user); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	// new passwords have to follow the password policy
+	if err := utils.PasswordPolicyFromEnv().Validate(posted_user.Password, nil); err != nil {
+		return passwordRejected(contx, err)
+	}
+
+	//  initiate -> user, only the password hash is stored
+	user := new(models.User)
+	user.Email = posted_user.Email
+	user.Locale = posted_user.Locale
+	user.Password = utils.HashFunc(posted_user.Password)
+	user.UUID = uuid.New().String()
+
+	//  start transaction to database
+	tx := db.Begin()
+
+	// add  data using transaction if values are valid
+	if err := tx.Create(&user).Error; err != nil {
+		tx.Rollback()
+		if common.IsDuplicate(err) {
+			return common.Fail(contx, common.Conflict("user.exists"))
+		}
+		return common.Fail(contx, common.Internal("user.create_failed", err))
+	}
+
+	// close transaction
+	tx.Commit()
+
+	// filtering response data according to filtered defined struct
+	var user_get models.UserGet
+	mapstructure.Decode(user, &user_get)
+
+	// return data if transaction is sucessfull
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "user.created",
+		Data:    user_get,
+	})
+}
+
+// Patch User to data
+// @Summary Patch User
+// @Description Patch User
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param user body UserPatch true "Patch User"
+// @Param id path int true "User ID"
+// @Success 200 {object} common.ResponseHTTP{data=UserGet}
+// @Failure 400 {object} common.Problem
+// @Failure 409 {object} common.Problem
+// @Failure 500 {object} common.Problem
+// @Router /user/{user_id} [patch]
+func PatchUser(contx echo.Context) error {
+
+	// Get database connection
+	db := database.ReturnSession()
+
+	// validate path params
+	id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+
+	// validate data struct
+	patch_user := new(models.UserPatch)
+	if err := contx.Bind(&patch_user); err != nil {
+		return common.Fail(contx, err)
+	}
+	patch_user.ID = uint(id)
+
+	// then validating, the unique rules leave the user itself out
+	if err := contx.Validate(patch_user); err != nil {
+		return common.Fail(contx, common.Invalid(err))
+	}
+
+	// startng update transaction
+	var user models.User
+	user.ID = uint(id)
+	tx := db.Begin()
+
+	// Check if the record exists
+	if err := tx.First(&user, user.ID).Error; err != nil {
+		tx.Rollback()
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// If the record doesn't exist, return an error response
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		// If there's an unexpected error, return an internal server error response
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	// only the hash of a changed password is written, after checking it against the policy and history
+	update_user := models.User{Email: patch_user.Email, Locale: patch_user.Locale}
+	if patch_user.Password != "" {
+		policy := utils.PasswordPolicyFromEnv()
+		previous, err := previousPasswords(tx, user, policy.History)
+		if err == nil {
+			err = policy.Validate(patch_user.Password, previous)
+		}
+		if err == nil {
+			err = rememberPassword(tx, user, policy.History)
+		}
+		if err != nil {
+			tx.Rollback()
+			return passwordRejected(contx, err)
+		}
+		update_user.Password = utils.HashFunc(patch_user.Password)
+	}
+
+	// Update the record
+	if err := tx.Model(&user).UpdateColumns(update_user).Error; err != nil {
+		tx.Rollback()
+		if common.IsDuplicate(err) {
+			return common.Fail(contx, common.Conflict("user.exists"))
+		}
+		return common.Fail(contx, common.Internal("user.update_failed", err))
+	}
+
+	// active is written on its own as false would be skipped as a zero value
+	if patch_user.Active != nil {
+		if err := tx.Model(&user).UpdateColumn("active", *patch_user.Active).Error; err != nil {
+			tx.Rollback()
+			return common.Fail(contx, common.Internal("user.update_failed", err))
+		}
+	}
+	tx.Commit()
+
+	// tokens issued with the old password or to a disabled user stop working
+	if patch_user.Password != "" || (patch_user.Active != nil && !*patch_user.Active) {
+		if _, err := utils.TokenRevocations.RevokeAll(user.UUID); err != nil {
+			return common.Fail(contx, common.Internal("user.tokens_revoke_failed", err))
+		}
+	}
+
+	// reloading the user as it is now stored
+	if err := db.Preload(clause.Associations).First(&user, user.ID).Error; err != nil {
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+	var user_get models.UserGet
+	mapstructure.Decode(user, &user_get)
+
+	// Return  success response
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "user.updated",
+		Data:    user_get,
+	})
+}
+
+// DeleteUsers function removes a user by ID
+// @Summary Remove User by ID
+// @Description Remove user by ID
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "User ID"
+// @Success 200 {object} common.ResponseHTTP{}
+// @Failure 404 {object} common.Problem
+// @Failure 503 {object} common.Problem
+// @Router /user/{user_id} [delete]
+func DeleteUser(contx echo.Context) error {
+
+	// get deleted user attributes to return
+	var user models.User
+
+	// validate path params
+	id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	// first getting user with its roles and checking if it exists, it is answered as it was
+	if err := db.Preload(clause.Associations).Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	// tokens of a deleted user must not outlive it, the generation is bumped while the row still exists
+	if _, err := utils.TokenRevocations.RevokeAll(user.UUID); err != nil {
+		return common.Fail(contx, common.Internal("user.tokens_revoke_failed", err))
+	}
+
+	// shaping the answer before clearing the roles empties them
+	var user_get models.UserGet
+	mapstructure.Decode(user, &user_get)
+
+	// removing role assignments first then the user
+	tx := db.Begin()
+	if err := tx.Model(&user).Association("Roles").Clear(); err != nil {
+		tx.Rollback()
+		return common.Fail(contx, common.Internal("user.delete_failed", err))
+	}
+	if err := tx.Delete(&user).Error; err != nil {
+		tx.Rollback()
+		return common.Fail(contx, common.Internal("user.delete_failed", err))
+	}
+
+	// Commit the transaction
+	tx.Commit()
+
+	// Return success respons
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "user.deleted",
+		Data:    user_get,
+	})
+}
+
+// AddUserRole assigns a role to a user
+// @Summary Assign Role to User
+// @Description Assign Role to User
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param role_id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=UserGet}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Router /user/{user_id}/role/{role_id} [post]
+func AddUserRole(contx echo.Context) error {
+	return changeUserRole(contx, true)
+}
+
+// DeleteUserRole removes a role assignment from a user
+// @Summary Unassign Role from User
+// @Description Unassign Role from User
+// @Tags User
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Param role_id path int true "Role ID"
+// @Success 200 {object} common.ResponseHTTP{data=UserGet}
+// @Failure 400 {object} common.Problem
+// @Failure 404 {object} common.Problem
+// @Router /user/{user_id}/role/{role_id} [delete]
+func DeleteUserRole(contx echo.Context) error {
+	return changeUserRole(contx, false)
+}
+
+// changeUserRole appends or removes the user_roles row for the path params
+func changeUserRole(contx echo.Context, assign bool) error {
+
+	// validate path params
+	user_id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+	role_id, err := strconv.Atoi(contx.Param("role_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "role_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	// checking both sides of the relation exist
+	var user models.User
+	if err := db.Where("id = ?", user_id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+	var role models.Role
+	if err := db.Where("id = ?", role_id).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("role.not_found"))
+		}
+		return common.Fail(contx, common.Internal("role.retrieve_failed", err))
+	}
+
+	// appending or removing the association
+	message := "user.role_assigned"
+	association := db.Model(&user).Association("Roles")
+	if assign {
+		err = association.Append(&role)
+	} else {
+		err = association.Delete(&role)
+		message = "user.role_unassigned"
+	}
+	if err != nil {
+		return common.Fail(contx, common.Internal("user.roles_update_failed", err))
+	}
+
+	// tokens still carrying the removed role are invalidated
+	if !assign {
+		if _, err := utils.TokenRevocations.RevokeAll(user.UUID); err != nil {
+			return common.Fail(contx, common.Internal("user.tokens_revoke_failed", err))
+		}
+	}
+
+	// reloading the user with the current roles
+	var user_get models.UserGet
+	db.Preload(clause.Associations).First(&user, user.ID)
+	mapstructure.Decode(user, &user_get)
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: message,
+		Data:    user_get,
+	})
+}
+
+// RevokeUserTokens invalidates every access token issued to a user so far
+// @Summary Revoke all tokens of a User
+// @Description Revoke all tokens of a User
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} common.ResponseHTTP{}
+// @Failure 404 {object} common.Problem
+// @Router /user/{user_id}/revoke [post]
+func RevokeUserTokens(contx echo.Context) error {
+
+	// validate path params
+	id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	var user models.User
+	if err := db.Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	if _, err := utils.TokenRevocations.RevokeAll(user.UUID); err != nil {
+		return common.Fail(contx, common.Internal("user.tokens_revoke_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "user.tokens_revoked",
+		Data:    nil,
+	})
+}
+
+// previousPasswords returns the current and the remembered password hashes of a user, the most recent first
+func previousPasswords(db *gorm.DB, user models.User, limit int) ([]string, error) {
+	hashes := []string{user.Password}
+	if limit <= 1 {
+		return hashes, nil
+	}
+
+	var history []models.PasswordHistory
+	if err := db.Where("user_id = ?", user.ID).Order("id desc").Limit(limit - 1).Find(&history).Error; err != nil {
+		return nil, err
+	}
+	for _, entry := range history {
+		hashes = append(hashes, entry.Hash)
+	}
+	return hashes, nil
+}
+
+// rememberPassword keeps the hash being replaced, trimming the history to what the policy checks
+func rememberPassword(tx *gorm.DB, user models.User, limit int) error {
+	if limit <= 1 {
+		return tx.Where("user_id = ?", user.ID).Delete(&models.PasswordHistory{}).Error
+	}
+	if err := tx.Create(&models.PasswordHistory{UserID: user.ID, Hash: user.Password}).Error; err != nil {
+		return err
+	}
+
+	var keep []uint
+	if err := tx.Model(&models.PasswordHistory{}).Where("user_id = ?", user.ID).Order("id desc").Limit(limit-1).Pluck("id", &keep).Error; err != nil {
+		return err
+	}
+	return tx.Where("user_id = ? AND id NOT IN ?", user.ID, keep).Delete(&models.PasswordHistory{}).Error
+}
+
+// passwordRejected answers a password the policy refused or could not check
+func passwordRejected(contx echo.Context, err error) error {
+	var policy_error *utils.PasswordPolicyError
+	if errors.As(err, &policy_error) {
+		return common.Fail(contx, common.Validation("password.policy_violated", policy_error.Violations))
+	}
+	return common.Fail(contx, common.Internal("password.check_failed", err))
+}
+
+// UnlockUser clears the failed logins and temporary lockout of a user
+// @Summary Unlock User
+// @Description Clear the failed logins and lockout of a User
+// @Tags User
+// @Security ApiKeyAuth
+// @Produce json
+// @Param user_id path int true "User ID"
+// @Success 200 {object} common.ResponseHTTP{}
+// @Failure 404 {object} common.Problem
+// @Router /user/{user_id}/unlock [post]
+func UnlockUser(contx echo.Context) error {
+
+	// validate path params
+	id, err := strconv.Atoi(contx.Param("user_id"))
+	if err != nil {
+		return common.Fail(contx, common.BadRequest("error.not_a_number").With(i18n.Params{"param": "user_id"}))
+	}
+
+	// Getting Database connection
+	db := database.ReturnSession()
+
+	var user models.User
+	if err := db.Where("id = ?", id).First(&user).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return common.Fail(contx, common.NotFound("user.not_found"))
+		}
+		return common.Fail(contx, common.Internal("user.retrieve_failed", err))
+	}
+
+	if err := resetLoginFailures(db, user); err != nil {
+		return common.Fail(contx, common.Internal("user.unlock_failed", err))
+	}
+
+	return common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+		Success: true,
+		Message: "user.unlocked",
+		Data:    nil,
+	})
+}
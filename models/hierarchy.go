@@ -0,0 +1,131 @@
+package models
+
+import (
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// RoleTree model info
+// @Description RoleTree is a role with the roles containing it (parents) and the roles it contains (children), nested to both ends of the hierarchy.
+// @Description A branch only goes one way, the roles under a parent are left out and so are the other parents of a child.
+type RoleTree struct {
+	RoleGet
+	Parents  []RoleTree `json:"parents,omitempty"`
+	Children []RoleTree `json:"children,omitempty"`
+}
+
+// roleEdge is a row of role_children, the parent holds the permissions of the child
+type roleEdge struct {
+	ParentID uint
+	ChildID  uint
+}
+
+// UNION drops the rows seen before, so the walks end even on a cycle left in the table
+const (
+	descendantEdges = `WITH RECURSIVE edges(parent_id, child_id) AS (
+	SELECT parent_id, child_id FROM role_children WHERE parent_id IN ?
+	UNION
+	SELECT role_children.parent_id, role_children.child_id FROM role_children JOIN edges ON role_children.parent_id = edges.child_id
+) SELECT parent_id, child_id FROM edges`
+
+	ancestorEdges = `WITH RECURSIVE edges(parent_id, child_id) AS (
+	SELECT parent_id, child_id FROM role_children WHERE child_id IN ?
+	UNION
+	SELECT role_children.parent_id, role_children.child_id FROM role_children JOIN edges ON role_children.child_id = edges.parent_id
+) SELECT parent_id, child_id FROM edges`
+
+	// a deactivated role is left out together with the roles only it passes on
+	heldRoles = `WITH RECURSIVE held(id) AS (
+	SELECT id FROM roles WHERE name IN ? AND active = ?
+	UNION
+	SELECT roles.id FROM held JOIN role_children ON role_children.parent_id = held.id JOIN roles ON roles.id = role_children.child_id WHERE roles.active = ?
+) SELECT roles.* FROM roles JOIN held ON held.id = roles.id ORDER BY roles.id`
+)
+
+// EffectiveRoles returns the active roles among names and every active role they contain,
+// down to the bottom of the hierarchy
+func EffectiveRoles(db *gorm.DB, names []string) ([]Role, error) {
+	roles := make([]Role, 0)
+	if len(names) == 0 {
+		return roles, nil
+	}
+	err := db.Raw(heldRoles, names, true, true).Scan(&roles).Error
+	return roles, err
+}
+
+// CreatesCycle tells whether making child a child of parent would close a loop,
+// that is when parent is child itself or already among its descendants
+func CreatesCycle(db *gorm.DB, parent_id uint, child_id uint) (bool, error) {
+	if parent_id == child_id {
+		return true, nil
+	}
+	var edges []roleEdge
+	if err := db.Raw(descendantEdges, []uint{child_id}).Scan(&edges).Error; err != nil {
+		return false, err
+	}
+	for _, edge := range edges {
+		if edge.ChildID == parent_id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// BuildRoleTree reads the ancestors and descendants of role and nests them under it
+func BuildRoleTree(db *gorm.DB, role RoleGet) (RoleTree, error) {
+	var ancestors, descendants []roleEdge
+	if err := db.Raw(ancestorEdges, []uint{role.ID}).Scan(&ancestors).Error; err != nil {
+		return RoleTree{}, err
+	}
+	if err := db.Raw(descendantEdges, []uint{role.ID}).Scan(&descendants).Error; err != nil {
+		return RoleTree{}, err
+	}
+
+	parents := make(map[uint][]uint)
+	children := make(map[uint][]uint)
+	ids := []uint{role.ID}
+	for _, edge := range ancestors {
+		parents[edge.ChildID] = append(parents[edge.ChildID], edge.ParentID)
+		ids = append(ids, edge.ParentID)
+	}
+	for _, edge := range descendants {
+		children[edge.ParentID] = append(children[edge.ParentID], edge.ChildID)
+		ids = append(ids, edge.ChildID)
+	}
+
+	var rows []RoleGet
+	if err := db.Model(&Role{}).Where("id IN ?", ids).Order("id").Find(&rows).Error; err != nil {
+		return RoleTree{}, err
+	}
+	found := make(map[uint]RoleGet, len(rows))
+	for _, row := range rows {
+		found[row.ID] = row
+	}
+
+	tree := RoleTree{RoleGet: role}
+	tree.Parents = branch(found, parents, role.ID, func(node *RoleTree) *[]RoleTree { return &node.Parents }, map[uint]bool{role.ID: true})
+	tree.Children = branch(found, children, role.ID, func(node *RoleTree) *[]RoleTree { return &node.Children }, map[uint]bool{role.ID: true})
+	return tree, nil
+}
+
+// branch nests the roles linked to id in one direction, a role already on the path is not repeated
+// and links to deleted roles, left where the database does not cascade, are skipped
+func branch(found map[uint]RoleGet, links map[uint][]uint, id uint, next func(*RoleTree) *[]RoleTree, path map[uint]bool) []RoleTree {
+	linked_ids := slices.Clone(links[id])
+	slices.Sort(linked_ids)
+
+	nodes := make([]RoleTree, 0, len(linked_ids))
+	for _, linked := range linked_ids {
+		role, ok := found[linked]
+		if !ok || path[linked] {
+			continue
+		}
+		node := RoleTree{RoleGet: role}
+		path[linked] = true
+		*next(&node) = branch(found, links, linked, next, path)
+		delete(path, linked)
+		nodes = append(nodes, node)
+	}
+	return nodes
+}
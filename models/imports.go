@@ -0,0 +1,38 @@
+package models
+
+// import modes, atomic creates every row or none and best effort creates the valid rows
+const (
+	ImportAtomic     = "atomic"
+	ImportBestEffort = "best_effort"
+)
+
+// import row statuses
+const (
+	ImportCreated   = "created"
+	ImportValid     = "valid"
+	ImportInvalid   = "invalid"
+	ImportDuplicate = "duplicate"
+	ImportFailed    = "failed"
+	ImportSkipped   = "skipped"
+)
+
+// ImportReport model info
+// @Description ImportReport is the outcome of an import, row by row
+type ImportReport struct {
+	Mode    string            `json:"mode"`
+	DryRun  bool              `json:"dry_run"`
+	Total   int               `json:"total"`
+	Created int               `json:"created"`
+	Failed  int               `json:"failed"`
+	Rows    []ImportRowReport `json:"rows"`
+}
+
+// ImportRowReport model info
+// @Description ImportRowReport is the outcome of one imported row, line counts from 1 without the CSV header
+type ImportRowReport struct {
+	Line   int      `json:"line"`
+	Name   string   `json:"name,omitempty"`
+	Status string   `json:"status"`
+	ID     uint     `json:"id,omitempty"`
+	Errors []string `json:"errors,omitempty"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"semay.com/database"
+)
+
+// InitDatabase creates or updates the tables of every registered model
+func InitDatabase() error {
+	db := database.ReturnSession()
+
+	err := db.AutoMigrate(
+		&Role{},
+		&RoleStatusChange{},
+		&Permission{},
+		&User{},
+		&APIKey{},
+		&RevokedToken{},
+		&RecoveryCode{},
+		&PasswordHistory{},
+	)
+	if err != nil {
+		return err
+	}
+
+	// full-text indexes live next to the tables they index
+	return RoleSearch.Migrate(db)
+}
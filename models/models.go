@@ -1,19 +1,42 @@
 package models
 
+import "time"
+
 // Role Database model info
 // @Description App type information
 type Role struct {
-	ID          uint   `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
-	Name        string `gorm:"not null; unique;" json:"name,omitempty"`
-	Description string `gorm:"not null; unique;" json:"description,omitempty"`
-	Active      bool   `gorm:"default:true; constraint:not null;" json:"active"`
+	ID          uint         `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty" filter:"eq,in,gt,gte,lt,lte"`
+	Name        string       `gorm:"not null; unique;" json:"name,omitempty" filter:"eq,ne,in,like,ilike"`
+	Description string       `gorm:"not null; unique;" json:"description,omitempty" filter:"like,ilike"`
+	Active      bool         `gorm:"default:true; constraint:not null;" json:"active" filter:"eq"`
+	Permissions []Permission `gorm:"many2many:role_permissions; constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"permissions,omitempty"`
+	// roles contained in this one, a role holds the permissions of its children and theirs
+	Children []Role `gorm:"many2many:role_children; joinForeignKey:ParentID; joinReferences:ChildID; constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"children,omitempty"`
+}
+
+// RoleStatusChange Database model info
+// @Description RoleStatusChange records who activated or deactivated a role and why
+type RoleStatusChange struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
+	RoleID    uint      `gorm:"not null; index;" json:"role_id"`
+	Role      *Role     `gorm:"constraint:OnDelete:CASCADE;" json:"-"`
+	Active    bool      `gorm:"not null;" json:"active"`
+	Reason    string    `gorm:"not null;" json:"reason"`
+	Actor     string    `gorm:"not null;" json:"actor"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RoleStatus model info
+// @Description RoleStatus is the body of the activate and deactivate endpoints
+type RoleStatus struct {
+	Reason string `json:"reason" validate:"required,max=255"`
 }
 
 // RolePost model info
 // @Description RolePost type information
 type RolePost struct {
-	Name        string `gorm:"not null; unique;" json:"name,omitempty"`
-	Description string `gorm:"not null; unique;" json:"description,omitempty"`
+	Name        string `gorm:"not null; unique;" json:"name,omitempty" validate:"required,min=2,max=64,slugsafe,unique=roles.name"`
+	Description string `gorm:"not null; unique;" json:"description,omitempty" validate:"required,max=255,unique=roles.description"`
 }
 
 // RoleGet model info
@@ -28,15 +51,112 @@ type RoleGet struct {
 // RolePut model info
 // @Description RolePut type information
 type RolePut struct {
-	ID          uint   `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
-	Name        string `gorm:"not null; unique;" json:"name,omitempty"`
-	Description string `gorm:"not null; unique;" json:"description,omitempty"`
-	Active      bool   `gorm:"default:true; constraint:not null;" json:"active"`
+	// the replaced role, bound from the path so unique rules skip it
+	ID          uint   `gorm:"-" json:"-" param:"role_id"`
+	Name        string `gorm:"not null; unique;" json:"name,omitempty" validate:"required,min=2,max=64,slugsafe,unique=roles.name"`
+	Description string `gorm:"not null; unique;" json:"description,omitempty" validate:"required,max=255,unique=roles.description"`
+	// a pointer so that leaving it out is told from false, a change is recorded like a deactivation
+	Active *bool `gorm:"constraint:not null;" json:"active" validate:"required"`
 }
 
 // RolePatch model info
 // @Description RolePatch type information
 type RolePatch struct {
+	// the patched role, bound from the path so unique rules skip it
+	ID          uint   `gorm:"-" json:"-" param:"role_id"`
+	Name        string `gorm:"not null; unique;" json:"name,omitempty" validate:"omitempty,min=2,max=64,slugsafe,unique=roles.name"`
+	Description string `gorm:"not null; unique;" json:"description,omitempty" validate:"omitempty,max=255,unique=roles.description"`
+	// a change is recorded like a deactivation, with a default reason
+	Active *bool `gorm:"constraint:not null;" json:"active,omitempty"`
+}
+
+// Permission Database model info
+// @Description App type information
+type Permission struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty" filter:"eq,in,gt,gte,lt,lte"`
+	Name        string `gorm:"not null; unique;" json:"name,omitempty" filter:"eq,ne,in,like,ilike"`
+	Description string `gorm:"not null;" json:"description,omitempty" filter:"like,ilike"`
+	Active      bool   `gorm:"default:true; constraint:not null;" json:"active" filter:"eq"`
+}
+
+// PermissionGet model info
+// @Description PermissionGet type information
+type PermissionGet struct {
+	ID          uint   `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
 	Name        string `gorm:"not null; unique;" json:"name,omitempty"`
-	Description string `gorm:"not null; unique;" json:"description,omitempty"`
+	Description string `gorm:"not null;" json:"description,omitempty"`
+	Active      bool   `gorm:"default:true; constraint:not null;" json:"active"`
+}
+
+// User Database model info
+// @Description App type information
+type User struct {
+	ID       uint   `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty" filter:"eq,in,gt,gte,lt,lte"`
+	Email    string `gorm:"not null; unique;" json:"email,omitempty" filter:"eq,ne,in,like,ilike"`
+	UUID     string `gorm:"not null; unique;" json:"uuid,omitempty"`
+	Password string `gorm:"not null;" json:"-"`
+	Active   bool   `gorm:"default:true; constraint:not null;" json:"active" filter:"eq"`
+	Roles    []Role `gorm:"many2many:user_roles; constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"roles,omitempty"`
+	// bumped to invalidate every token issued to the user so far
+	TokenGeneration uint `gorm:"default:0; not null;" json:"-"`
+	// encrypted TOTP secret, MFA is only enforced once the enrolment is confirmed
+	TOTPSecret   string `json:"-"`
+	TOTPLastStep int64  `gorm:"default:0; not null;" json:"-"`
+	MFAEnabled   bool   `gorm:"default:false; not null;" json:"mfa_enabled" filter:"eq"`
+	// failed logins since the last successful one, the account waits until locked_until
+	FailedLogins int        `gorm:"default:0; not null;" json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+	// language the user's messages are written in, Accept-Language decides when empty
+	Locale string `gorm:"default:''; not null;" json:"locale,omitempty"`
+	// subject of the single sign-on identity the user was provisioned for, nil for local accounts
+	SSOSubject *string `gorm:"unique;" json:"-"`
+	// comma separated roles granted by the provider groups, the other roles were assigned here
+	SSORoles string `gorm:"default:''; not null;" json:"-"`
+}
+
+// UserPost model info
+// @Description UserPost type information
+type UserPost struct {
+	Email    string `json:"email,omitempty" validate:"required,email,unique=users.email"`
+	Password string `json:"password,omitempty" validate:"required"`
+	Locale   string `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag"`
+}
+
+// UserGet model info
+// @Description UserGet type information
+type UserGet struct {
+	ID         uint   `gorm:"primaryKey;autoIncrement:true" json:"id,omitempty"`
+	Email      string `gorm:"not null; unique;" json:"email,omitempty"`
+	UUID       string `gorm:"not null; unique;" json:"uuid,omitempty"`
+	Active     bool   `gorm:"default:true; constraint:not null;" json:"active"`
+	MFAEnabled bool   `json:"mfa_enabled"`
+	Locale     string `json:"locale,omitempty"`
+	// copied from the user's roles, lists scan the rest of the row into it
+	Roles []RoleGet `gorm:"-" json:"roles,omitempty"`
+}
+
+// UserPatch model info
+// @Description UserPatch type information
+type UserPatch struct {
+	// the patched user, bound from the path so unique rules skip it
+	ID       uint   `json:"-" param:"user_id"`
+	Email    string `json:"email,omitempty" validate:"omitempty,email,unique=users.email"`
+	Password string `json:"password,omitempty"`
+	Active   *bool  `json:"active,omitempty"`
+	Locale   string `json:"locale,omitempty" validate:"omitempty,bcp47_language_tag"`
+}
+
+// UserLogin model info
+// @Description UserLogin type information
+type UserLogin struct {
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required"`
+}
+
+// AuthToken model info
+// @Description AuthToken type information
+type AuthToken struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
 }
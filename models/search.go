@@ -0,0 +1,21 @@
+package models
+
+import "semay.com/search"
+
+// RoleSearch is the full-text index behind ?q= on roles
+var RoleSearch = search.Index{Table: "roles", Columns: []string{"name", "description"}}
+
+// RoleSearchResult model info
+// @Description RoleSearchResult is a role found by a search, with its relevance and highlighted matches
+type RoleSearchResult struct {
+	RoleGet
+	Rank      float64       `gorm:"column:search_rank" json:"rank"`
+	Highlight RoleHighlight `gorm:"embedded;embeddedPrefix:highlight_" json:"highlight"`
+}
+
+// RoleHighlight model info
+// @Description RoleHighlight holds the HTML escaped text of each column with the matched words wrapped in <mark>
+type RoleHighlight struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
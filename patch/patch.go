@@ -0,0 +1,331 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// media types of the patch documents
+const (
+	MIMEMergePatch = "application/merge-patch+json"
+	MIMEJSONPatch  = "application/json-patch+json"
+)
+
+var (
+	// ErrInvalid is a patch document that is no valid merge patch or JSON Patch
+	ErrInvalid = errors.New("invalid patch")
+	// ErrTestFailed is a test operation whose value differs from the document
+	ErrTestFailed = errors.New("patch test failed")
+	// ErrUnprocessable is a valid patch that does not fit the document, e.g. a missing path
+	ErrUnprocessable = errors.New("patch cannot be applied")
+)
+
+// Error tells why a patch failed and where, Err is one of ErrInvalid, ErrTestFailed and ErrUnprocessable
+type Error struct {
+	Err    error
+	Path   string
+	Reason string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return fmt.Sprintf("%v: %v", e.Err, e.Reason)
+	}
+	return fmt.Sprintf("%v at %v: %v", e.Err, e.Path, e.Reason)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func failure(err error, path string, reason string, args ...interface{}) *Error {
+	return &Error{Err: err, Path: path, Reason: fmt.Sprintf(reason, args...)}
+}
+
+// Merge applies a JSON merge patch (RFC 7386) to document: members of the patch replace
+// those of the document, objects are merged member by member and null removes a member
+func Merge(document []byte, patch []byte) ([]byte, error) {
+	var target, changes interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(patch, &changes); err != nil {
+		return nil, failure(ErrInvalid, "", "%v", err)
+	}
+	return json.Marshal(merge(target, changes))
+}
+
+func merge(target interface{}, changes interface{}) interface{} {
+	members, ok := changes.(map[string]interface{})
+	if !ok {
+		return changes
+	}
+	object, ok := target.(map[string]interface{})
+	if !ok {
+		object = make(map[string]interface{}, len(members))
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = merge(object[name], value)
+		}
+	}
+	return object
+}
+
+// Operation is one step of a JSON Patch
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies a JSON Patch (RFC 6902) to document. The operations run in order and
+// the first failing one, a test included, fails the whole patch.
+func Apply(document []byte, patch []byte) ([]byte, error) {
+	var target interface{}
+	if err := json.Unmarshal(document, &target); err != nil {
+		return nil, err
+	}
+	var operations []Operation
+	if err := json.Unmarshal(patch, &operations); err != nil {
+		return nil, failure(ErrInvalid, "", "a JSON Patch is an array of operations: %v", err)
+	}
+
+	for _, operation := range operations {
+		var err error
+		if target, err = apply(target, operation); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(target)
+}
+
+// apply runs one operation on target and returns the changed document
+func apply(target interface{}, operation Operation) (interface{}, error) {
+	path, err := pointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	var value interface{}
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, failure(ErrInvalid, operation.Path, "%v needs a value", operation.Op)
+		}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, failure(ErrInvalid, operation.Path, "%v", err)
+		}
+	case "move", "copy":
+		from, err := pointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		if value, err = get(target, from, operation.From); err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if strings.HasPrefix(operation.Path+"/", operation.From+"/") && operation.Path != operation.From {
+				return nil, failure(ErrInvalid, operation.Path, "a value cannot be moved into itself")
+			}
+			if target, err = remove(target, from, operation.From); err != nil {
+				return nil, err
+			}
+		} else {
+			value = clone(value)
+		}
+	case "remove":
+	default:
+		return nil, failure(ErrInvalid, operation.Path, "%q is not an operation", operation.Op)
+	}
+
+	switch operation.Op {
+	case "add", "move", "copy":
+		return add(target, path, operation.Path, value)
+	case "remove":
+		return remove(target, path, operation.Path)
+	case "replace":
+		if len(path) == 0 {
+			return value, nil
+		}
+		if _, err := get(target, path, operation.Path); err != nil {
+			return nil, err
+		}
+		if target, err = remove(target, path, operation.Path); err != nil {
+			return nil, err
+		}
+		return add(target, path, operation.Path, value)
+	default:
+		current, err := get(target, path, operation.Path)
+		if err != nil {
+			return nil, err
+		}
+		if !reflect.DeepEqual(current, value) {
+			return nil, failure(ErrTestFailed, operation.Path, "the value is %v", current)
+		}
+		return target, nil
+	}
+}
+
+// pointer splits a JSON pointer (RFC 6901) into its unescaped tokens
+func pointer(path string) ([]string, error) {
+	if path == "" {
+		return []string{}, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, failure(ErrInvalid, path, "a path starts with /")
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+// index reads an array index token, end allows the index one past the last element
+func index(token string, length int, end bool, path string) (int, error) {
+	if token == "-" && end {
+		return length, nil
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, failure(ErrUnprocessable, path, "%q is not an array index", token)
+	}
+	if i > length || (i == length && !end) {
+		return 0, failure(ErrUnprocessable, path, "index %v is out of range", i)
+	}
+	return i, nil
+}
+
+// get reads the value at tokens
+func get(target interface{}, tokens []string, path string) (interface{}, error) {
+	for _, token := range tokens {
+		switch container := target.(type) {
+		case map[string]interface{}:
+			value, ok := container[token]
+			if !ok {
+				return nil, failure(ErrUnprocessable, path, "%q is missing", token)
+			}
+			target = value
+		case []interface{}:
+			i, err := index(token, len(container), false, path)
+			if err != nil {
+				return nil, err
+			}
+			target = container[i]
+		default:
+			return nil, failure(ErrUnprocessable, path, "%q is not in an object or array", token)
+		}
+	}
+	return target, nil
+}
+
+// update changes the container holding the last token with change and returns the changed document
+func update(target interface{}, tokens []string, path string, change func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return change(target, tokens[0])
+	}
+	switch container := target.(type) {
+	case map[string]interface{}:
+		value, ok := container[tokens[0]]
+		if !ok {
+			return nil, failure(ErrUnprocessable, path, "%q is missing", tokens[0])
+		}
+		changed, err := update(value, tokens[1:], path, change)
+		if err != nil {
+			return nil, err
+		}
+		container[tokens[0]] = changed
+		return container, nil
+	case []interface{}:
+		i, err := index(tokens[0], len(container), false, path)
+		if err != nil {
+			return nil, err
+		}
+		changed, err := update(container[i], tokens[1:], path, change)
+		if err != nil {
+			return nil, err
+		}
+		container[i] = changed
+		return container, nil
+	default:
+		return nil, failure(ErrUnprocessable, path, "%q is not in an object or array", tokens[0])
+	}
+}
+
+// add puts value at tokens, inserting it in arrays and replacing object members
+func add(target interface{}, tokens []string, path string, value interface{}) (interface{}, error) {
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(target, tokens, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			container[token] = value
+			return container, nil
+		case []interface{}:
+			i, err := index(token, len(container), true, path)
+			if err != nil {
+				return nil, err
+			}
+			container = append(container, nil)
+			copy(container[i+1:], container[i:])
+			container[i] = value
+			return container, nil
+		default:
+			return nil, failure(ErrUnprocessable, path, "%q is not in an object or array", token)
+		}
+	})
+}
+
+// remove takes out the value at tokens
+func remove(target interface{}, tokens []string, path string) (interface{}, error) {
+	if len(tokens) == 0 {
+		return nil, failure(ErrUnprocessable, path, "the whole document cannot be removed")
+	}
+	return update(target, tokens, path, func(container interface{}, token string) (interface{}, error) {
+		switch container := container.(type) {
+		case map[string]interface{}:
+			if _, ok := container[token]; !ok {
+				return nil, failure(ErrUnprocessable, path, "%q is missing", token)
+			}
+			delete(container, token)
+			return container, nil
+		case []interface{}:
+			i, err := index(token, len(container), false, path)
+			if err != nil {
+				return nil, err
+			}
+			return append(container[:i], container[i+1:]...), nil
+		default:
+			return nil, failure(ErrUnprocessable, path, "%q is not in an object or array", token)
+		}
+	})
+}
+
+// clone deep copies a decoded JSON value so a copy does not share objects or arrays with its source
+func clone(value interface{}) interface{} {
+	switch value := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for name, member := range value {
+			copied[name] = clone(member)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, element := range value {
+			copied[i] = clone(element)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,264 @@
+package search
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// markers put around matched words in the highlights
+const (
+	markStart = "<mark>"
+	markStop  = "</mark>"
+	// control characters standing for the markers until the text around them is escaped
+	sentinelStart = "\x02"
+	sentinelStop  = "\x03"
+	// most query words a search uses
+	maxTerms = 8
+)
+
+// htmlEscapes are applied in order, & first so the entities written after are left alone
+var htmlEscapes = [][2]string{
+	{"&", "&amp;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}, {"'", "&#39;"},
+	{sentinelStart, markStart}, {sentinelStop, markStop},
+}
+
+// escapedHighlight wraps the SQL expression of a highlight so the stored text comes back
+// HTML escaped and only the mark tags are markup
+func escapedHighlight(expression string) string {
+	for _, escape := range htmlEscapes {
+		expression = fmt.Sprintf("replace(%v, '%v', '%v')", expression, strings.ReplaceAll(escape[0], "'", "''"), escape[1])
+	}
+	return expression
+}
+
+// Index is the full-text index of some text columns of a table.
+//
+// On postgres it is a stored tsvector column with a GIN index. On sqlite it is an FTS5
+// virtual table kept in sync by triggers, FTS5 needs the binary built with -tags sqlite_fts5 as the Makefile does.
+// Without FTS5 searches fall back to LIKE matching without ranking quality or highlights.
+//
+// Searched queries select the table columns, or those selected before, plus search_rank (higher is more relevant)
+// and highlight_<column> for every indexed column. Highlights are HTML escaped text with the matches in <mark>.
+type Index struct {
+	Table   string
+	Columns []string
+}
+
+func (i Index) ftsTable() string {
+	return i.Table + "_fts"
+}
+
+// Migrate creates the index and what keeps it in sync with the table
+func (i Index) Migrate(db *gorm.DB) error {
+	switch db.Dialector.Name() {
+	case "postgres":
+		return i.migratePostgres(db)
+	case "sqlite":
+		return i.migrateSQLite(db)
+	}
+	return nil
+}
+
+func (i Index) migratePostgres(db *gorm.DB) error {
+	// names weigh more than the columns after them
+	weights := []string{"A", "B", "C", "D"}
+	parts := make([]string, 0, len(i.Columns))
+	for n, column := range i.Columns {
+		weight := weights[len(weights)-1]
+		if n < len(weights) {
+			weight = weights[n]
+		}
+		parts = append(parts, fmt.Sprintf("setweight(to_tsvector('simple', coalesce(%v, '')), '%v')", column, weight))
+	}
+
+	statements := []string{
+		fmt.Sprintf("ALTER TABLE %v ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (%v) STORED",
+			i.Table, strings.Join(parts, " || ")),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%v_search_vector ON %v USING GIN (search_vector)", i.Table, i.Table),
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("error creating search index of %v: %v", i.Table, err)
+		}
+	}
+	return nil
+}
+
+func (i Index) migrateSQLite(db *gorm.DB) error {
+	fts := i.ftsTable()
+	columns := strings.Join(i.Columns, ", ")
+	new_values := "new." + strings.Join(i.Columns, ", new.")
+	old_values := "old." + strings.Join(i.Columns, ", old.")
+
+	var existing int64
+	if err := db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", fts).Scan(&existing).Error; err != nil {
+		return err
+	}
+
+	err := db.Exec(fmt.Sprintf("CREATE VIRTUAL TABLE IF NOT EXISTS %v USING fts5(%v, content='%v', content_rowid='id')", fts, columns, i.Table)).Error
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			log.Printf("sqlite is built without fts5, searching %v falls back to LIKE", i.Table)
+			return nil
+		}
+		return fmt.Errorf("error creating search index of %v: %v", i.Table, err)
+	}
+
+	statements := []string{
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]v_ai AFTER INSERT ON %[2]v BEGIN
+			INSERT INTO %[1]v(rowid, %[3]v) VALUES (new.id, %[4]v);
+		END`, fts, i.Table, columns, new_values),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]v_ad AFTER DELETE ON %[2]v BEGIN
+			INSERT INTO %[1]v(%[1]v, rowid, %[3]v) VALUES ('delete', old.id, %[4]v);
+		END`, fts, i.Table, columns, old_values),
+		fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]v_au AFTER UPDATE ON %[2]v BEGIN
+			INSERT INTO %[1]v(%[1]v, rowid, %[3]v) VALUES ('delete', old.id, %[4]v);
+			INSERT INTO %[1]v(rowid, %[3]v) VALUES (new.id, %[5]v);
+		END`, fts, i.Table, columns, old_values, new_values),
+	}
+	// rows written before the index existed are indexed once
+	if existing == 0 {
+		statements = append(statements, fmt.Sprintf("INSERT INTO %[1]v(%[1]v) VALUES ('rebuild')", fts))
+	}
+	for _, statement := range statements {
+		if err := db.Exec(statement).Error; err != nil {
+			return fmt.Errorf("error creating search index of %v: %v", i.Table, err)
+		}
+	}
+
+	ftsTables.Delete(fts)
+	return nil
+}
+
+// Terms splits the words of a search, anything but letters and digits separates them.
+// It is nil when q has no words.
+func Terms(q string) []string {
+	terms := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(terms) == 0 {
+		return nil
+	}
+	if len(terms) > maxTerms {
+		terms = terms[:maxTerms]
+	}
+	return terms
+}
+
+// Apply narrows query to the rows matching every word of q, as prefixes, and selects
+// their rank and highlights. It does not order, callers order by search_rank when relevance is wanted.
+func (i Index) Apply(query *gorm.DB, q string) *gorm.DB {
+	terms := Terms(q)
+	if len(terms) == 0 {
+		return query
+	}
+
+	switch query.Dialector.Name() {
+	case "postgres":
+		return i.applyPostgres(query, terms)
+	case "sqlite":
+		if i.hasFTS(query) {
+			return i.applySQLite(query, terms)
+		}
+	}
+	return i.applyLike(query, terms)
+}
+
+// baseSelects are the table columns a search reads, the ones selected before or all of them
+func (i Index) baseSelects(query *gorm.DB) []string {
+	if len(query.Statement.Selects) > 0 {
+		return append([]string{}, query.Statement.Selects...)
+	}
+	return []string{i.Table + ".*"}
+}
+
+func (i Index) applyPostgres(query *gorm.DB, terms []string) *gorm.DB {
+	// adm off -> adm:* & off:*
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, term+":*")
+	}
+
+	options := fmt.Sprintf("StartSel=%v, StopSel=%v, MaxWords=16, MinWords=8, HighlightAll=false", sentinelStart, sentinelStop)
+	selects := append(i.baseSelects(query), fmt.Sprintf("ts_rank(%v.search_vector, search_query) AS search_rank", i.Table))
+	for _, column := range i.Columns {
+		headline := fmt.Sprintf("ts_headline('simple', coalesce(%v.%v, ''), search_query, '%v')", i.Table, column, options)
+		selects = append(selects, fmt.Sprintf("%v AS highlight_%v", escapedHighlight(headline), column))
+	}
+
+	return query.
+		Select(strings.Join(selects, ", ")).
+		Joins(fmt.Sprintf("JOIN to_tsquery('simple', ?) AS search_query ON %v.search_vector @@ search_query", i.Table), strings.Join(prefixes, " & "))
+}
+
+func (i Index) applySQLite(query *gorm.DB, terms []string) *gorm.DB {
+	// adm off -> "adm"* "off"*, quoted so no word is read as FTS5 syntax
+	prefixes := make([]string, 0, len(terms))
+	for _, term := range terms {
+		prefixes = append(prefixes, `"`+strings.ReplaceAll(term, `"`, `""`)+`"*`)
+	}
+
+	fts := i.ftsTable()
+	// bm25 is lower for better matches
+	matches := []string{"rowid AS search_id", fmt.Sprintf("-bm25(%v) AS search_rank", fts)}
+	selects := append(i.baseSelects(query), "search.search_rank")
+	for n, column := range i.Columns {
+		snippet := fmt.Sprintf("snippet(%v, %v, '%v', '%v', '…', 16)", fts, n, sentinelStart, sentinelStop)
+		matches = append(matches, fmt.Sprintf("%v AS highlight_%v", escapedHighlight(snippet), column))
+		selects = append(selects, "search.highlight_"+column)
+	}
+
+	return query.
+		Select(strings.Join(selects, ", ")).
+		Joins(fmt.Sprintf("JOIN (SELECT %v FROM %v WHERE %v MATCH ?) AS search ON search.search_id = %v.id",
+			strings.Join(matches, ", "), fts, fts, i.Table), strings.Join(prefixes, " "))
+}
+
+// applyLike matches with LIKE, ranking rows by how many columns matched
+func (i Index) applyLike(query *gorm.DB, terms []string) *gorm.DB {
+	rank := make([]string, 0, len(i.Columns))
+	selects := i.baseSelects(query)
+	for _, column := range i.Columns {
+		rank = append(rank, fmt.Sprintf("(CASE WHEN LOWER(%v.%v) LIKE @first ESCAPE '\\' THEN 1 ELSE 0 END)", i.Table, column))
+		selects = append(selects, fmt.Sprintf("%v AS highlight_%v", escapedHighlight(fmt.Sprintf("coalesce(%v.%v, '')", i.Table, column)), column))
+	}
+	selects = append(selects, strings.Join(rank, " + ")+" AS search_rank")
+
+	query = query.Select(strings.Join(selects, ", "), map[string]interface{}{"first": "%" + escapeLike(terms[0]) + "%"})
+	// the named select is a clause of its own, columns selected before are part of it now
+	query.Statement.Selects = nil
+	for _, term := range terms {
+		matches := make([]string, 0, len(i.Columns))
+		for _, column := range i.Columns {
+			matches = append(matches, fmt.Sprintf(`LOWER(%v.%v) LIKE @term ESCAPE '\'`, i.Table, column))
+		}
+		query = query.Where("("+strings.Join(matches, " OR ")+")", map[string]interface{}{"term": "%" + escapeLike(term) + "%"})
+	}
+	return query
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// sqlite databases with the fts table of an index, checked once per table
+var ftsTables sync.Map
+
+func (i Index) hasFTS(query *gorm.DB) bool {
+	fts := i.ftsTable()
+	if found, ok := ftsTables.Load(fts); ok {
+		return found.(bool)
+	}
+
+	var count int64
+	err := query.Session(&gorm.Session{NewDB: true}).
+		Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", fts).Scan(&count).Error
+	found := err == nil && count > 0
+	ftsTables.Store(fts, found)
+	return found
+}
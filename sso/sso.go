@@ -0,0 +1,278 @@
+package sso
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+	"semay.com/configs"
+)
+
+var (
+	ErrNotConfigured = errors.New("oidc provider is not configured")
+	ErrInvalidState  = errors.New("unknown or expired oidc state")
+	ErrInvalidNonce  = errors.New("id token nonce mismatch")
+	ErrMissingEmail  = errors.New("id token has no verified email")
+)
+
+// how long a started login may take to come back to the callback
+const PendingLifeTime = 10 * time.Minute
+
+// StateCookie holds the signed pending login in the browser that started it
+const StateCookie = "oidc_login"
+
+// Config of the OpenID Connect provider the admins log in with
+type Config struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// claim of the id token listing the provider groups of the user
+	GroupsClaim string
+	// provider group to local role name, groups not listed grant no role
+	GroupRoles map[string]string
+	// key signing the pending login kept in the browser cookie
+	StateKey string
+}
+
+// ConfigFromEnv reads the OIDC_* settings
+func ConfigFromEnv() Config {
+	config := Config{
+		IssuerURL:    configs.AppConfig.Get("OIDC_ISSUER_URL"),
+		ClientID:     configs.AppConfig.Get("OIDC_CLIENT_ID"),
+		ClientSecret: configs.AppConfig.Get("OIDC_CLIENT_SECRET"),
+		RedirectURL:  configs.AppConfig.Get("OIDC_REDIRECT_URL"),
+		Scopes:       strings.Split(configs.AppConfig.GetOrDefault("OIDC_SCOPES", "email,profile,groups"), ","),
+		GroupsClaim:  configs.AppConfig.GetOrDefault("OIDC_GROUPS_CLAIM", "groups"),
+		GroupRoles:   make(map[string]string),
+		StateKey:     configs.AppConfig.Get("SECRETE_SALT"),
+	}
+
+	// OIDC_GROUP_ROLES="provider-admins:superuser,provider-devs:viewer"
+	for _, pair := range strings.Split(configs.AppConfig.Get("OIDC_GROUP_ROLES"), ",") {
+		group, role, found := strings.Cut(strings.TrimSpace(pair), ":")
+		if found && group != "" && role != "" {
+			config.GroupRoles[group] = role
+		}
+	}
+	return config
+}
+
+// Identity is what the provider vouched for about the user
+type Identity struct {
+	Subject string
+	Email   string
+	Groups  []string
+}
+
+// pendingLogin is kept in the browser between the redirect to the provider and the callback,
+// signed so any instance can check it and tied to the browser so a login can not be planted in another
+type pendingLogin struct {
+	State     string `json:"state"`
+	Nonce     string `json:"nonce"`
+	Verifier  string `json:"verifier"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// Client is a relying party using the authorization code flow with PKCE
+type Client struct {
+	config   Config
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewClient discovers the provider endpoints and signing keys from its issuer URL
+func NewClient(ctx context.Context, config Config) (*Client, error) {
+	if config.IssuerURL == "" || config.ClientID == "" || config.StateKey == "" {
+		return nil, ErrNotConfigured
+	}
+
+	provider, err := oidc.NewProvider(ctx, config.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("error discovering oidc provider: %v", err)
+	}
+
+	scopes := []string{oidc.ScopeOpenID}
+	for _, scope := range config.Scopes {
+		if scope = strings.TrimSpace(scope); scope != "" && scope != oidc.ScopeOpenID {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return &Client{
+		config: config,
+		oauth: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// AuthCodeURL starts a login, returning the provider URL to redirect the browser to
+// and the value of the StateCookie to set on it
+func (c *Client) AuthCodeURL() (string, string, error) {
+	state, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return "", "", err
+	}
+	login := pendingLogin{
+		State:     state,
+		Nonce:     nonce,
+		Verifier:  oauth2.GenerateVerifier(),
+		ExpiresAt: time.Now().Add(PendingLifeTime).Unix(),
+	}
+
+	cookie, err := c.sign(login)
+	if err != nil {
+		return "", "", err
+	}
+	return c.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(login.Verifier)), cookie, nil
+}
+
+// Exchange completes a login from the StateCookie of the browser and the callback parameters
+// and validates the id token
+func (c *Client) Exchange(ctx context.Context, cookie string, state string, code string) (Identity, error) {
+	// the callback must come back to the browser that started the login
+	login, err := c.open(cookie)
+	if err != nil || state == "" || !hmac.Equal([]byte(login.State), []byte(state)) || time.Now().Unix() > login.ExpiresAt {
+		return Identity{}, ErrInvalidState
+	}
+
+	token, err := c.oauth.Exchange(ctx, code, oauth2.VerifierOption(login.Verifier))
+	if err != nil {
+		return Identity{}, fmt.Errorf("error exchanging authorization code: %v", err)
+	}
+
+	raw_id_token, ok := token.Extra("id_token").(string)
+	if !ok {
+		return Identity{}, errors.New("token response has no id_token")
+	}
+
+	// signature, issuer, audience and expiry are checked against the provider JWKS
+	id_token, err := c.verifier.Verify(ctx, raw_id_token)
+	if err != nil {
+		return Identity{}, fmt.Errorf("error verifying id token: %v", err)
+	}
+	if id_token.Nonce != login.Nonce {
+		return Identity{}, ErrInvalidNonce
+	}
+
+	var claims map[string]interface{}
+	if err := id_token.Claims(&claims); err != nil {
+		return Identity{}, fmt.Errorf("error reading id token claims: %v", err)
+	}
+
+	identity := Identity{Subject: id_token.Subject}
+	identity.Email, _ = claims["email"].(string)
+	// an email the provider does not vouch for could belong to anybody
+	if verified, _ := claims["email_verified"].(bool); identity.Email == "" || !verified {
+		return Identity{}, ErrMissingEmail
+	}
+	if groups, ok := claims[c.config.GroupsClaim].([]interface{}); ok {
+		for _, group := range groups {
+			if name, ok := group.(string); ok {
+				identity.Groups = append(identity.Groups, name)
+			}
+		}
+	}
+	return identity, nil
+}
+
+// MapRoles translates provider groups to local role names, groups without a mapping are dropped
+func (c *Client) MapRoles(groups []string) []string {
+	roles := make([]string, 0, len(groups))
+	for _, group := range groups {
+		if role, ok := c.config.GroupRoles[group]; ok {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// sign encodes the pending login followed by its HMAC
+func (c *Client) sign(login pendingLogin) (string, error) {
+	payload, err := json.Marshal(login)
+	if err != nil {
+		return "", fmt.Errorf("error encoding oidc state: %v", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + c.mac(encoded), nil
+}
+
+// open checks the HMAC of a signed pending login and decodes it
+func (c *Client) open(cookie string) (pendingLogin, error) {
+	var login pendingLogin
+	encoded, mac, found := strings.Cut(cookie, ".")
+	if !found || !hmac.Equal([]byte(mac), []byte(c.mac(encoded))) {
+		return login, ErrInvalidState
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return login, ErrInvalidState
+	}
+	if err := json.Unmarshal(payload, &login); err != nil {
+		return login, ErrInvalidState
+	}
+	return login, nil
+}
+
+func (c *Client) mac(encoded string) string {
+	hash := hmac.New(sha256.New, []byte(c.config.StateKey))
+	hash.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil))
+}
+
+func randomString() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("error generating random value: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// ##########################################################################
+var (
+	defaultMu     sync.Mutex
+	defaultClient *Client
+)
+
+// Default returns the client configured from the environment, discovering the provider on first use
+func Default(ctx context.Context) (*Client, error) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+
+	if defaultClient == nil {
+		client, err := NewClient(ctx, ConfigFromEnv())
+		if err != nil {
+			return nil, err
+		}
+		defaultClient = client
+	}
+	return defaultClient, nil
+}
+
+// SetDefault replaces the client returned by Default, mostly for tests
+func SetDefault(client *Client) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultClient = client
+}
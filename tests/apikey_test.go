@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/utils"
+)
+
+// ##########################################################################
+var testsAPIKeyPrefix = []struct {
+	name        string // name of the test
+	description string // description of the test case
+	key         string // api key to parse
+	prefix      string // expected prefix
+	valid       bool   // expected validity
+}{
+	{
+		name:        "api key prefix - 1",
+		description: "well formed key returns its prefix",
+		key:         "gb_0a1b2c3d4e5f_c2VjcmV0",
+		prefix:      "gb_0a1b2c3d4e5f",
+		valid:       true,
+	},
+	{
+		name:        "api key prefix - 2",
+		description: "secret containing underscores keeps the prefix intact",
+		key:         "gb_0a1b2c3d4e5f__se_cret",
+		prefix:      "gb_0a1b2c3d4e5f",
+		valid:       true,
+	},
+	{
+		name:        "api key prefix - 3",
+		description: "foreign prefix is rejected",
+		key:         "xx_0a1b2c3d4e5f_c2VjcmV0",
+		valid:       false,
+	},
+	{
+		name:        "api key prefix - 4",
+		description: "key without secret is rejected",
+		key:         "gb_0a1b2c3d4e5f",
+		valid:       false,
+	},
+}
+
+func TestAPIKeyPrefix(t *testing.T) {
+	for _, test := range testsAPIKeyPrefix {
+		t.Run(test.name, func(t *testing.T) {
+			prefix, valid := utils.APIKeyPrefix(test.key)
+			assert.Equalf(t, test.valid, valid, test.description)
+			assert.Equalf(t, test.prefix, prefix, test.description)
+		})
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	key, prefix, err := utils.GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(key, prefix+"_"))
+
+	// generated keys parse back to their own prefix
+	parsed, valid := utils.APIKeyPrefix(key)
+	assert.True(t, valid)
+	assert.Equal(t, prefix, parsed)
+
+	// only the exact key matches the stored hash
+	hashed := utils.HashAPIKey(key)
+	assert.True(t, utils.APIKeyMatches(hashed, key))
+	assert.False(t, utils.APIKeyMatches(hashed, key+"x"))
+}
@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"semay.com/manager"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+func TestSyncPermissions(t *testing.T) {
+	app, db := serverApp(t)
+	admin_routes := 0
+	for _, route := range app.Routes() {
+		if route.Method != echo.RouteNotFound && strings.HasPrefix(route.Path, "/admin/") {
+			admin_routes++
+		}
+	}
+	assert.NoError(t, db.Create(&models.Permission{Name: "get_all_widgets", Description: "GET /admin/widget", Active: true}).Error)
+	assert.NoError(t, db.Create(&models.Role{Name: "admin", Description: "admin role"}).Error)
+
+	synced, pruned, err := manager.SyncPermissions(db, app, true, "admin")
+	assert.NoError(t, err)
+	assert.Equal(t, admin_routes, synced)
+	assert.Equal(t, int64(1), pruned)
+
+	// one permission per route named after it, the stale one is kept but deactivated
+	var permission models.Permission
+	assert.NoError(t, db.Where("name = ?", "post_role").First(&permission).Error)
+	assert.Equal(t, "POST /admin/role", permission.Description)
+	var stale models.Permission
+	assert.NoError(t, db.Where("name = ?", "get_all_widgets").First(&stale).Error)
+	assert.False(t, stale.Active)
+
+	var role models.Role
+	assert.NoError(t, db.Preload("Permissions").Where("name = ?", "admin").First(&role).Error)
+	assert.Len(t, role.Permissions, admin_routes)
+
+	// syncing again changes nothing
+	synced, _, err = manager.SyncPermissions(db, app, false, "")
+	assert.NoError(t, err)
+	assert.Equal(t, admin_routes, synced)
+	var count int64
+	db.Model(&models.Permission{}).Count(&count)
+	assert.Equal(t, int64(admin_routes+1), count)
+
+	_, _, err = manager.SyncPermissions(db, app, false, "missing")
+	assert.Error(t, err)
+}
+
+func TestAuthorize(t *testing.T) {
+	app, db := serverApp(t)
+	reader := grantRoutes(t, app, db, "reader", "get_all_roles")
+	createUser(t, db, "reader@example.com", reader)
+	auth := bearer(login(t, app, "reader@example.com", testPassword))
+
+	status, _ := serverRequest(app, http.MethodGet, "/admin/role", "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	status, answer := serverRequest(app, http.MethodPost, "/admin/role", `{"name":"editor","description":"edits"}`, auth...)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "Not Allowed, missing permission post_role", answer["detail"])
+
+	// api keys are held to their scopes
+	key, prefix, err := utils.GenerateAPIKey()
+	assert.NoError(t, err)
+	assert.NoError(t, db.Create(&models.APIKey{Name: "reports", Prefix: prefix, Hash: utils.HashAPIKey(key), Scopes: "get_all_roles"}).Error)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", middlewares.HeaderAPIKey, key)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/user", "", middlewares.HeaderAPIKey, key)
+	assert.Equal(t, http.StatusForbidden, status)
+
+	// permissions switched off stop granting their route at once
+	assert.NoError(t, db.Model(&models.Permission{}).Where("name = ?", "get_all_roles").UpdateColumn("active", false).Error)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", auth...)
+	assert.Equal(t, http.StatusForbidden, status)
+}
+
+func TestBatchPermissions(t *testing.T) {
+	app, db := serverApp(t)
+	batcher := grantRoutes(t, app, db, "batcher", "batch_roles", "patch_role")
+	createUser(t, db, "batcher@example.com", batcher)
+	auth := bearer(login(t, app, "batcher@example.com", testPassword))
+
+	// the batch permission alone does not grant the operations it runs
+	status, answer := serverRequest(app, http.MethodPost, "/admin/role/batch", `{"operations":[
+		{"op":"create","data":{"name":"editor","description":"edits"}},
+		{"op":"patch","id":`+fmt.Sprint(batcher.ID)+`,"data":{"description":"batches"}}
+	]}`, auth...)
+	assert.Equal(t, http.StatusMultiStatus, status)
+	results, _ := answer["data"].([]interface{})
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, float64(http.StatusForbidden), results[0].(map[string]interface{})["status"])
+		assert.Equal(t, "Not Allowed, missing permission post_role", results[0].(map[string]interface{})["details"])
+		assert.Equal(t, float64(http.StatusOK), results[1].(map[string]interface{})["status"])
+	}
+	var count int64
+	db.Model(&models.Role{}).Where("name = ?", "editor").Count(&count)
+	assert.Equal(t, int64(0), count)
+}
+
+func TestImportPermissions(t *testing.T) {
+	app, db := serverApp(t)
+	importer := grantRoutes(t, app, db, "importer", "import_roles")
+	createUser(t, db, "importer@example.com", importer)
+	auth := bearer(login(t, app, "importer@example.com", testPassword))
+
+	// importing creates roles, so it needs the create permission too
+	status, answer := serverRequest(app, http.MethodPost, "/admin/role/import", `[{"name":"editor","description":"edits"}]`, auth...)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "Not Allowed, missing permission post_role", answer["detail"])
+
+	grantRoutes(t, app, db, "creator", "post_role")
+	var post_role models.Permission
+	assert.NoError(t, db.Where("name = ?", "post_role").First(&post_role).Error)
+	assert.NoError(t, db.Model(&importer).Association("Permissions").Append(&post_role))
+	status, _ = serverRequest(app, http.MethodPost, "/admin/role/import", `[{"name":"editor","description":"edits"}]`, auth...)
+	assert.Equal(t, http.StatusOK, status)
+	status, answer = serverRequest(app, http.MethodPost, "/admin/role/import", `{"name":"editor"}`, append(auth, "Accept-Language", "fr")...)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Le fichier n'est pas un json valide", answer["detail"])
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	app, db := serverApp(t)
+	issuer := grantRoutes(t, app, db, "issuer", "get_all_roles", "post_apikey")
+	grantRoutes(t, app, db, "admin")
+	createUser(t, db, "issuer@example.com", issuer)
+	auth := bearer(login(t, app, "issuer@example.com", testPassword))
+
+	// keys carry at most the permissions of their issuer
+	status, answer := serverRequest(app, http.MethodPost, "/admin/apikey", `{"name":"everything","scopes":["get_all_roles","delete_user"]}`, auth...)
+	assert.Equal(t, http.StatusForbidden, status)
+	assert.Equal(t, "The API key cannot carry delete_user, a permission you do not hold", answer["detail"])
+	status, answer = serverRequest(app, http.MethodPost, "/admin/apikey", `{"name":"reports","scopes":["get_all_roles"]}`, auth...)
+	assert.Equal(t, http.StatusOK, status)
+	key := answer["data"].(map[string]interface{})["key"].(string)
+
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", middlewares.HeaderAPIKey, key)
+	assert.Equal(t, http.StatusOK, status)
+
+	// scopes whose permission was deactivated or pruned grant nothing
+	assert.NoError(t, db.Model(&models.Permission{}).Where("name = ?", "get_all_roles").UpdateColumn("active", false).Error)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", middlewares.HeaderAPIKey, key)
+	assert.Equal(t, http.StatusForbidden, status)
+}
@@ -0,0 +1,141 @@
+package tests
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"semay.com/i18n"
+	"semay.com/models"
+	"semay.com/models/controlers"
+)
+
+// roleDB returns an in memory database holding the role named taken
+func roleDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&models.Role{}, &models.RoleStatusChange{}))
+	assert.NoError(t, db.Create(&models.Role{Name: "taken", Description: "taken role"}).Error)
+	return db
+}
+
+func batchOperation(op string, id uint, data string) models.BatchOperation {
+	return models.BatchOperation{Op: op, ID: id, Data: json.RawMessage(data)}
+}
+
+// batchContext is the context of a batch request in the given languages
+func batchContext(languages string) echo.Context {
+	req := httptest.NewRequest(http.MethodPost, "/admin/role/batch", nil)
+	req.Header.Set("Accept-Language", languages)
+	return echo.New().NewContext(req, httptest.NewRecorder())
+}
+
+// rolePermissions are the permissions of every batch operation
+var rolePermissions = []string{"post_role", "patch_role", "delete_role"}
+
+func batchStatuses(results []models.BatchResult) []int {
+	statuses := make([]int, 0, len(results))
+	for _, result := range results {
+		statuses = append(statuses, result.Status)
+	}
+	return statuses
+}
+
+func TestRoleBatchIndependent(t *testing.T) {
+	db := roleDB(t)
+
+	results, succeeded := controlers.RunRoleBatch(batchContext("en"), db, models.BatchRequest{Operations: []models.BatchOperation{
+		batchOperation(models.BatchCreate, 0, `{"name":"new","description":"new role"}`),
+		batchOperation(models.BatchPatch, 1, `{"description":"patched","active":false}`),
+		batchOperation(models.BatchDelete, 42, ``),
+		batchOperation(models.BatchCreate, 0, `{"name":"no description"}`),
+	}}, rolePermissions)
+	assert.False(t, succeeded)
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK, http.StatusNotFound, http.StatusBadRequest}, batchStatuses(results))
+
+	// the operations that succeeded stay, the status switched by the patch is recorded
+	var count int64
+	db.Model(&models.Role{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+	var patched models.Role
+	assert.NoError(t, db.First(&patched, 1).Error)
+	assert.Equal(t, models.Role{ID: 1, Name: "taken", Description: "patched", Active: false}, patched)
+	var change models.RoleStatusChange
+	assert.NoError(t, db.First(&change).Error)
+	assert.Equal(t, []interface{}{uint(1), false, "set by patching the role"}, []interface{}{change.RoleID, change.Active, change.Reason})
+}
+
+func TestRoleBatchAtomic(t *testing.T) {
+	db := roleDB(t)
+
+	results, succeeded := controlers.RunRoleBatch(batchContext("en"), db, models.BatchRequest{Atomic: true, Operations: []models.BatchOperation{
+		batchOperation(models.BatchCreate, 0, `{"name":"new","description":"new role"}`),
+		batchOperation(models.BatchDelete, 1, ``),
+		batchOperation(models.BatchPatch, 42, `{"name":"missing"}`),
+		batchOperation(models.BatchDelete, 1, ``),
+	}}, rolePermissions)
+	assert.False(t, succeeded)
+	assert.Equal(t, []int{http.StatusFailedDependency, http.StatusFailedDependency, http.StatusNotFound, http.StatusFailedDependency}, batchStatuses(results))
+
+	// everything before the failure is rolled back
+	var roles []models.Role
+	db.Find(&roles)
+	assert.Len(t, roles, 1)
+	assert.Equal(t, "taken", roles[0].Name)
+
+	results, succeeded = controlers.RunRoleBatch(batchContext("en"), db, models.BatchRequest{Atomic: true, Operations: []models.BatchOperation{
+		batchOperation(models.BatchCreate, 0, `{"name":"new","description":"new role"}`),
+		batchOperation(models.BatchDelete, 1, ``),
+	}}, rolePermissions)
+	assert.True(t, succeeded)
+	assert.Equal(t, []int{http.StatusOK, http.StatusOK}, batchStatuses(results))
+}
+
+func TestRoleBatchPermissions(t *testing.T) {
+	db := roleDB(t)
+
+	// each operation needs the permission of its own endpoint
+	results, succeeded := controlers.RunRoleBatch(batchContext("en"), db, models.BatchRequest{Operations: []models.BatchOperation{
+		batchOperation(models.BatchCreate, 0, `{"name":"new","description":"new role"}`),
+		batchOperation(models.BatchPatch, 1, `{"description":"patched"}`),
+		batchOperation(models.BatchDelete, 1, ``),
+	}}, []string{"patch_role"})
+	assert.False(t, succeeded)
+	assert.Equal(t, []int{http.StatusForbidden, http.StatusOK, http.StatusForbidden}, batchStatuses(results))
+	assert.Equal(t, i18n.Params{"permission": "post_role"}, results[0].Params)
+	assert.Equal(t, i18n.Params{"permission": "delete_role"}, results[2].Params)
+
+	var roles []models.Role
+	db.Find(&roles)
+	assert.Equal(t, []models.Role{{ID: 1, Name: "taken", Description: "patched", Active: true}}, roles)
+}
+
+func TestRoleBatchResults(t *testing.T) {
+	db := roleDB(t)
+
+	results, _ := controlers.RunRoleBatch(batchContext("fr"), db, models.BatchRequest{Operations: []models.BatchOperation{
+		batchOperation(models.BatchCreate, 0, `{"name":"new","description":"new role"}`),
+		batchOperation(models.BatchPatch, 2, `{"name":"x"}`),
+		batchOperation(models.BatchPatch, 2, `{"name":"taken"}`),
+		batchOperation(models.BatchCreate, 0, `["not a role"]`),
+	}}, rolePermissions)
+	assert.Equal(t, []int{http.StatusOK, http.StatusBadRequest, http.StatusConflict, http.StatusBadRequest}, batchStatuses(results))
+
+	// the written role comes back as the role endpoints answer it
+	assert.Equal(t, models.RoleGet{ID: 2, Name: "new", Description: "new role", Active: true}, results[0].Data)
+
+	// patches are validated like the patch endpoint does, in the language of the request
+	assert.Equal(t, "error.invalid", results[1].Message)
+	problems, err := json.Marshal(results[1].Data)
+	assert.NoError(t, err)
+	assert.Contains(t, string(problems), "taille minimum de 2 caractères")
+	assert.Equal(t, "error.exists", results[2].Message)
+	assert.Equal(t, "batch.invalid_data", results[3].Message)
+	assert.Nil(t, results[3].Data)
+}
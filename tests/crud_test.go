@@ -0,0 +1,171 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/models"
+	"semay.com/models/controlers"
+	"semay.com/validation"
+)
+
+func crudApp(t *testing.T, crud *controlers.CRUD[models.Role, models.RolePost, models.RolePatch, models.RoleGet]) (*echo.Echo, *gorm.DB) {
+	db := roleDB(t)
+	crud.DB = func() *gorm.DB { return db }
+
+	app := echo.New()
+	app.Validator = validation.New(crud.DB)
+	crud.Register(app.Group("/admin"))
+	return app, db
+}
+
+func crudRequest(app *echo.Echo, method string, path string, body string) int {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	resp := httptest.NewRecorder()
+	app.ServeHTTP(resp, req)
+	return resp.Code
+}
+
+func TestCRUDRoutes(t *testing.T) {
+	app, db := crudApp(t, &controlers.CRUD[models.Role, models.RolePost, models.RolePatch, models.RoleGet]{
+		Name:     "role",
+		Sortable: map[string]string{"id": "id", "name": "name"},
+	})
+
+	names := make(map[string]string)
+	for _, route := range app.Routes() {
+		names[route.Method+" "+route.Path] = route.Name
+	}
+	assert.Equal(t, map[string]string{
+		"GET /admin/role":             "get_all_roles",
+		"GET /admin/role/:role_id":    "get_one_roles",
+		"POST /admin/role":            "post_role",
+		"PATCH /admin/role/:role_id":  "patch_role",
+		"DELETE /admin/role/:role_id": "delete_role",
+	}, names)
+
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role", `{"name":"editor","description":"edits"}`))
+	assert.Equal(t, http.StatusConflict, crudRequest(app, http.MethodPost, "/admin/role", `{"name":"editor","description":"edits more"}`))
+	assert.Equal(t, http.StatusBadRequest, crudRequest(app, http.MethodPost, "/admin/role", `{"name":"x"}`))
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodGet, "/admin/role?sort=-name", ""))
+	assert.Equal(t, http.StatusBadRequest, crudRequest(app, http.MethodGet, "/admin/role?sort=description", ""))
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodGet, "/admin/role/2?fields=name", ""))
+	assert.Equal(t, http.StatusBadRequest, crudRequest(app, http.MethodGet, "/admin/role/two", ""))
+
+	// a role keeps its own name, others are taken
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPatch, "/admin/role/2", `{"name":"editor","description":"edits all"}`))
+	assert.Equal(t, http.StatusConflict, crudRequest(app, http.MethodPatch, "/admin/role/2", `{"name":"taken"}`))
+	var role models.Role
+	assert.NoError(t, db.First(&role, 2).Error)
+	assert.Equal(t, "edits all", role.Description)
+
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodDelete, "/admin/role/2", ""))
+	assert.Equal(t, http.StatusNotFound, crudRequest(app, http.MethodDelete, "/admin/role/2", ""))
+	assert.Equal(t, http.StatusNotFound, crudRequest(app, http.MethodPatch, "/admin/role/2", `{"description":"gone"}`))
+}
+
+func TestCRUDHooksAndFilters(t *testing.T) {
+	calls := make([]string, 0)
+	hook := func(name string) controlers.Hook[models.Role] {
+		return func(contx echo.Context, tx *gorm.DB, role *models.Role) error {
+			calls = append(calls, name)
+			if role.Name == "keep" && name == "after delete" {
+				return common.Conflict("role.exists")
+			}
+			return nil
+		}
+	}
+	forbidden := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(contx echo.Context) error {
+			return contx.NoContent(http.StatusForbidden)
+		}
+	}
+
+	app, db := crudApp(t, &controlers.CRUD[models.Role, models.RolePost, models.RolePatch, models.RoleGet]{
+		Name: "role",
+		Filters: []controlers.Filter{func(contx echo.Context, query *gorm.DB) *gorm.DB {
+			return query.Where("name <> ?", "hidden")
+		}},
+		Middleware: map[controlers.Operation][]echo.MiddlewareFunc{controlers.OperationList: {forbidden}},
+		BeforeCreate: func(contx echo.Context, tx *gorm.DB, create *models.RolePost, role *models.Role) error {
+			calls = append(calls, "before create")
+			role.Description = create.Description + " by hook"
+			return nil
+		},
+		AfterCreate: hook("after create"),
+		BeforeUpdate: func(contx echo.Context, tx *gorm.DB, patch *models.RolePatch, role *models.Role) error {
+			calls = append(calls, "before update")
+			return nil
+		},
+		AfterUpdate:  hook("after update"),
+		BeforeDelete: hook("before delete"),
+		AfterDelete:  hook("after delete"),
+	})
+
+	assert.Equal(t, http.StatusForbidden, crudRequest(app, http.MethodGet, "/admin/role", ""))
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role", `{"name":"keep","description":"kept"}`))
+	var role models.Role
+	assert.NoError(t, db.First(&role, 2).Error)
+	assert.Equal(t, "kept by hook", role.Description)
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPatch, "/admin/role/2", `{"description":"still kept"}`))
+
+	// an after hook error rolls the delete back
+	assert.Equal(t, http.StatusConflict, crudRequest(app, http.MethodDelete, "/admin/role/2", ""))
+	var count int64
+	db.Model(&models.Role{}).Where("id = ?", 2).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// rows left out by the filters are not found
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role", `{"name":"hidden","description":"hidden role"}`))
+	assert.Equal(t, http.StatusNotFound, crudRequest(app, http.MethodGet, "/admin/role/3", ""))
+	assert.Equal(t, http.StatusNotFound, crudRequest(app, http.MethodDelete, "/admin/role/3", ""))
+
+	assert.Equal(t, []string{
+		"before create", "after create",
+		"before update", "after update",
+		"before delete", "after delete",
+		"before create", "after create",
+	}, calls)
+}
+
+func TestCRUDWriteRepresentation(t *testing.T) {
+	app, _ := crudApp(t, &controlers.CRUD[models.Role, models.RolePost, models.RolePatch, models.RoleGet]{Name: "role"})
+
+	// writes answer the same representation as reads, without the associations of the row
+	write := func(method string, path string, body string) map[string]interface{} {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+
+		var answer struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &answer))
+		return answer.Data
+	}
+	keys := func(data map[string]interface{}) []string {
+		names := make([]string, 0, len(data))
+		for name := range data {
+			names = append(names, name)
+		}
+		return names
+	}
+
+	fields := []string{"id", "name", "description", "active"}
+	assert.ElementsMatch(t, fields, keys(write(http.MethodPost, "/admin/role", `{"name":"editor","description":"edits"}`)))
+	assert.ElementsMatch(t, fields, keys(write(http.MethodPatch, "/admin/role/2", `{"description":"edits all"}`)))
+	assert.ElementsMatch(t, fields, keys(write(http.MethodGet, "/admin/role/2", "")))
+	deleted := write(http.MethodDelete, "/admin/role/2", "")
+	assert.ElementsMatch(t, fields, keys(deleted))
+	assert.Equal(t, "edits all", deleted["description"])
+}
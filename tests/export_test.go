@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/export"
+	"semay.com/models"
+)
+
+func TestExportFormats(t *testing.T) {
+	_, err := export.Lookup("xml")
+	assert.ErrorIs(t, err, export.ErrUnknownFormat)
+	format, err := export.Lookup("")
+	assert.NoError(t, err)
+	assert.Equal(t, "csv", format.Name)
+}
+
+// exportRows streams the items of pageDB in format
+func exportRows(t *testing.T, count int, name string) []byte {
+	db := pageDB(t, count)
+	assert.NoError(t, db.Create(&pageItem{Name: `=cmd|"x"`, Secret: "hidden"}).Error)
+	rows, err := db.Model(&pageItem{}).Order("id").Rows()
+	assert.NoError(t, err)
+
+	format, _ := export.Lookup(name)
+	var out bytes.Buffer
+	assert.NoError(t, export.Stream[pageItem](db, rows, format, &out))
+	return out.Bytes()
+}
+
+func TestExportCSV(t *testing.T) {
+	out := exportRows(t, 2, "csv")
+
+	// json hidden fields stay out and formulas are not run by spreadsheets
+	assert.Equal(t, "id,name,active\n1,item-01,true\n2,item-02,true\n3,\"'=cmd|\"\"x\"\"\",false\n", string(out))
+}
+
+func TestExportNDJSON(t *testing.T) {
+	out := exportRows(t, 1, "ndjson")
+
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	assert.Len(t, lines, 2)
+	assert.JSONEq(t, `{"id":2,"name":"=cmd|\"x\"","active":false}`, lines[1])
+}
+
+func TestExportXLSX(t *testing.T) {
+	out := exportRows(t, 1, "xlsx")
+
+	archive, err := zip.NewReader(bytes.NewReader(out), int64(len(out)))
+	assert.NoError(t, err)
+	names := make([]string, 0)
+	var sheet string
+	for _, file := range archive.File {
+		names = append(names, file.Name)
+		if file.Name == "xl/worksheets/sheet1.xml" {
+			reader, _ := file.Open()
+			raw, _ := io.ReadAll(reader)
+			sheet = string(raw)
+		}
+	}
+	assert.Contains(t, names, "[Content_Types].xml")
+	assert.Contains(t, names, "xl/workbook.xml")
+	assert.Contains(t, sheet, `<c r="A2"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<c r="C2" t="b"><v>1</v></c>`)
+	assert.Contains(t, sheet, `<t xml:space="preserve">=cmd|&#34;x&#34;</t>`)
+	assert.True(t, strings.HasSuffix(sheet, "</sheetData></worksheet>"))
+}
+
+func TestExportRolesFilters(t *testing.T) {
+	app, db := serverApp(t)
+	exporter := grantRoutes(t, app, db, "exporter", "export_roles")
+	createUser(t, db, "exporter@example.com", exporter)
+	auth := bearer(login(t, app, "exporter@example.com", testPassword))
+	assert.NoError(t, db.Create(&models.Role{Name: "auditor", Description: "reads the audit log"}).Error)
+	assert.NoError(t, db.Create(&models.Role{Name: "retired", Description: "no longer used"}).Error)
+	assert.NoError(t, db.Model(&models.Role{}).Where("name = ?", "retired").UpdateColumn("active", false).Error)
+
+	// the export narrows the roles like the list endpoint does
+	download := func(query string) string {
+		req := httptest.NewRequest(http.MethodGet, "/admin/role/export?"+query, nil)
+		req.Header.Set(auth[0], auth[1])
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusOK, resp.Code)
+		return resp.Body.String()
+	}
+	assert.Equal(t, "id,name,description,active\n3,retired,no longer used,false\n", download("active=false"))
+	assert.Equal(t, "id,name,description,active\n2,auditor,reads the audit log,true\n", download("q=audit&active=true"))
+
+	status, answer := serverRequest(app, http.MethodGet, "/admin/role/export?format=xml", "", append(auth, "Accept-Language", "fr")...)
+	assert.Equal(t, http.StatusBadRequest, status)
+	assert.Equal(t, "Les formats d'export sont csv, ndjson et xlsx", answer["detail"])
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role/export?active=sometimes", "", auth...)
+	assert.Equal(t, http.StatusBadRequest, status)
+}
@@ -0,0 +1,63 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/common"
+)
+
+// pageItemGet is the Get DTO of pageItem, without the active flag
+type pageItemGet struct {
+	ID   uint   `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestParseFields(t *testing.T) {
+	fieldset, err := common.ParseFields("", pageItemGet{})
+	assert.NoError(t, err)
+	assert.Nil(t, fieldset)
+
+	fieldset, err = common.ParseFields(" name, id,name", pageItemGet{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"name", "id"}, fieldset.Names)
+
+	// only fields of the DTO can be asked for, even when the model has them
+	for _, raw := range []string{"active", "secret", "Secret", "name,"} {
+		_, err = common.ParseFields(raw, pageItemGet{})
+		assert.ErrorIs(t, err, common.ErrInvalidQuery, raw)
+	}
+}
+
+func TestFieldsetSelectAndShape(t *testing.T) {
+	db := pageDB(t, 3)
+	fieldset, _ := common.ParseFields("name", pageItemGet{})
+
+	// the id and the needed columns are read along, the rest is left out
+	query, err := fieldset.Select(db.Model(&pageItem{}), "active")
+	assert.NoError(t, err)
+	var items []pageItem
+	assert.NoError(t, query.Order("id").Find(&items).Error)
+	assert.Equal(t, pageItem{ID: 1, Name: "item-01", Active: true}, items[0])
+
+	result, err := common.Paginate[pageItem](context.Background(), query, nil, 1, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), result.Total)
+	shaped, err := fieldset.Shape(result.Items)
+	assert.NoError(t, err)
+	raw, _ := json.Marshal(shaped)
+	assert.JSONEq(t, `[{"name":"item-01"},{"name":"item-02"}]`, string(raw))
+
+	one, err := fieldset.Shape(&items[2])
+	assert.NoError(t, err)
+	raw, _ = json.Marshal(one)
+	assert.JSONEq(t, `{"name":"item-03"}`, string(raw))
+
+	// without a fieldset nothing changes
+	var all *common.Fieldset
+	same, err := all.Shape(items)
+	assert.NoError(t, err)
+	assert.Equal(t, items, same)
+}
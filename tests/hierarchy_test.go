@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/models"
+	"semay.com/models/controlers"
+)
+
+// treeNames flattens a tree into the names of each branch, e.g. admin>editor>viewer
+func treeNames(nodes []models.RoleTree, up bool, prefix string) []string {
+	names := make([]string, 0)
+	for _, node := range nodes {
+		path := prefix + ">" + node.Name
+		names = append(names, path)
+		next := node.Children
+		if up {
+			next = node.Parents
+		}
+		names = append(names, treeNames(next, up, path)...)
+	}
+	return names
+}
+
+func TestRoleHierarchy(t *testing.T) {
+	db := roleDB(t)
+	controlers.Roles.DB = func() *gorm.DB { return db }
+	t.Cleanup(func() { controlers.Roles.DB = nil })
+
+	app := echo.New()
+	app.GET("/admin/role/:role_id/tree", controlers.GetRoleTree)
+	app.POST("/admin/role/:role_id/child/:child_id", controlers.AddRoleChild)
+	app.DELETE("/admin/role/:role_id/child/:child_id", controlers.DeleteRoleChild)
+
+	// 1 taken, 2 viewer, 3 editor, 4 admin, 5 auditor
+	for _, name := range []string{"viewer", "editor", "admin", "auditor"} {
+		assert.NoError(t, db.Create(&models.Role{Name: name, Description: name + " role"}).Error)
+	}
+
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role/3/child/2", ""))
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role/4/child/3", ""))
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role/5/child/2", ""))
+	assert.Equal(t, http.StatusNotFound, crudRequest(app, http.MethodPost, "/admin/role/4/child/9", ""))
+	assert.Equal(t, http.StatusBadRequest, crudRequest(app, http.MethodPost, "/admin/role/4/child/x", ""))
+
+	// no role may end up inside itself
+	req := httptest.NewRequest(http.MethodPost, "/admin/role/2/child/4", nil)
+	resp := httptest.NewRecorder()
+	app.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	assert.Contains(t, resp.Body.String(), "admin cannot go inside viewer, viewer is already inside admin")
+	assert.Equal(t, http.StatusConflict, crudRequest(app, http.MethodPost, "/admin/role/3/child/3", ""))
+	cycle, err := models.CreatesCycle(db, 5, 3)
+	assert.NoError(t, err)
+	assert.False(t, cycle)
+
+	req = httptest.NewRequest(http.MethodGet, "/admin/role/3/tree", nil)
+	resp = httptest.NewRecorder()
+	app.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	var body struct {
+		Data models.RoleTree `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Equal(t, "editor", body.Data.Name)
+	assert.Equal(t, []string{">admin"}, treeNames(body.Data.Parents, true, ""))
+	assert.Equal(t, []string{">viewer"}, treeNames(body.Data.Children, false, ""))
+
+	tree, err := models.BuildRoleTree(db, models.RoleGet{ID: 2, Name: "viewer"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{">editor", ">editor>admin", ">auditor"}, treeNames(tree.Parents, true, ""))
+	assert.Empty(t, tree.Children)
+
+	// roles held reach down the hierarchy, a deactivated role passes nothing on
+	names := func(roles []models.Role) []string {
+		found := make([]string, 0)
+		for _, role := range roles {
+			found = append(found, role.Name)
+		}
+		return found
+	}
+	roles, err := models.EffectiveRoles(db, []string{"admin"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"viewer", "editor", "admin"}, names(roles))
+	assert.NoError(t, db.Model(&models.Role{}).Where("id = ?", 3).UpdateColumn("active", false).Error)
+	roles, err = models.EffectiveRoles(db, []string{"admin", "auditor"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"viewer", "admin", "auditor"}, names(roles))
+	roles, err = models.EffectiveRoles(db, []string{"editor"})
+	assert.NoError(t, err)
+	assert.Empty(t, roles)
+
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodDelete, "/admin/role/4/child/3", ""))
+	tree, err = models.BuildRoleTree(db, models.RoleGet{ID: 4, Name: "admin"})
+	assert.NoError(t, err)
+	assert.Empty(t, tree.Children)
+	assert.Equal(t, http.StatusOK, crudRequest(app, http.MethodPost, "/admin/role/2/child/4", ""))
+}
@@ -0,0 +1,86 @@
+package tests
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"semay.com/common"
+	"semay.com/i18n"
+)
+
+func TestCatalogue(t *testing.T) {
+	catalogue := i18n.NewCatalogue("en")
+	bundles := fstest.MapFS{
+		"locales/en.json": {Data: []byte(`{"greet": "Hello {name}", "files": {"one": "{count} file", "other": "{count} files"}}`)},
+		"locales/fr.json": {Data: []byte(`{"files": {"one": "{count} fichier", "other": "{count} fichiers"}}`)},
+		"extra/fr.json":   {Data: []byte(`{"greet": "Bonjour {name}"}`)},
+	}
+	assert.NoError(t, catalogue.Load(bundles, "locales"))
+	assert.Equal(t, []string{"en", "fr"}, catalogue.Locales())
+
+	// missing messages come from the fallback locale, unknown ids pass through
+	assert.Equal(t, "Hello Ana", catalogue.Translate([]string{"fr"}, "greet", i18n.Params{"name": "Ana"}))
+	assert.Equal(t, "Role not found", catalogue.Translate([]string{"fr"}, "Role not found", nil))
+
+	// later bundles replace messages one by one
+	assert.NoError(t, catalogue.Load(bundles, "extra"))
+	assert.Equal(t, "Bonjour Ana", catalogue.Translate([]string{"fr"}, "greet", i18n.Params{"name": "Ana"}))
+	assert.Equal(t, "0 fichier", catalogue.Translate([]string{"fr"}, "files", i18n.Params{"count": 0}), "zero is singular in French")
+	assert.Equal(t, "0 files", catalogue.Translate([]string{"de", "en"}, "files", i18n.Params{"count": 0}))
+	assert.Equal(t, "1 file", catalogue.Translate(nil, "files", i18n.Params{"count": 1}))
+
+	assert.Equal(t, "fr", catalogue.Match([]string{"de", "fr_CA", "fr"}))
+	assert.Equal(t, "en", catalogue.Match([]string{"de"}))
+
+	invalid := fstest.MapFS{"en.json": {Data: []byte(`{"files": {"one": "{count} file"}}`)}}
+	assert.Error(t, i18n.NewCatalogue("en").Load(invalid, "."), "plural messages need an other form")
+}
+
+func TestBundlesHaveTheSameIds(t *testing.T) {
+	catalogue := i18n.Messages()
+	for _, locale := range catalogue.Locales() {
+		for _, id := range []string{"role.not_found", "role.created", "import.completed", "error.internal"} {
+			assert.NotEqual(t, id, catalogue.Translate([]string{locale}, id, nil), "%v misses %v", locale, id)
+		}
+	}
+}
+
+func TestLocalizedResponses(t *testing.T) {
+	respond := func(accept_language string, locale string, err error) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(http.MethodGet, "/admin/role/7", nil)
+		req.Header.Set("Accept-Language", accept_language)
+		resp := httptest.NewRecorder()
+		contx := echo.New().NewContext(req, resp)
+		contx.Set(common.LocaleKey, locale)
+		if err != nil {
+			common.HTTPErrorHandler(err, contx)
+		} else {
+			common.Respond(contx, http.StatusOK, common.ResponseHTTP{
+				Success: true,
+				Message: "import.completed",
+				Params:  i18n.Params{"created": 1, "count": 1},
+			})
+		}
+		var body map[string]interface{}
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+		return resp, body
+	}
+
+	resp, body := respond("fr-CA, en;q=0.5", "", nil)
+	assert.Equal(t, "1 rôle importé sur 1.", body["details"])
+	assert.Equal(t, "fr", resp.Header().Get("Content-Language"))
+	assert.Contains(t, resp.Header().Values(echo.HeaderVary), "Accept-Language")
+
+	resp, body = respond("fr", "es-MX", common.NotFound("role.not_found"))
+	assert.Equal(t, "Rol no encontrado", body["detail"], "the user's locale comes before Accept-Language")
+	assert.Equal(t, "es", resp.Header().Get("Content-Language"))
+
+	resp, body = respond("de", "", common.NotFound("role.not_found"))
+	assert.Equal(t, "Role not found", body["detail"])
+	assert.Equal(t, "en", resp.Header().Get("Content-Language"))
+}
@@ -0,0 +1,79 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/imports"
+	"semay.com/models"
+	"semay.com/models/controlers"
+)
+
+type importItem struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func TestImportFormatOf(t *testing.T) {
+	tests := []struct {
+		content_type string
+		filename     string
+		format       string
+	}{
+		{"text/csv; charset=utf-8", "", "csv"},
+		{"application/json", "", "json"},
+		{"application/octet-stream", "roles.CSV", "csv"},
+		{"", "roles.json", "json"},
+		{"text/plain", "roles.txt", ""},
+	}
+
+	for _, test := range tests {
+		format, err := imports.FormatOf(test.content_type, test.filename)
+		assert.Equal(t, test.format, format)
+		if test.format == "" {
+			assert.ErrorIs(t, err, imports.ErrUnknownFormat)
+		}
+	}
+}
+
+func TestImportRead(t *testing.T) {
+	// a BOM and untrimmed headers as spreadsheets write them
+	rows, err := imports.Read[importItem]("csv", strings.NewReader("\ufeffname, count\none,1\ntwo,x\n"), 10)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 2)
+	assert.Equal(t, importItem{Name: "one", Count: 1}, rows[0].Item)
+	assert.Equal(t, 1, rows[0].Line)
+	assert.NoError(t, rows[0].Err)
+	assert.ErrorIs(t, rows[1].Err, imports.ErrWrongType)
+
+	rows, err = imports.Read[importItem]("json", strings.NewReader(`[{"name":"one","count":"2"},{"name":"two","color":"red"}]`), 10)
+	assert.NoError(t, err)
+	assert.Equal(t, importItem{Name: "one", Count: 2}, rows[0].Item)
+	assert.EqualError(t, rows[1].Err, "unknown fields: color")
+	var unknown *imports.UnknownFieldsError
+	assert.ErrorAs(t, rows[1].Err, &unknown)
+	assert.Equal(t, []string{"color"}, unknown.Fields)
+
+	// the whole file is refused when it is malformed or too long
+	_, err = imports.Read[importItem]("json", strings.NewReader(`{"name":"one"}`), 10)
+	assert.ErrorIs(t, err, imports.ErrMalformed)
+	_, err = imports.Read[importItem]("csv", strings.NewReader("name\na\nb\nc\n"), 2)
+	assert.ErrorIs(t, err, imports.ErrTooManyRows)
+}
+
+func TestImportRoleRowsLocalized(t *testing.T) {
+	db := roleDB(t)
+	rows, err := imports.Read[models.RolePost]("csv", strings.NewReader("name,description\neditor,edits\neditor,writes\ntaken,other\nx,short\n"), 10)
+	assert.NoError(t, err)
+	rows = append(rows, imports.Row[models.RolePost]{Line: 5, Err: &imports.UnknownFieldsError{Fields: []string{"color"}}})
+
+	// the problems of the rows are written in the languages of the caller
+	report, err := controlers.ImportRoleRows(db, rows, models.ImportBestEffort, true, []string{"fr"})
+	assert.NoError(t, err)
+	assert.Equal(t, 4, report.Failed)
+	assert.Equal(t, []string{"Le nom est le même qu'à la ligne 1"}, report.Rows[1].Errors)
+	assert.Equal(t, []string{"Le nom est déjà pris par un rôle existant"}, report.Rows[2].Errors)
+	assert.Equal(t, []string{"name doit faire une taille minimum de 2 caractères"}, report.Rows[3].Errors)
+	assert.Equal(t, []string{"Champs inconnus : color"}, report.Rows[4].Errors)
+}
@@ -0,0 +1,92 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"semay.com/common"
+	"semay.com/middlewares"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		accept     string
+		media_type string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/xml", "application/xml"},
+		{"application/json;q=0.4, application/cbor", "application/cbor"},
+		{"text/html, application/x-msgpack;q=0.8, */*;q=0.1", "application/msgpack"},
+		{"text/html", ""},
+		{"application/json;q=0", ""},
+	}
+
+	for _, test := range tests {
+		codec, ok := common.Negotiate(test.accept)
+		assert.Equal(t, test.media_type != "", ok, test.accept)
+		assert.Equal(t, test.media_type, codec.MediaType, test.accept)
+	}
+}
+
+type negotiateBody struct {
+	ID    uint            `json:"id"`
+	Name  string          `json:"name,omitempty"`
+	Tags  []string        `json:"tags"`
+	Extra json.RawMessage `json:"extra,omitempty"`
+}
+
+func TestCodecsRoundTrip(t *testing.T) {
+	sent := negotiateBody{ID: 7, Name: "a <b> & c", Tags: []string{"x", "y"}, Extra: json.RawMessage(`{"k":"v"}`)}
+
+	for _, codec := range common.Codecs {
+		t.Run(codec.MediaType, func(t *testing.T) {
+			body, err := codec.Marshal(sent)
+			assert.NoError(t, err)
+
+			var received negotiateBody
+			assert.NoError(t, codec.Unmarshal(body, &received))
+			assert.Equal(t, sent.ID, received.ID)
+			assert.Equal(t, sent.Name, received.Name)
+			assert.Equal(t, sent.Tags, received.Tags)
+			assert.JSONEq(t, string(sent.Extra), string(received.Extra))
+		})
+	}
+}
+
+func TestNegotiateMiddleware(t *testing.T) {
+	app := echo.New()
+	app.Binder = &common.Binder{}
+	app.Use(middlewares.Negotiate(nil))
+	app.POST("/echo", func(contx echo.Context) error {
+		var body negotiateBody
+		if err := contx.Bind(&body); err != nil {
+			return err
+		}
+		return common.Respond(contx, http.StatusOK, common.ResponseHTTP{Success: true, Data: body})
+	})
+
+	send := func(content_type string, accept string, body []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, content_type)
+		req.Header.Set(echo.HeaderAccept, accept)
+		rec := httptest.NewRecorder()
+		app.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// an xml body comes back as xml with the json names
+	rec := send("application/xml", "application/xml", []byte(`<body><id>3</id><name>n</name><tags><item>t</item></tags></body>`))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, echo.MIMEApplicationXMLCharsetUTF8, rec.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, rec.Body.String(), "<data><id>3</id><name>n</name><tags><item>t</item></tags></data>")
+
+	assert.Equal(t, http.StatusNotAcceptable, send("application/json", "image/png", []byte(`{}`)).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, send("text/plain", "", []byte(`id=1`)).Code)
+}
@@ -0,0 +1,335 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/i18n"
+)
+
+type pageItem struct {
+	ID     uint   `gorm:"primaryKey" json:"id" filter:"eq,in,nin,gt,lte"`
+	Name   string `json:"name" filter:"eq,ne,like,ilike,in"`
+	Active bool   `json:"active" filter:"eq"`
+	Secret string `json:"-"`
+}
+
+// pageDB returns an in memory database holding count items, every third one inactive
+func pageDB(t *testing.T, count int) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&pageItem{}))
+	for i := 1; i <= count; i++ {
+		assert.NoError(t, db.Create(&pageItem{Name: fmt.Sprintf("item-%02d", i), Active: i%3 != 0}).Error)
+	}
+	return db
+}
+
+func TestPaginate(t *testing.T) {
+	t.Setenv("PAGINATION_DEFAULT_SIZE", "4")
+	t.Setenv("PAGINATION_MAX_SIZE", "10")
+	db := pageDB(t, 25)
+
+	tests := []struct {
+		name     string
+		page     int
+		size     int
+		first    uint
+		count    int
+		pages    uint
+		reported uint
+	}{
+		{"first page", 1, 5, 1, 5, 5, 5},
+		{"later pages start after the previous ones", 3, 5, 11, 5, 5, 5},
+		{"last partial page", 3, 10, 21, 5, 3, 10},
+		{"default size", 1, 0, 1, 4, 7, 4},
+		{"size capped to the maximum", 1, 100, 1, 10, 3, 10},
+		{"past the end is empty", 9, 5, 0, 0, 5, 5},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := common.Paginate[pageItem](context.Background(), db.Model(&pageItem{}), nil, test.page, test.size)
+			assert.NoError(t, err)
+
+			items := result.Items.([]pageItem)
+			assert.Len(t, items, test.count)
+			if test.count > 0 {
+				assert.Equal(t, test.first, items[0].ID)
+			}
+			assert.Equal(t, uint(25), result.Total)
+			assert.Equal(t, test.pages, result.Pages)
+			assert.Equal(t, test.reported, result.Size)
+		})
+	}
+}
+
+func TestPaginateKeepsCallerScopes(t *testing.T) {
+	db := pageDB(t, 9)
+
+	result, err := common.Paginate[pageItem](context.Background(), db.Model(&pageItem{}).Where("active = ?", true), nil, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(6), result.Total)
+	assert.Len(t, result.Items, 6)
+}
+
+func TestPaginateReturnsQueryErrors(t *testing.T) {
+	db := pageDB(t, 1)
+
+	_, err := common.Paginate[pageItem](context.Background(), db.Table("missing_table"), nil, 1, 10)
+	assert.Error(t, err)
+}
+
+// walkKeyset follows next cursors from the first page and returns the ids in the order seen
+func walkKeyset(t *testing.T, db *gorm.DB, sort []common.SortField, limit int) ([]uint, []common.ResponseCursorPagination) {
+	ids := make([]uint, 0)
+	pages := make([]common.ResponseCursorPagination, 0)
+	cursor := ""
+	for {
+		result, err := common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), sort, cursor, limit)
+		assert.NoError(t, err)
+		for _, item := range result.Items.([]pageItem) {
+			ids = append(ids, item.ID)
+		}
+		pages = append(pages, result)
+		if result.Next == "" || len(pages) > 20 {
+			return ids, pages
+		}
+		cursor = result.Next
+	}
+}
+
+func TestPaginateKeyset(t *testing.T) {
+	t.Setenv("SECRETE_SALT", "cursor-test")
+	db := pageDB(t, 10)
+	sortable := map[string]string{"name": "name", "active": "active"}
+
+	// ties of active are broken by id
+	sort, err := common.ParseSort("-active", sortable)
+	assert.NoError(t, err)
+	ids, pages := walkKeyset(t, db, sort, 3)
+	assert.Equal(t, []uint{1, 2, 4, 5, 7, 8, 10, 3, 6, 9}, ids)
+	assert.Len(t, pages, 4)
+	assert.Empty(t, pages[0].Prev)
+
+	// going back from the last page returns the one before it
+	result, err := common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), sort, pages[3].Prev, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, pages[2].Items, result.Items)
+	assert.NotEmpty(t, result.Next)
+
+	// rows added behind the cursor do not shift the following page
+	sort, _ = common.ParseSort("name", sortable)
+	first, err := common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), sort, "", 4)
+	assert.NoError(t, err)
+	assert.NoError(t, db.Create(&pageItem{Name: "item-00"}).Error)
+	second, err := common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), sort, first.Next, 4)
+	assert.NoError(t, err)
+	assert.Equal(t, "item-05", second.Items.([]pageItem)[0].Name)
+}
+
+type dueItem struct {
+	ID    uint       `gorm:"primaryKey" json:"id"`
+	DueAt *time.Time `json:"due_at"`
+}
+
+func TestPaginateKeysetNullSortValues(t *testing.T) {
+	t.Setenv("SECRETE_SALT", "cursor-test")
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&dueItem{}))
+
+	// every other item has no due date
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 1; i <= 8; i++ {
+		item := dueItem{}
+		if i%2 == 0 {
+			due_at := start.AddDate(0, 0, 10-i)
+			item.DueAt = &due_at
+		}
+		assert.NoError(t, db.Create(&item).Error)
+	}
+
+	walk := func(raw string) ([]uint, []common.ResponseCursorPagination) {
+		sort, err := common.ParseSort(raw, map[string]string{"due_at": "due_at"})
+		assert.NoError(t, err)
+		ids := make([]uint, 0)
+		pages := make([]common.ResponseCursorPagination, 0)
+		cursor := ""
+		for len(pages) < 10 {
+			result, err := common.PaginateKeyset[dueItem](context.Background(), db.Model(&dueItem{}), sort, cursor, 3)
+			assert.NoError(t, err)
+			for _, item := range result.Items.([]dueItem) {
+				ids = append(ids, item.ID)
+			}
+			pages = append(pages, result)
+			if cursor = result.Next; cursor == "" {
+				break
+			}
+		}
+		return ids, pages
+	}
+
+	// NULL sorts after every date and the cursors go through the NULL rows
+	ids, _ := walk("due_at")
+	assert.Equal(t, []uint{8, 6, 4, 2, 1, 3, 5, 7}, ids)
+	ids, pages := walk("-due_at")
+	assert.Equal(t, []uint{1, 3, 5, 7, 2, 4, 6, 8}, ids)
+
+	// going back across the NULL rows
+	sort, _ := common.ParseSort("-due_at", map[string]string{"due_at": "due_at"})
+	result, err := common.PaginateKeyset[dueItem](context.Background(), db.Model(&dueItem{}), sort, pages[1].Prev, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, pages[0].Items, result.Items)
+}
+
+func TestPaginateKeysetRejectsBadCursors(t *testing.T) {
+	t.Setenv("SECRETE_SALT", "cursor-test")
+	db := pageDB(t, 5)
+	sortable := map[string]string{"name": "name"}
+
+	by_name, _ := common.ParseSort("name", sortable)
+	result, err := common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), by_name, "", 2)
+	assert.NoError(t, err)
+
+	// a cursor only works with the sort it was issued for
+	by_name_desc, _ := common.ParseSort("-name", sortable)
+	_, err = common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), by_name_desc, result.Next, 2)
+	assert.ErrorIs(t, err, common.ErrInvalidCursor)
+
+	// tampered or foreign cursors are refused
+	_, err = common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), by_name, "x"+result.Next, 2)
+	assert.ErrorIs(t, err, common.ErrInvalidCursor)
+	t.Setenv("SECRETE_SALT", "another-secret")
+	_, err = common.PaginateKeyset[pageItem](context.Background(), db.Model(&pageItem{}), by_name, result.Next, 2)
+	assert.ErrorIs(t, err, common.ErrInvalidQuery)
+
+	// only whitelisted fields can be sorted on
+	_, err = common.ParseSort("password", sortable)
+	assert.ErrorIs(t, err, common.ErrInvalidSort)
+}
+
+func TestParseSort(t *testing.T) {
+	sortable := map[string]string{"name": "name", "active": "active", "id": "id", "created": "created_at"}
+
+	tests := []struct {
+		name string
+		raw  string
+		sort []common.SortField
+		err  error
+	}{
+		{"empty", "", nil, nil},
+		{"single", "name", []common.SortField{{Name: "name", Column: "name"}}, nil},
+		{"descending and mapped", "-created, id", []common.SortField{{Name: "created", Column: "created_at", Desc: true}, {Name: "id", Column: "id"}}, nil},
+		{"not whitelisted", "name,password", nil, common.ErrInvalidSort},
+		{"raw sql", "name;drop table roles", nil, common.ErrInvalidSort},
+		{"empty segment", "name,", nil, common.ErrInvalidSort},
+		{"given twice", "name,-name", nil, common.ErrInvalidQuery},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sort, err := common.ParseSort(test.raw, sortable)
+			if test.err != nil {
+				assert.ErrorIs(t, err, test.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.sort, sort)
+		})
+	}
+}
+
+func TestPaginateSorted(t *testing.T) {
+	db := pageDB(t, 7)
+
+	// inactive first then the tiebreaker keeps equal rows in id order across pages
+	sort, _ := common.ParseSort("active", map[string]string{"active": "active"})
+	first, err := common.Paginate[pageItem](context.Background(), db.Model(&pageItem{}), sort, 1, 4)
+	assert.NoError(t, err)
+	second, err := common.Paginate[pageItem](context.Background(), db.Model(&pageItem{}), sort, 2, 4)
+	assert.NoError(t, err)
+
+	ids := make([]uint, 0)
+	for _, item := range append(first.Items.([]pageItem), second.Items.([]pageItem)...) {
+		ids = append(ids, item.ID)
+	}
+	assert.Equal(t, []uint{3, 6, 1, 2, 4, 5, 7}, ids)
+	assert.Equal(t, "active,id", first.Sort)
+}
+
+func TestFilters(t *testing.T) {
+	db := pageDB(t, 12)
+	assert.NoError(t, db.Create(&pageItem{Name: "100%_off", Active: true}).Error)
+
+	tests := []struct {
+		name  string
+		query string
+		ids   []uint
+	}{
+		{"equal", "filter[name][eq]=item-04", []uint{4}},
+		{"operator defaults to eq", "filter[active]=false", []uint{3, 6, 9, 12}},
+		{"combined conditions", "filter[active][eq]=true&filter[id][gt]=8", []uint{10, 11, 13}},
+		{"in list", "filter[id][in]=1,2,30", []uint{1, 2}},
+		{"not in list", "filter[id][nin]=1,2&filter[id][lte]=4", []uint{3, 4}},
+		{"ilike ignores case", "filter[name][ilike]=ITEM-1", []uint{10, 11, 12}},
+		{"wildcards are literal", "filter[name][like]=%25_", []uint{13}},
+		{"quotes stay values", "filter[name][eq]=x' OR '1'='1", []uint{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params, err := url.ParseQuery(test.query)
+			assert.NoError(t, err)
+
+			query := db.Model(&pageItem{})
+			filters, err := common.ParseFilters(query, params)
+			assert.NoError(t, err)
+
+			var items []pageItem
+			assert.NoError(t, common.ApplyFilters(query, filters).Order("id").Find(&items).Error)
+			ids := make([]uint, 0)
+			for _, item := range items {
+				ids = append(ids, item.ID)
+			}
+			assert.Equal(t, test.ids, ids)
+		})
+	}
+}
+
+func TestFiltersRejectMalformed(t *testing.T) {
+	db := pageDB(t, 1)
+
+	tests := []struct {
+		name    string
+		query   string
+		problem string
+	}{
+		{"untagged field", "filter[secret][eq]=x", "secret can not be filtered"},
+		{"unknown operator", "filter[name][regex]=x", "regex is not an operator"},
+		{"operator not allowed on the field", "filter[active][gt]=true", "active can not be filtered with gt"},
+		{"value of the wrong type", "filter[id][eq]=one", `id[eq]: "one" is not a positive number`},
+		{"bad form", "filter[name][eq][x]=1", "filter[name][eq][x] is not of the form filter[field][operator]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			params, _ := url.ParseQuery(test.query)
+			_, err := common.ParseFilters(db.Model(&pageItem{}), params)
+
+			var filter_error *common.FilterError
+			assert.ErrorAs(t, err, &filter_error)
+			assert.ErrorIs(t, err, common.ErrInvalidQuery)
+			assert.Len(t, filter_error.Problems, 1)
+			problem := filter_error.Problems[0]
+			assert.Equal(t, test.problem, i18n.Messages().Translate([]string{"en"}, problem.Detail, problem.Params))
+		})
+	}
+}
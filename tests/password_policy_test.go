@@ -0,0 +1,104 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/utils"
+)
+
+func TestPasswordPolicy(t *testing.T) {
+	breached := filepath.Join(t.TempDir(), "breached.txt")
+	assert.NoError(t, os.WriteFile(breached, []byte("Summer#2024\nletmein\n"), 0o600))
+
+	policy := utils.PasswordPolicy{
+		MinLength:        8,
+		RequireUpper:     true,
+		RequireLower:     true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		BreachedListFile: breached,
+		History:          2,
+	}
+	history := []string{utils.HashFunc("Current#11"), utils.HashFunc("Older#222"), utils.HashFunc("Oldest#333")}
+
+	tests := []struct {
+		name       string
+		password   string
+		violations []string
+	}{
+		{"strong password", "Str0ng#Pass", nil},
+		{"too short", "Ab1#", []string{"at least 8 characters"}},
+		{"missing classes", "lowercaseonly", []string{"an upper case letter", "a digit", "a symbol"}},
+		{"breached ignoring case", "sUMMER#2024", []string{"not a known breached password"}},
+		{"current password", "Current#11", []string{"not one of the last 2 passwords"}},
+		{"previous password", "Older#222", []string{"not one of the last 2 passwords"}},
+		// only the last History hashes are checked
+		{"forgotten password", "Oldest#333", nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := policy.Validate(test.password, history)
+			if test.violations == nil {
+				assert.NoError(t, err)
+				return
+			}
+			var policy_error *utils.PasswordPolicyError
+			assert.ErrorAs(t, err, &policy_error)
+			assert.Equal(t, test.violations, policy_error.Violations)
+		})
+	}
+}
+
+func TestLockoutDelay(t *testing.T) {
+	policy := utils.LockoutPolicy{
+		MaxAttempts:  6,
+		FreeAttempts: 1,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Second,
+		Lockout:      time.Minute,
+	}
+
+	tests := []struct {
+		failures int
+		delay    time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Second},
+		{3, 2 * time.Second},
+		{4, 4 * time.Second},
+		{5, 5 * time.Second},
+		{6, time.Minute},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.delay, policy.Delay(test.failures), "failures %d", test.failures)
+	}
+}
+
+func TestLoginThrottle(t *testing.T) {
+	throttle := utils.NewLoginThrottle(utils.LockoutPolicy{
+		MaxAttempts: 3,
+		BaseDelay:   time.Minute,
+		MaxDelay:    time.Minute,
+		Lockout:     time.Hour,
+	}, time.Hour, time.Minute)
+
+	assert.Zero(t, throttle.Wait("ip:10.0.0.1"))
+	assert.Equal(t, time.Minute, throttle.Fail("ip:10.0.0.1"))
+	assert.Greater(t, throttle.Wait("ip:10.0.0.1"), time.Duration(0))
+
+	// other keys are not affected
+	assert.Zero(t, throttle.Wait("ip:10.0.0.2"))
+
+	throttle.Fail("ip:10.0.0.1")
+	assert.Equal(t, time.Hour, throttle.Fail("ip:10.0.0.1"))
+
+	throttle.Reset("ip:10.0.0.1")
+	assert.Zero(t, throttle.Wait("ip:10.0.0.1"))
+}
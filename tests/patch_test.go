@@ -0,0 +1,118 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"semay.com/models"
+	"semay.com/models/controlers"
+	"semay.com/patch"
+)
+
+func TestMergePatch(t *testing.T) {
+	// examples of RFC 7386 appendix A
+	tests := []struct {
+		document string
+		patch    string
+		result   string
+	}{
+		{`{"a":"b"}`, `{"a":"c"}`, `{"a":"c"}`},
+		{`{"a":"b"}`, `{"b":"c"}`, `{"a":"b","b":"c"}`},
+		{`{"a":"b"}`, `{"a":null}`, `{}`},
+		{`{"a":{"b":"c"}}`, `{"a":{"b":"d","c":null}}`, `{"a":{"b":"d"}}`},
+		{`{"a":[{"b":"c"}]}`, `{"a":[1]}`, `{"a":[1]}`},
+		{`{"e":null}`, `{"a":1}`, `{"a":1,"e":null}`},
+		{`[1,2]`, `{"a":"b","c":null}`, `{"a":"b"}`},
+	}
+	for _, test := range tests {
+		result, err := patch.Merge([]byte(test.document), []byte(test.patch))
+		assert.NoError(t, err)
+		assert.JSONEq(t, test.result, string(result), test.patch)
+	}
+
+	_, err := patch.Merge([]byte(`{}`), []byte(`{"a":`))
+	assert.ErrorIs(t, err, patch.ErrInvalid)
+}
+
+func TestJSONPatch(t *testing.T) {
+	document := []byte(`{"name":"editor","tags":["a","b"],"meta":{"a/b":1,"m~n":2}}`)
+
+	tests := []struct {
+		patch  string
+		result string
+		err    error
+	}{
+		{`[{"op":"add","path":"/tags/1","value":"x"}]`, `{"name":"editor","tags":["a","x","b"],"meta":{"a/b":1,"m~n":2}}`, nil},
+		{`[{"op":"add","path":"/tags/-","value":"c"}]`, `{"name":"editor","tags":["a","b","c"],"meta":{"a/b":1,"m~n":2}}`, nil},
+		{`[{"op":"remove","path":"/meta/a~1b"},{"op":"replace","path":"/meta/m~0n","value":3}]`, `{"name":"editor","tags":["a","b"],"meta":{"m~n":3}}`, nil},
+		{`[{"op":"move","from":"/name","path":"/title"}]`, `{"title":"editor","tags":["a","b"],"meta":{"a/b":1,"m~n":2}}`, nil},
+		{`[{"op":"copy","from":"/tags","path":"/labels"},{"op":"remove","path":"/labels/0"}]`, `{"name":"editor","tags":["a","b"],"labels":["b"],"meta":{"a/b":1,"m~n":2}}`, nil},
+		{`[{"op":"test","path":"/meta","value":{"m~n":2,"a/b":1}},{"op":"replace","path":"/name","value":"writer"}]`, `{"name":"writer","tags":["a","b"],"meta":{"a/b":1,"m~n":2}}`, nil},
+		{`[{"op":"replace","path":"/name","value":"writer"},{"op":"test","path":"/name","value":"editor"}]`, ``, patch.ErrTestFailed},
+		{`[{"op":"replace","path":"/missing","value":1}]`, ``, patch.ErrUnprocessable},
+		{`[{"op":"remove","path":"/tags/2"}]`, ``, patch.ErrUnprocessable},
+		{`[{"op":"move","from":"/meta","path":"/meta/inner"}]`, ``, patch.ErrInvalid},
+		{`[{"op":"add","path":"name","value":1}]`, ``, patch.ErrInvalid},
+		{`[{"op":"add","path":"/name"}]`, ``, patch.ErrInvalid},
+		{`[{"op":"merge","path":"/name"}]`, ``, patch.ErrInvalid},
+		{`{"op":"add"}`, ``, patch.ErrInvalid},
+	}
+	for _, test := range tests {
+		result, err := patch.Apply(document, []byte(test.patch))
+		if test.err != nil {
+			assert.ErrorIs(t, err, test.err, test.patch)
+			continue
+		}
+		assert.NoError(t, err, test.patch)
+		assert.JSONEq(t, test.result, string(result), test.patch)
+	}
+
+	var patch_error *patch.Error
+	_, err := patch.Apply(document, []byte(`[{"op":"test","path":"/tags/0","value":"z"}]`))
+	assert.True(t, errors.As(err, &patch_error))
+	assert.Equal(t, "/tags/0", patch_error.Path)
+}
+
+func TestPatchRoleDocuments(t *testing.T) {
+	app, db := crudApp(t, &controlers.CRUD[models.Role, models.RolePost, models.RolePatch, models.RoleGet]{Name: "role"})
+	assert.NoError(t, db.Create(&models.Role{Name: "editor", Description: "edits"}).Error)
+
+	send := func(content_type string, body string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/admin/role/2", bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, content_type)
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+		return resp.Code
+	}
+	stored := func() models.Role {
+		var role models.Role
+		assert.NoError(t, db.First(&role, 2).Error)
+		return role
+	}
+
+	// merge patches can switch a role off, which plain bodies could not before
+	assert.Equal(t, http.StatusOK, send(patch.MIMEMergePatch, `{"active":false,"description":"edits less"}`))
+	assert.Equal(t, models.Role{ID: 2, Name: "editor", Description: "edits less", Active: false}, stored())
+
+	// the patched role is validated as a whole
+	assert.Equal(t, http.StatusBadRequest, send(patch.MIMEMergePatch, `{"description":null}`))
+	assert.Equal(t, http.StatusConflict, send(patch.MIMEMergePatch, `{"name":"taken"}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, send(patch.MIMEMergePatch, `{"id":7}`))
+
+	// test operations guard the whole patch
+	assert.Equal(t, http.StatusConflict, send(patch.MIMEJSONPatch, `[{"op":"test","path":"/active","value":true},{"op":"replace","path":"/name","value":"writer"}]`))
+	assert.Equal(t, "editor", stored().Name)
+	assert.Equal(t, http.StatusOK, send(patch.MIMEJSONPatch, `[{"op":"test","path":"/active","value":false},{"op":"replace","path":"/name","value":"writer"},{"op":"replace","path":"/active","value":true}]`))
+	assert.Equal(t, models.Role{ID: 2, Name: "writer", Description: "edits less", Active: true}, stored())
+	assert.Equal(t, http.StatusUnprocessableEntity, send(patch.MIMEJSONPatch, `[{"op":"remove","path":"/color"}]`))
+	assert.Equal(t, http.StatusBadRequest, send(patch.MIMEJSONPatch, `[{"op":"paint","path":"/name"}]`))
+
+	// plain bodies still set their non zero fields
+	assert.Equal(t, http.StatusOK, send(echo.MIMEApplicationJSON, `{"description":"plain"}`))
+	assert.Equal(t, models.Role{ID: 2, Name: "writer", Description: "plain", Active: true}, stored())
+}
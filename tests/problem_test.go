@@ -0,0 +1,117 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/i18n"
+)
+
+func failWith(t *testing.T, err error, accept string) (*httptest.ResponseRecorder, common.Problem) {
+	req := httptest.NewRequest(http.MethodGet, "/admin/role/7", nil)
+	req.Header.Set(echo.HeaderAccept, accept)
+	resp := httptest.NewRecorder()
+	contx := echo.New().NewContext(req, resp)
+	contx.Response().Header().Set(echo.HeaderXRequestID, "req-1")
+
+	common.HTTPErrorHandler(err, contx)
+
+	var problem common.Problem
+	if accept == "" {
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+	}
+	return resp, problem
+}
+
+func TestProblemDetails(t *testing.T) {
+	t.Setenv("APP_ENV", "production")
+
+	tests := []struct {
+		err    error
+		status int
+		code   string
+		detail string
+	}{
+		{common.NotFound("Role not found"), 404, common.CodeNotFound, "Role not found"},
+		{common.Conflict("Name taken"), 409, common.CodeConflict, "Name taken"},
+		{fmt.Errorf("%w: sort field is not sortable", common.ErrInvalidQuery), 400, common.CodeInvalidQuery, "The list parameters are invalid"},
+		{common.ErrInvalidCursor, 400, common.CodeInvalidQuery, "The cursor is malformed or was issued for another sort"},
+		{common.InvalidQuery(common.ErrInvalidSort, "query.not_sortable", i18n.Params{"field": "password"}), 400, common.CodeInvalidQuery, "password can not be sorted on"},
+		{common.Invalid(errors.New("validator: (nil *models.RolePost)")), 400, common.CodeBadRequest, "The request is invalid"},
+		{gorm.ErrRecordNotFound, 404, common.CodeNotFound, "The resource was not found"},
+		{errors.New(`ERROR: duplicate key value violates unique constraint "roles_name_key"`), 409, common.CodeConflict, "The resource already exists"},
+		{echo.ErrMethodNotAllowed, 405, common.CodeMethodNotAllowed, "Method Not Allowed"},
+		{echo.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded"), 429, common.CodeTooManyRequests, "rate limit exceeded"},
+		{errors.New("dial tcp 10.0.0.5:5432: connection refused"), 500, common.CodeInternal, "Internal server error"},
+	}
+
+	for _, test := range tests {
+		resp, problem := failWith(t, test.err, "")
+		assert.Equal(t, test.status, resp.Code, test.err.Error())
+		assert.Equal(t, common.MIMEApplicationProblemJSON, resp.Header().Get(echo.HeaderContentType))
+		assert.Equal(t, test.status, problem.Status)
+		assert.Equal(t, test.code, problem.Code)
+		assert.Equal(t, test.detail, problem.Detail)
+		assert.Equal(t, "/admin/role/7", problem.Instance)
+		assert.Equal(t, "req-1", problem.RequestID)
+		assert.Empty(t, problem.Internal, "no internal details in production")
+		assert.NotContains(t, resp.Body.String(), "10.0.0.5")
+	}
+}
+
+func TestProblemInternalDetails(t *testing.T) {
+	cause := errors.New("dial tcp 10.0.0.5:5432: connection refused")
+
+	t.Setenv("APP_ENV", "development")
+	_, problem := failWith(t, common.Internal("Error retrieving role", cause), "")
+	assert.Equal(t, "Error retrieving role", problem.Detail)
+	assert.Equal(t, cause.Error(), problem.Internal)
+
+	t.Setenv("APP_ENV", "production")
+	_, problem = failWith(t, common.Internal("Error retrieving role", cause), "")
+	assert.Empty(t, problem.Internal)
+}
+
+func TestProblemValidation(t *testing.T) {
+	resp, problem := failWith(t, common.Validation("Password does not meet the policy", []string{"too short"}), "")
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.Equal(t, common.CodeValidation, problem.Code)
+	assert.Equal(t, []interface{}{"too short"}, problem.Errors)
+}
+
+func TestProblemNegotiated(t *testing.T) {
+	resp, _ := failWith(t, common.NotFound("Role not found"), "application/xml")
+	assert.Equal(t, http.StatusNotFound, resp.Code)
+	assert.Equal(t, "application/problem+xml", resp.Header().Get(echo.HeaderContentType))
+	assert.Contains(t, resp.Body.String(), "<code>not_found</code>")
+
+	// clients accepting nothing we write still get problem json
+	resp, _ = failWith(t, common.NotFound("Role not found"), "image/png")
+	assert.Equal(t, common.MIMEApplicationProblemJSON, resp.Header().Get(echo.HeaderContentType))
+}
+
+func TestProblemQueryLocalized(t *testing.T) {
+	params, _ := url.ParseQuery("filter[secret][eq]=x&filter[id][eq]=one")
+	_, err := common.ParseFilters(pageDB(t, 1).Model(&pageItem{}), params)
+
+	// list parameter problems are catalogue messages in the language of the request
+	req := httptest.NewRequest(http.MethodGet, "/admin/role", nil)
+	req.Header.Set("Accept-Language", "fr")
+	resp := httptest.NewRecorder()
+	common.HTTPErrorHandler(err, echo.New().NewContext(req, resp))
+
+	var problem common.Problem
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &problem))
+	assert.Equal(t, common.CodeInvalidQuery, problem.Code)
+	assert.Equal(t, "Les filtres ne sont pas valides", problem.Detail)
+	assert.Equal(t, []interface{}{"id[eq] : « one » n'est pas un nombre positif", "secret ne peut pas être filtré"}, problem.Errors)
+}
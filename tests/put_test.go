@@ -0,0 +1,81 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/models"
+	"semay.com/models/controlers"
+	"semay.com/validation"
+)
+
+func TestPutRole(t *testing.T) {
+	db := roleDB(t)
+	controlers.Roles.DB = func() *gorm.DB { return db }
+	t.Cleanup(func() { controlers.Roles.DB = nil })
+
+	app := echo.New()
+	app.Validator = validation.New(controlers.Roles.DB)
+	app.PUT("/admin/role/:role_id", controlers.PutRole)
+
+	put := func(path string, body string) (*httptest.ResponseRecorder, models.Role) {
+		req := httptest.NewRequest(http.MethodPut, path, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+
+		var stored models.Role
+		db.Where("id = ?", req.URL.Path[len("/admin/role/"):]).Limit(1).Find(&stored)
+		return resp, stored
+	}
+
+	// a missing role is created at the given id, inactive if asked to
+	resp, stored := put("/admin/role/10", `{"name":"editor","description":"edits","active":false}`)
+	assert.Equal(t, http.StatusCreated, resp.Code)
+	assert.Equal(t, "/admin/role/10", resp.Header().Get(echo.HeaderLocation))
+	assert.Equal(t, models.Role{ID: 10, Name: "editor", Description: "edits", Active: false}, stored)
+
+	// every field is replaced and every field is required
+	resp, stored = put("/admin/role/10", `{"name":"editor","description":"edits all","active":true}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.Equal(t, models.Role{ID: 10, Name: "editor", Description: "edits all", Active: true}, stored)
+	resp, stored = put("/admin/role/1", `{"name":"taken","description":"now off","active":false}`)
+	assert.Equal(t, http.StatusOK, resp.Code)
+	assert.False(t, stored.Active)
+
+	// every switch of the status is recorded, the creation of an inactive role included
+	var changes []models.RoleStatusChange
+	assert.NoError(t, db.Order("id").Find(&changes).Error)
+	statuses := make([]interface{}, 0)
+	for _, change := range changes {
+		statuses = append(statuses, []interface{}{change.RoleID, change.Active, change.Reason})
+	}
+	assert.Equal(t, []interface{}{
+		[]interface{}{uint(10), false, "set by replacing the role"},
+		[]interface{}{uint(10), true, "set by replacing the role"},
+		[]interface{}{uint(1), false, "set by replacing the role"},
+	}, statuses)
+
+	var body map[string]interface{}
+	resp, _ = put("/admin/role/10", `{"name":"editor"}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+	assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &body))
+	assert.Len(t, body["errors"], 2)
+
+	resp, _ = put("/admin/role/11", `{"name":"taken","description":"other","active":true}`)
+	assert.Equal(t, http.StatusConflict, resp.Code)
+	resp, _ = put("/admin/role/0", `{"name":"zero","description":"zero","active":true}`)
+	assert.Equal(t, http.StatusBadRequest, resp.Code)
+
+	// generated ids go on after those given by clients
+	assert.NoError(t, db.Create(&models.Role{Name: "next", Description: "next"}).Error)
+	var next models.Role
+	assert.NoError(t, db.Where("name = ?", "next").First(&next).Error)
+	assert.Equal(t, uint(11), next.ID)
+}
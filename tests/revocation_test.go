@@ -0,0 +1,71 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/utils"
+)
+
+func TestMemoryRevocationStore(t *testing.T) {
+	store := utils.NewMemoryRevocationStore(0)
+
+	// revoked jti are reported until they are purged after expiry
+	store.Revoke("expired", time.Now().Add(-time.Minute))
+	store.Revoke("current", time.Now().Add(time.Hour))
+
+	revoked, _ := store.IsRevoked("current")
+	assert.True(t, revoked)
+	revoked, _ = store.IsRevoked("unknown")
+	assert.False(t, revoked)
+
+	store.Purge()
+	revoked, _ = store.IsRevoked("expired")
+	assert.False(t, revoked, "expired entries are purged")
+	revoked, _ = store.IsRevoked("current")
+	assert.True(t, revoked, "entries are kept until the token expires")
+
+	// revoking all tokens of a user bumps only that user's generation
+	generation, _ := store.Generation("user-a")
+	assert.Equal(t, uint(0), generation)
+	bumped, _ := store.RevokeAll("user-a")
+	assert.Equal(t, uint(1), bumped)
+	generation, _ = store.Generation("user-b")
+	assert.Equal(t, uint(0), generation)
+}
+
+func TestParseJWTTokenRevocation(t *testing.T) {
+	utils.TokenRevocations = utils.NewMemoryRevocationStore(0)
+
+	token, err := utils.CreateJWTToken("user@example.com", "user-uuid", []string{"viewer"}, 5, "")
+	assert.NoError(t, err)
+
+	claim, err := utils.ParseJWTToken(token)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, claim.ID, "tokens carry a jti")
+
+	// a logged out token is rejected
+	assert.NoError(t, utils.RevokeJWTToken(claim))
+	_, err = utils.ParseJWTToken(token)
+	assert.ErrorIs(t, err, utils.ErrTokenRevoked)
+
+	// tokens issued before a revoke all are rejected, newer ones are not
+	old_token, _ := utils.CreateJWTToken("user@example.com", "user-uuid", []string{"viewer"}, 5, "")
+	utils.TokenRevocations.RevokeAll("user-uuid")
+	_, err = utils.ParseJWTToken(old_token)
+	assert.ErrorIs(t, err, utils.ErrTokenRevoked)
+
+	new_token, _ := utils.CreateJWTToken("user@example.com", "user-uuid", []string{"viewer"}, 5, "")
+	_, err = utils.ParseJWTToken(new_token)
+	assert.NoError(t, err)
+}
+
+func TestDBRevocationStoreMissingUser(t *testing.T) {
+	_, db := serverApp(t)
+	store := utils.NewDBRevocationStore(db, 0)
+
+	// users no longer stored have all their tokens revoked
+	_, err := store.Generation("deleted-uuid")
+	assert.ErrorIs(t, err, utils.ErrTokenRevoked)
+}
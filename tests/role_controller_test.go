@@ -12,8 +12,10 @@ import (
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
+	"semay.com/database"
 	"semay.com/models"
 	"semay.com/models/controlers"
+	"semay.com/validation"
 )
 
 // ##########################################################################
@@ -40,13 +42,13 @@ var testsRolesPostID = []struct {
 	// Second test case
 	{
 		name:        "get Role By ID check - 2",
-		description: "get HTTP status 404, when Role Does not exist",
+		description: "get HTTP status 409, when the Role name is taken",
 		route:       "/admin/role",
 		post_data: models.RolePost{
 			Name:        "Name one",
 			Description: "Description of Name one",
 		},
-		expectedCode: 500,
+		expectedCode: 409,
 	},
 }
 
@@ -57,6 +59,7 @@ func TestPostRolesByID(t *testing.T) {
 
 	// Setup Test APP
 	TestApp := echo.New()
+	TestApp.Validator = validation.New(database.ReturnSession)
 
 	// Iterate through test single test cases
 	for _, test := range testsRolesPostID {
@@ -166,6 +169,7 @@ func TestPatchRolesByID(t *testing.T) {
 
 	// Setup Test APP
 	TestApp := echo.New()
+	TestApp.Validator = validation.New(database.ReturnSession)
 
 	// Iterate through test single test cases
 	for _, test := range testsRolesPatchID {
@@ -239,6 +243,7 @@ func TestGetRoles(t *testing.T) {
 
 	// Setup Test APP
 	TestApp := echo.New()
+	TestApp.Validator = validation.New(database.ReturnSession)
 
 	// Iterate through test single test cases
 	for _, test := range testsRolesGet {
@@ -300,6 +305,7 @@ func TestGetRolesByID(t *testing.T) {
 
 	// Setup Test APP
 	TestApp := echo.New()
+	TestApp.Validator = validation.New(database.ReturnSession)
 
 	// Iterate through test single test cases
 	for _, test := range testsRolesGetByID {
@@ -0,0 +1,98 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/middlewares"
+	"semay.com/models"
+	"semay.com/models/controlers"
+	"semay.com/utils"
+	"semay.com/validation"
+)
+
+func TestRoleActivation(t *testing.T) {
+	db := roleDB(t)
+	assert.NoError(t, db.AutoMigrate(&models.RoleStatusChange{}))
+	controlers.Roles.DB = func() *gorm.DB { return db }
+	t.Cleanup(func() { controlers.Roles.DB = nil })
+
+	app := echo.New()
+	app.Validator = validation.New(controlers.Roles.DB)
+	as_admin := func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(contx echo.Context) error {
+			contx.Set(middlewares.UserClaimKey, utils.UserClaim{Email: "admin@example.com"})
+			return next(contx)
+		}
+	}
+	app.POST("/admin/role/:role_id/activate", controlers.ActivateRole, as_admin)
+	app.POST("/admin/role/:role_id/deactivate", controlers.DeactivateRole, as_admin)
+	controlers.Roles.Register(app.Group("/admin", as_admin))
+
+	send := func(method string, path string, body string) int {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/admin/role/1/deactivate", `{}`))
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/admin/role/1/deactivate", `{"reason":"replaced by editor"}`))
+	assert.Equal(t, http.StatusConflict, send(http.MethodPost, "/admin/role/1/deactivate", `{"reason":"twice"}`))
+	assert.Equal(t, http.StatusNotFound, send(http.MethodPost, "/admin/role/9/activate", `{"reason":"missing"}`))
+
+	var role models.Role
+	assert.NoError(t, db.First(&role, 1).Error)
+	assert.False(t, role.Active)
+
+	// the list keeps the active or the deactivated roles
+	assert.NoError(t, db.Create(&models.Role{Name: "editor", Description: "edits"}).Error)
+	total := func(query string) interface{} {
+		req := httptest.NewRequest(http.MethodGet, "/admin/role?"+query, nil)
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+		var page map[string]interface{}
+		assert.NoError(t, json.Unmarshal(resp.Body.Bytes(), &page))
+		return page["total"]
+	}
+	assert.Equal(t, float64(1), total("active=true"))
+	assert.Equal(t, float64(1), total("active=false"))
+	assert.Equal(t, float64(2), total(""))
+	assert.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/admin/role?active=sometimes", ""))
+
+	assert.Equal(t, http.StatusOK, send(http.MethodPost, "/admin/role/1/activate", `{"reason":"editor withdrawn"}`))
+
+	var changes []models.RoleStatusChange
+	assert.NoError(t, db.Order("id").Find(&changes).Error)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, []interface{}{false, "replaced by editor", "admin@example.com"}, []interface{}{changes[0].Active, changes[0].Reason, changes[0].Actor})
+	assert.Equal(t, []interface{}{true, "editor withdrawn", "admin@example.com"}, []interface{}{changes[1].Active, changes[1].Reason, changes[1].Actor})
+
+	// patches switching the status are recorded too, patches keeping it are not
+	assert.Equal(t, http.StatusOK, send(http.MethodPatch, "/admin/role/1", `{"active":false}`))
+	assert.Equal(t, http.StatusOK, send(http.MethodPatch, "/admin/role/1", `{"active":false,"description":"still off"}`))
+	assert.NoError(t, db.First(&role, 1).Error)
+	assert.Equal(t, models.Role{ID: 1, Name: "taken", Description: "still off", Active: false}, role)
+	changes = nil
+	assert.NoError(t, db.Order("id").Find(&changes).Error)
+	assert.Len(t, changes, 3)
+	assert.Equal(t, []interface{}{false, "set by patching the role", "admin@example.com"}, []interface{}{changes[2].Active, changes[2].Reason, changes[2].Actor})
+}
+
+func TestActor(t *testing.T) {
+	contx := echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/", nil), httptest.NewRecorder())
+	assert.Equal(t, "", middlewares.Actor(contx))
+
+	contx.Set(middlewares.APIKeyKey, models.APIKey{Prefix: "ab12cd"})
+	assert.Equal(t, "api_key:ab12cd", middlewares.Actor(contx))
+
+	contx.Set(middlewares.UserClaimKey, utils.UserClaim{Email: "user@example.com"})
+	assert.Equal(t, "user@example.com", middlewares.Actor(contx))
+}
@@ -0,0 +1,30 @@
+//go:build sqlite_fts5
+
+package tests
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearchUsesFTS5(t *testing.T) {
+	db := searchDB(t)
+
+	var tables int64
+	assert.NoError(t, db.Raw("SELECT count(*) FROM sqlite_master WHERE type = 'table' AND name = ?", "search_items_fts").Scan(&tables).Error)
+	assert.Equal(t, int64(1), tables)
+
+	// bm25 ranks and marks the matched words, which LIKE does not
+	var hits []searchHit
+	assert.NoError(t, searchIndex.Apply(db.Model(&searchItem{}), "invoices").Find(&hits).Error)
+	assert.Len(t, hits, 1)
+	assert.Greater(t, hits[0].Rank, 0.0)
+	assert.Equal(t, "manages <mark>invoices</mark>", hits[0].Highlight.Description)
+
+	assert.NoError(t, db.Create(&searchItem{Name: "intruder", Description: `<b>bold</b> invoices`}).Error)
+	hits = nil
+	assert.NoError(t, searchIndex.Apply(db.Model(&searchItem{}), "bold").Find(&hits).Error)
+	assert.Len(t, hits, 1)
+	assert.Equal(t, "&lt;b&gt;<mark>bold</mark>&lt;/b&gt; invoices", hits[0].Highlight.Description)
+}
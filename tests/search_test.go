@@ -0,0 +1,90 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"semay.com/search"
+)
+
+type searchItem struct {
+	ID          uint `gorm:"primaryKey"`
+	Name        string
+	Description string
+}
+
+type searchHit struct {
+	Item      searchItem `gorm:"embedded"`
+	Rank      float64    `gorm:"column:search_rank"`
+	Highlight struct {
+		Name        string
+		Description string
+	} `gorm:"embedded;embeddedPrefix:highlight_"`
+}
+
+var searchIndex = search.Index{Table: "search_items", Columns: []string{"name", "description"}}
+
+// runs on FTS5 when built with -tags sqlite_fts5, as make test does, and on the LIKE fallback otherwise
+func searchDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&searchItem{}))
+
+	// rows written before the index exists are indexed too
+	assert.NoError(t, db.Create(&searchItem{Name: "administrator", Description: "full access to the admin area"}).Error)
+	assert.NoError(t, searchIndex.Migrate(db))
+	assert.NoError(t, db.Create(&searchItem{Name: "viewer", Description: "read only access, admin dashboards"}).Error)
+	assert.NoError(t, db.Create(&searchItem{Name: "billing", Description: "manages invoices"}).Error)
+	return db
+}
+
+func searchIDs(t *testing.T, db *gorm.DB, q string) []uint {
+	var hits []searchHit
+	query := searchIndex.Apply(db.Model(&searchItem{}), q).Order("search_rank desc").Order("id")
+	assert.NoError(t, query.Find(&hits).Error)
+
+	ids := make([]uint, 0)
+	for _, hit := range hits {
+		ids = append(ids, hit.Item.ID)
+		assert.NotEmpty(t, hit.Highlight.Name)
+	}
+	return ids
+}
+
+func TestSearchTerms(t *testing.T) {
+	assert.Equal(t, []string{"admin", "access"}, search.Terms(` Admin "access*" `))
+	assert.Nil(t, search.Terms(`"* -`))
+	assert.Nil(t, search.Terms(""))
+}
+
+func TestSearchIndex(t *testing.T) {
+	db := searchDB(t)
+
+	// matches in both columns rank before a match in the description only
+	assert.Equal(t, []uint{1, 2}, searchIDs(t, db, "admin"))
+	// every word has to match, as a prefix
+	assert.Equal(t, []uint{2}, searchIDs(t, db, "admin dash"))
+	assert.Empty(t, searchIDs(t, db, "admin invoices"))
+
+	// the index follows updates and deletes of the table
+	assert.NoError(t, db.Model(&searchItem{ID: 3}).Update("description", "admin of invoices").Error)
+	assert.Equal(t, []uint{3}, searchIDs(t, db, "admin invoices"))
+	assert.NoError(t, db.Delete(&searchItem{ID: 2}).Error)
+	assert.Equal(t, []uint{1, 3}, searchIDs(t, db, "admin"))
+}
+
+func TestSearchHighlightsAreEscaped(t *testing.T) {
+	db := searchDB(t)
+	assert.NoError(t, db.Create(&searchItem{Name: "intruder", Description: `<img src=x onerror="alert('admin')"> & more`}).Error)
+
+	var hits []searchHit
+	assert.NoError(t, searchIndex.Apply(db.Model(&searchItem{}), "onerror").Find(&hits).Error)
+	assert.Len(t, hits, 1)
+
+	// stored markup comes back as text, only the marks are tags
+	highlight := strings.NewReplacer("<mark>", "", "</mark>", "").Replace(hits[0].Highlight.Description)
+	assert.Equal(t, `&lt;img src=x onerror=&#34;alert(&#39;admin&#39;)&#34;&gt; &amp; more`, highlight)
+}
@@ -0,0 +1,336 @@
+package tests
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"semay.com/models"
+	"semay.com/models/controlers"
+	"semay.com/sso"
+	"semay.com/utils"
+)
+
+// fakeProvider is an in-process OpenID Connect provider
+// it issues a code for every authorize request and checks PKCE on the token request
+type fakeProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	email    string
+	groups   []string
+	// when set the id token carries this nonce instead of the requested one
+	nonce string
+	// email_verified claim of the id token, left out when nil
+	emailVerified interface{}
+
+	mu    sync.Mutex
+	codes map[string]url.Values
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	provider := &fakeProvider{
+		key:      key,
+		clientID: "blue-admin",
+		email:    "admin@example.com",
+		groups:   []string{"idp-admins", "viewer"},
+		codes:    make(map[string]url.Values),
+
+		emailVerified: true,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", provider.discovery)
+	mux.HandleFunc("/authorize", provider.authorize)
+	mux.HandleFunc("/token", provider.token)
+	mux.HandleFunc("/keys", provider.keys)
+	provider.server = httptest.NewServer(mux)
+	t.Cleanup(provider.server.Close)
+	return provider
+}
+
+func (p *fakeProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *fakeProvider) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	code := base64.RawURLEncoding.EncodeToString([]byte(query.Get("state")))
+
+	p.mu.Lock()
+	p.codes[code] = query
+	p.mu.Unlock()
+
+	redirect, _ := url.Parse(query.Get("redirect_uri"))
+	values := redirect.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirect.RawQuery = values.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+func (p *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+
+	p.mu.Lock()
+	request, ok := p.codes[r.Form.Get("code")]
+	delete(p.codes, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	// PKCE S256: the challenge is the hash of the verifier sent now
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != request.Get("code_challenge") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	nonce := request.Get("nonce")
+	if p.nonce != "" {
+		nonce = p.nonce
+	}
+	claims := jwt.MapClaims{
+		"iss":    p.server.URL,
+		"aud":    p.clientID,
+		"sub":    "subject-1",
+		"iat":    time.Now().Unix(),
+		"exp":    time.Now().Add(time.Minute).Unix(),
+		"nonce":  nonce,
+		"email":  p.email,
+		"groups": p.groups,
+	}
+	if p.emailVerified != nil {
+		claims["email_verified"] = p.emailVerified
+	}
+	id_token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	id_token.Header["kid"] = "test-key"
+	signed, _ := id_token.SignedString(p.key)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     signed,
+	})
+}
+
+func (p *fakeProvider) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": "test-key",
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// login follows the authorization URL to the fake provider and returns the callback parameters
+func (p *fakeProvider) login(t *testing.T, auth_url string) url.Values {
+	client := &http.Client{CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(auth_url)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	assert.NoError(t, err)
+	return location.Query()
+}
+
+func newSSOClient(t *testing.T, provider *fakeProvider) *sso.Client {
+	client, err := sso.NewClient(context.Background(), sso.Config{
+		IssuerURL:   provider.server.URL,
+		ClientID:    provider.clientID,
+		RedirectURL: "http://localhost/auth/oidc/callback",
+		Scopes:      []string{"email", "groups"},
+		GroupsClaim: "groups",
+		GroupRoles:  map[string]string{"idp-admins": "superuser"},
+		StateKey:    "test state key",
+	})
+	assert.NoError(t, err)
+	return client
+}
+
+func TestSSOAuthorizationCodeFlow(t *testing.T) {
+	provider := newFakeProvider(t)
+	client := newSSOClient(t, provider)
+
+	auth_url, cookie, err := client.AuthCodeURL()
+	assert.NoError(t, err)
+
+	// the browser is sent with PKCE, state and nonce
+	parsed, _ := url.Parse(auth_url)
+	assert.Equal(t, "S256", parsed.Query().Get("code_challenge_method"))
+	assert.NotEmpty(t, parsed.Query().Get("state"))
+	assert.NotEmpty(t, parsed.Query().Get("nonce"))
+
+	callback := provider.login(t, auth_url)
+	identity, err := client.Exchange(context.Background(), cookie, callback.Get("state"), callback.Get("code"))
+	assert.NoError(t, err)
+	assert.Equal(t, "admin@example.com", identity.Email)
+	assert.Equal(t, []string{"idp-admins", "viewer"}, identity.Groups)
+
+	// mapped groups are renamed, the others grant nothing
+	assert.Equal(t, []string{"superuser"}, client.MapRoles(identity.Groups))
+
+	// a code can not be replayed
+	_, err = client.Exchange(context.Background(), cookie, callback.Get("state"), callback.Get("code"))
+	assert.Error(t, err)
+}
+
+func TestSSORejectsWrongNonce(t *testing.T) {
+	provider := newFakeProvider(t)
+	provider.nonce = "not-the-requested-nonce"
+	client := newSSOClient(t, provider)
+
+	auth_url, cookie, _ := client.AuthCodeURL()
+	callback := provider.login(t, auth_url)
+	_, err := client.Exchange(context.Background(), cookie, callback.Get("state"), callback.Get("code"))
+	assert.ErrorIs(t, err, sso.ErrInvalidNonce)
+}
+
+func TestSSORejectsCodeOfAnotherLogin(t *testing.T) {
+	provider := newFakeProvider(t)
+	client := newSSOClient(t, provider)
+
+	// the code of the first login is redeemed with the verifier of the second
+	first_url, _, _ := client.AuthCodeURL()
+	second_url, second_cookie, _ := client.AuthCodeURL()
+	first := provider.login(t, first_url)
+	second := provider.login(t, second_url)
+
+	_, err := client.Exchange(context.Background(), second_cookie, second.Get("state"), first.Get("code"))
+	assert.Error(t, err)
+}
+
+func TestSSORejectsLoginOfAnotherBrowser(t *testing.T) {
+	provider := newFakeProvider(t)
+	client := newSSOClient(t, provider)
+
+	// a callback planted by an attacker does not match the state cookie of the victim
+	attacker_url, _, _ := client.AuthCodeURL()
+	_, victim_cookie, _ := client.AuthCodeURL()
+	attacker := provider.login(t, attacker_url)
+	_, err := client.Exchange(context.Background(), victim_cookie, attacker.Get("state"), attacker.Get("code"))
+	assert.ErrorIs(t, err, sso.ErrInvalidState)
+
+	// nor is a forged or missing cookie accepted
+	_, err = client.Exchange(context.Background(), "", attacker.Get("state"), attacker.Get("code"))
+	assert.ErrorIs(t, err, sso.ErrInvalidState)
+	_, err = client.Exchange(context.Background(), victim_cookie+"x", attacker.Get("state"), attacker.Get("code"))
+	assert.ErrorIs(t, err, sso.ErrInvalidState)
+}
+
+func TestSSORequiresVerifiedEmail(t *testing.T) {
+	provider := newFakeProvider(t)
+	client := newSSOClient(t, provider)
+
+	for _, verified := range []interface{}{nil, false} {
+		provider.emailVerified = verified
+		auth_url, cookie, _ := client.AuthCodeURL()
+		callback := provider.login(t, auth_url)
+		_, err := client.Exchange(context.Background(), cookie, callback.Get("state"), callback.Get("code"))
+		assert.ErrorIs(t, err, sso.ErrMissingEmail)
+	}
+}
+
+func TestProvisionSSOUser(t *testing.T) {
+	_, db := serverApp(t)
+	for _, name := range []string{"viewer", "editor", "auditor"} {
+		assert.NoError(t, db.Create(&models.Role{Name: name, Description: name + " role"}).Error)
+	}
+	identity := sso.Identity{Subject: "subject-1", Email: "sso@example.com"}
+
+	user, err := controlers.ProvisionSSOUser(db, identity, []string{"viewer", "editor"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"viewer", "editor"}, roleNames(user.Roles))
+
+	// roles assigned here survive the next login, those the provider takes away are removed
+	var auditor models.Role
+	db.Where("name = ?", "auditor").First(&auditor)
+	assert.NoError(t, db.Model(&user).Association("Roles").Append(&auditor))
+	token, err := utils.CreateJWTToken(user.Email, user.UUID, []string{"viewer", "editor"}, 5, "")
+	assert.NoError(t, err)
+
+	user, err = controlers.ProvisionSSOUser(db, identity, []string{"viewer"})
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"viewer", "auditor"}, roleNames(user.Roles))
+	_, err = utils.ParseJWTToken(token)
+	assert.ErrorIs(t, err, utils.ErrTokenRevoked, "tokens carrying a removed role are revoked")
+
+	// the provider can not take a manually assigned role away either
+	user, err = controlers.ProvisionSSOUser(db, identity, []string{"viewer", "auditor"})
+	assert.NoError(t, err)
+	user, err = controlers.ProvisionSSOUser(db, identity, []string{})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"auditor"}, roleNames(user.Roles))
+
+	// a local account is not taken over because the provider reports its email
+	createUser(t, db, "local@example.com")
+	_, err = controlers.ProvisionSSOUser(db, sso.Identity{Subject: "subject-2", Email: "local@example.com"}, []string{"viewer"})
+	assert.ErrorIs(t, err, controlers.ErrSSOAccountExists)
+}
+
+func TestOIDCCallback(t *testing.T) {
+	app, db := serverApp(t)
+	provider := newFakeProvider(t)
+	sso.SetDefault(newSSOClient(t, provider))
+	defer sso.SetDefault(nil)
+	assert.NoError(t, db.Create(&models.Role{Name: "superuser", Description: "superuser role"}).Error)
+
+	// login sets the state cookie the callback has to come back with
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil)
+	resp := httptest.NewRecorder()
+	app.ServeHTTP(resp, req)
+	assert.Equal(t, http.StatusFound, resp.Code)
+	cookies := resp.Result().Cookies()
+	assert.Len(t, cookies, 1)
+	assert.Equal(t, sso.StateCookie, cookies[0].Name)
+	assert.True(t, cookies[0].HttpOnly)
+	callback := provider.login(t, resp.Header().Get("Location"))
+
+	status, _ := serverRequest(app, http.MethodGet, "/auth/oidc/callback?"+callback.Encode(), "")
+	assert.Equal(t, http.StatusUnauthorized, status)
+
+	// the role of the provider group still owes the second factor
+	status, answer := serverRequest(app, http.MethodGet, "/auth/oidc/callback?"+callback.Encode(), "", "Cookie", cookies[0].Name+"="+cookies[0].Value)
+	assert.Equal(t, http.StatusOK, status)
+	data := answer["data"].(map[string]interface{})
+	assert.NotContains(t, data, "access_token")
+	assert.Equal(t, true, data["enrollment_required"])
+}
+
+func roleNames(roles []models.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
@@ -0,0 +1,84 @@
+package tests
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"semay.com/utils"
+)
+
+// ##########################################################################
+// RFC 6238 appendix B vectors for SHA1, truncated to 6 digits
+var testsTOTPCode = []struct {
+	name        string // name of the test
+	description string // description of the test case
+	unix        int64  // moment of the code
+	code        string // expected code
+}{
+	{name: "totp vector - 1", description: "T = 59", unix: 59, code: "287082"},
+	{name: "totp vector - 2", description: "T = 1111111109", unix: 1111111109, code: "081804"},
+	{name: "totp vector - 3", description: "T = 1234567890", unix: 1234567890, code: "005924"},
+	{name: "totp vector - 4", description: "T = 2000000000", unix: 2000000000, code: "279037"},
+}
+
+// base32 of the RFC secret "12345678901234567890"
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	for _, test := range testsTOTPCode {
+		t.Run(test.name, func(t *testing.T) {
+			code, err := utils.TOTPCode(rfcTOTPSecret, utils.TOTPStep(time.Unix(test.unix, 0)))
+			assert.NoError(t, err)
+			assert.Equalf(t, test.code, code, test.description)
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	moment := time.Unix(1234567890, 0)
+	current := utils.TOTPStep(moment)
+
+	// codes of the neighbouring steps are accepted for clock drift
+	previous, _ := utils.TOTPCode(rfcTOTPSecret, current-1)
+	step, ok := utils.ValidateTOTP(rfcTOTPSecret, previous, moment, 0)
+	assert.True(t, ok)
+	assert.Equal(t, current-1, step)
+
+	// steps already used are refused
+	_, ok = utils.ValidateTOTP(rfcTOTPSecret, previous, moment, current-1)
+	assert.False(t, ok, "replayed code")
+
+	// codes further away are refused
+	old, _ := utils.TOTPCode(rfcTOTPSecret, current-3)
+	_, ok = utils.ValidateTOTP(rfcTOTPSecret, old, moment, 0)
+	assert.False(t, ok, "expired code")
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri := utils.TOTPProvisioningURI("Blue Admin", "admin@example.com", rfcTOTPSecret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Blue%20Admin:admin@example.com?"))
+	assert.Contains(t, uri, "secret="+rfcTOTPSecret)
+	assert.Contains(t, uri, "issuer=Blue+Admin")
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := utils.GenerateRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, utils.UniqueSlice(codes), 10)
+
+	// codes typed in upper case or without dash still match
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	assert.Equal(t, codes[0], utils.NormalizeRecoveryCode(typed))
+}
+
+func TestEncryptSecret(t *testing.T) {
+	sealed, err := utils.EncryptSecret(rfcTOTPSecret)
+	assert.NoError(t, err)
+	assert.NotContains(t, sealed, rfcTOTPSecret)
+
+	plain, err := utils.DecryptSecret(sealed)
+	assert.NoError(t, err)
+	assert.Equal(t, rfcTOTPSecret, plain)
+}
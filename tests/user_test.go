@@ -0,0 +1,264 @@
+package tests
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/database"
+	"semay.com/manager"
+	"semay.com/models"
+	"semay.com/utils"
+)
+
+const testPassword = "Passw0rdA"
+
+// serverApp builds the routes of the server on a fresh sqlite database
+func serverApp(t *testing.T) (*echo.Echo, *gorm.DB) {
+	t.Setenv("DB_TYPE", "sqlite")
+	t.Setenv("SQLITE_URI", filepath.Join(t.TempDir(), "app.db"))
+	t.Setenv("SECRETE_SALT", "test salt")
+	assert.NoError(t, models.InitDatabase())
+
+	app := echo.New()
+	manager.SetupRoutes(app)
+	return app, database.ReturnSession()
+}
+
+// grantRoutes creates the permissions of the admin routes whose names are given, all of them
+// when none are, and grants them to a new role
+func grantRoutes(t *testing.T, app *echo.Echo, db *gorm.DB, role_name string, names ...string) models.Role {
+	role := models.Role{Name: role_name, Description: role_name + " role"}
+	assert.NoError(t, db.Create(&role).Error)
+	for _, route := range app.Routes() {
+		if route.Method == echo.RouteNotFound || !strings.HasPrefix(route.Path, "/admin/") || (len(names) > 0 && !utils.ValueInSlice(names, route.Name)) {
+			continue
+		}
+		permission := models.Permission{Name: route.Name, Description: route.Method + " " + route.Path, Active: true}
+		assert.NoError(t, db.Where("name = ?", route.Name).FirstOrCreate(&permission).Error)
+		assert.NoError(t, db.Model(&role).Association("Permissions").Append(&permission))
+	}
+	return role
+}
+
+// createUser stores an active user holding roles, with testPassword
+func createUser(t *testing.T, db *gorm.DB, email string, roles ...models.Role) models.User {
+	user := models.User{Email: email, Password: utils.HashFunc(testPassword), UUID: uuid.New().String(), Roles: roles}
+	assert.NoError(t, db.Create(&user).Error)
+	return user
+}
+
+// serverRequest sends a JSON request with the given headers and decodes the answer
+func serverRequest(app *echo.Echo, method string, path string, body string, headers ...string) (int, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp := httptest.NewRecorder()
+	app.ServeHTTP(resp, req)
+	answer := make(map[string]interface{})
+	json.Unmarshal(resp.Body.Bytes(), &answer)
+	return resp.Code, answer
+}
+
+// login returns the access token of the user, or an empty one when the login fails
+func login(t *testing.T, app *echo.Echo, email string, password string) string {
+	_, answer := serverRequest(app, http.MethodPost, "/auth/login", `{"email":"`+email+`","password":"`+password+`"}`)
+	data, _ := answer["data"].(map[string]interface{})
+	token, _ := data["access_token"].(string)
+	return token
+}
+
+func bearer(token string) []string {
+	return []string{echo.HeaderAuthorization, "Bearer " + token}
+}
+
+func TestLoginClaims(t *testing.T) {
+	app, db := serverApp(t)
+	editor := models.Role{Name: "editor", Description: "editor role"}
+	retired := models.Role{Name: "retired", Description: "retired role"}
+	assert.NoError(t, db.Create(&editor).Error)
+	assert.NoError(t, db.Create(&retired).Error)
+	assert.NoError(t, db.Model(&retired).UpdateColumn("active", false).Error)
+	createUser(t, db, "writer@example.com", editor, retired)
+
+	// only the active roles are carried by the token
+	token := login(t, app, "writer@example.com", testPassword)
+	claim, err := utils.ParseJWTToken(token)
+	assert.NoError(t, err)
+	assert.Equal(t, "writer@example.com", claim.Email)
+	assert.Equal(t, []string{"editor"}, claim.Roles)
+
+	status, _ := serverRequest(app, http.MethodPost, "/auth/login", `{"email":"writer@example.com","password":"wrong"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = serverRequest(app, http.MethodPost, "/auth/login", `{"email":"nobody@example.com","password":"`+testPassword+`"}`)
+	assert.Equal(t, http.StatusUnauthorized, status)
+}
+
+func TestUserEndpoints(t *testing.T) {
+	app, db := serverApp(t)
+	admin := grantRoutes(t, app, db, "admin")
+	createUser(t, db, "admin@example.com", admin)
+	auth := bearer(login(t, app, "admin@example.com", testPassword))
+	editor := models.Role{Name: "editor", Description: "editor role"}
+	assert.NoError(t, db.Create(&editor).Error)
+
+	status, answer := serverRequest(app, http.MethodPost, "/admin/user", `{"email":"new@example.com","password":"`+testPassword+`"}`, auth...)
+	assert.Equal(t, http.StatusOK, status)
+	created := answer["data"].(map[string]interface{})
+	assert.Equal(t, "new@example.com", created["email"])
+	assert.NotContains(t, created, "password")
+	status, _ = serverRequest(app, http.MethodPost, "/admin/user", `{"email":"not an email","password":"`+testPassword+`"}`, auth...)
+	assert.Equal(t, http.StatusBadRequest, status)
+
+	// listed users carry the fields of their get representation
+	status, answer = serverRequest(app, http.MethodGet, "/admin/user?sort=id", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	listed := answer["data"].([]interface{})
+	assert.Len(t, listed, 2)
+	for _, item := range listed {
+		for key := range item.(map[string]interface{}) {
+			assert.Contains(t, []string{"id", "email", "uuid", "active", "mfa_enabled", "locale", "roles"}, key)
+		}
+	}
+	assert.Equal(t, "new@example.com", listed[1].(map[string]interface{})["email"])
+	status, answer = serverRequest(app, http.MethodGet, "/admin/user?fields=email", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, map[string]interface{}{"email": "admin@example.com"}, answer["data"].([]interface{})[0])
+
+	status, answer = serverRequest(app, http.MethodGet, "/admin/user/2", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, "new@example.com", answer["data"].(map[string]interface{})["email"])
+	status, _ = serverRequest(app, http.MethodGet, "/admin/user/9", "", auth...)
+	assert.Equal(t, http.StatusNotFound, status)
+
+	// the patched user is answered as it is stored now
+	status, answer = serverRequest(app, http.MethodPatch, "/admin/user/2", `{"email":"renamed@example.com","active":false}`, auth...)
+	assert.Equal(t, http.StatusOK, status)
+	patched := answer["data"].(map[string]interface{})
+	assert.Equal(t, []interface{}{"renamed@example.com", false}, []interface{}{patched["email"], patched["active"]})
+
+	// a taken email is a conflict, though a user keeps its own
+	status, _ = serverRequest(app, http.MethodPost, "/admin/user", `{"email":"renamed@example.com","password":"`+testPassword+`"}`, auth...)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = serverRequest(app, http.MethodPatch, "/admin/user/2", `{"email":"admin@example.com"}`, auth...)
+	assert.Equal(t, http.StatusConflict, status)
+	status, _ = serverRequest(app, http.MethodPatch, "/admin/user/2", `{"email":"renamed@example.com"}`, auth...)
+	assert.Equal(t, http.StatusOK, status)
+
+	// roles are assigned and unassigned
+	status, answer = serverRequest(app, http.MethodPost, "/admin/user/2/role/2", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Len(t, answer["data"].(map[string]interface{})["roles"], 1)
+	status, _ = serverRequest(app, http.MethodPost, "/admin/user/2/role/9", "", auth...)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, answer = serverRequest(app, http.MethodDelete, "/admin/user/2/role/2", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	assert.Empty(t, answer["data"].(map[string]interface{})["roles"])
+
+	// the deleted user is answered with the roles it held
+	serverRequest(app, http.MethodPost, "/admin/user/2/role/2", "", auth...)
+	status, answer = serverRequest(app, http.MethodDelete, "/admin/user/2", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	deleted := answer["data"].(map[string]interface{})
+	assert.Equal(t, "renamed@example.com", deleted["email"])
+	assert.Len(t, deleted["roles"], 1)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/user/2", "", auth...)
+	assert.Equal(t, http.StatusNotFound, status)
+	status, _ = serverRequest(app, http.MethodDelete, "/admin/user/2", "", auth...)
+	assert.Equal(t, http.StatusNotFound, status)
+}
+
+func TestDeletedUserTokens(t *testing.T) {
+	app, db := serverApp(t)
+	defer func(store utils.RevocationStore) { utils.TokenRevocations = store }(utils.TokenRevocations)
+	utils.TokenRevocations = utils.NewDBRevocationStore(db, 0)
+
+	admin := grantRoutes(t, app, db, "admin")
+	createUser(t, db, "admin@example.com", admin)
+	auth := bearer(login(t, app, "admin@example.com", testPassword))
+	createUser(t, db, "leaving@example.com", admin)
+	leaving := bearer(login(t, app, "leaving@example.com", testPassword))
+
+	status, _ := serverRequest(app, http.MethodGet, "/admin/role", "", leaving...)
+	assert.Equal(t, http.StatusOK, status)
+
+	// the tokens of a deleted user are refused even once its row is gone
+	status, _ = serverRequest(app, http.MethodDelete, "/admin/user/2", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", leaving...)
+	assert.Equal(t, http.StatusUnauthorized, status)
+	status, _ = serverRequest(app, http.MethodGet, "/admin/role", "", auth...)
+	assert.Equal(t, http.StatusOK, status)
+}
+
+func TestLoginLockout(t *testing.T) {
+	app, db := serverApp(t)
+	user := createUser(t, db, "locked@example.com")
+	assert.NotEmpty(t, login(t, app, "locked@example.com", testPassword))
+
+	// a locked account and an unknown email are answered alike
+	for _, email := range []string{"locked@example.com", "unknown@example.com"} {
+		status, _ := serverRequest(app, http.MethodPost, "/auth/login", `{"email":"`+email+`","password":"wrong"}`)
+		assert.Equal(t, http.StatusUnauthorized, status, email)
+		req := httptest.NewRequest(http.MethodPost, "/auth/login", bytes.NewBufferString(`{"email":"`+email+`","password":"wrong"}`))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		resp := httptest.NewRecorder()
+		app.ServeHTTP(resp, req)
+		assert.Equal(t, http.StatusLocked, resp.Code, email)
+		assert.Equal(t, "1", resp.Header().Get("Retry-After"), email)
+	}
+
+	// guesses sent together are counted together, only one gets past the lock
+	db.Model(&user).UpdateColumns(map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+	statuses := make(chan int, 8)
+	var wg sync.WaitGroup
+	for i := 0; i < cap(statuses); i++ {
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			status, _ := serverRequest(app, http.MethodPost, "/auth/login", `{"email":"locked@example.com","password":"wrong"}`, echo.HeaderXRealIP, address)
+			statuses <- status
+		}("198.51.100." + strconv.Itoa(i))
+	}
+	wg.Wait()
+	close(statuses)
+	counted := 0
+	for status := range statuses {
+		if status == http.StatusUnauthorized {
+			counted++
+		} else {
+			assert.Equal(t, http.StatusLocked, status)
+		}
+	}
+	assert.Equal(t, 1, counted)
+	db.First(&user, user.ID)
+	assert.Equal(t, 1, user.FailedLogins)
+}
+
+func TestLoginResetsAddressThrottle(t *testing.T) {
+	app, db := serverApp(t)
+	createUser(t, db, "known@example.com")
+	assert.NotEmpty(t, login(t, app, "known@example.com", testPassword))
+
+	// the free attempts of the address are given back by a successful login
+	for round := 0; round < 2; round++ {
+		for i := 0; i < 10; i++ {
+			email := uuid.New().String() + "@example.com"
+			status, _ := serverRequest(app, http.MethodPost, "/auth/login", `{"email":"`+email+`","password":"wrong"}`)
+			assert.Equal(t, http.StatusUnauthorized, status)
+		}
+		assert.NotEmpty(t, login(t, app, "known@example.com", testPassword))
+	}
+}
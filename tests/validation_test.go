@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm"
+	"semay.com/common"
+	"semay.com/i18n"
+	"semay.com/models"
+	"semay.com/validation"
+)
+
+func TestLanguages(t *testing.T) {
+	assert.Equal(t, []string{"fr_CA", "fr", "en"}, i18n.Languages("en;q=0.5, fr-ca"))
+	assert.Equal(t, []string{"es"}, i18n.Languages("*, es;q=0.8, de;q=0"))
+	assert.Empty(t, i18n.Languages(""))
+}
+
+func TestRoleRules(t *testing.T) {
+	db := roleDB(t)
+	validate := validation.New(func() *gorm.DB { return db })
+
+	tests := []struct {
+		value interface{}
+		rules []string
+	}{
+		{models.RolePost{Name: "editor", Description: "edits"}, nil},
+		{models.RolePost{Name: "Team lead.v2", Description: "leads"}, nil},
+		{models.RolePost{Name: " editor", Description: "edits"}, []string{"slugsafe"}},
+		{models.RolePost{Name: "a--b", Description: "edits"}, []string{"slugsafe"}},
+		{models.RolePost{Name: "x"}, []string{"min", "required"}},
+		{models.RolePost{Name: "taken", Description: "taken role"}, []string{"unique", "unique"}},
+		// a role keeps its own values
+		{models.RolePatch{ID: 1, Name: "taken"}, nil},
+		{models.RolePatch{ID: 2, Name: "taken"}, []string{"unique"}},
+		{models.RolePatch{}, nil},
+		{models.RolePut{ID: 1, Name: "taken"}, []string{"required", "required"}},
+		{models.RolePut{ID: 1, Name: "taken", Description: "off", Active: new(bool)}, nil},
+	}
+
+	for _, test := range tests {
+		rules := make([]string, 0)
+		for _, field_error := range validation.Errors(validate.Validate(test.value), validation.Translator()) {
+			rules = append(rules, field_error.Rule)
+		}
+		assert.ElementsMatch(t, test.rules, rules, "%+v", test.value)
+	}
+}
+
+func TestValidationErrors(t *testing.T) {
+	err := validation.New(nil).Validate(models.RolePost{Name: "x"})
+
+	field_errors := validation.Errors(err, validation.Translator(i18n.Languages("fr-FR, en;q=0.1")...))
+	assert.Equal(t, []validation.FieldError{
+		{Field: "name", Rule: "min", Param: "2", Message: "name doit faire une taille minimum de 2 caractères"},
+		{Field: "description", Rule: "required", Message: "description est un champ obligatoire"},
+	}, field_errors)
+
+	// unsupported languages fall back to English
+	assert.Equal(t, "description is a required field", validation.Errors(err, validation.Translator("de"))[1].Message)
+	assert.Equal(t, http.StatusBadRequest, common.Invalid(err).Status)
+}
+
+func TestUniqueIsConflict(t *testing.T) {
+	db := roleDB(t)
+	err := validation.New(func() *gorm.DB { return db }).Validate(models.RolePost{Name: "taken", Description: "free"})
+
+	invalid := common.Invalid(err)
+	assert.Equal(t, http.StatusConflict, invalid.Status)
+	assert.Equal(t, common.CodeConflict, invalid.Code)
+	assert.Equal(t, "name is already taken", validation.Errors(err, validation.Translator())[0].Message)
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// visible part every API key starts with, it identifies the key without revealing it
+const apiKeyPrefix = "gb"
+
+// GenerateAPIKey returns a new random key of the form gb_<prefix>_<secret> and its prefix
+func GenerateAPIKey() (string, string, error) {
+	prefix_bytes := make([]byte, 6)
+	secret_bytes := make([]byte, 32)
+	if _, err := rand.Read(prefix_bytes); err != nil {
+		return "", "", fmt.Errorf("error generating api key: %v", err)
+	}
+	if _, err := rand.Read(secret_bytes); err != nil {
+		return "", "", fmt.Errorf("error generating api key: %v", err)
+	}
+
+	prefix := apiKeyPrefix + "_" + hex.EncodeToString(prefix_bytes)
+	key := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret_bytes)
+	return key, prefix, nil
+}
+
+// APIKeyPrefix extracts the visible prefix of a key
+func APIKeyPrefix(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || parts[1] == "" || parts[2] == "" {
+		return "", false
+	}
+	return parts[0] + "_" + parts[1], true
+}
+
+// HashAPIKey returns the hex SHA-256 of the key, keys are random so no salt is needed
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyMatches compares a key against a stored hash in constant time
+func APIKeyMatches(hashed_key string, key string) bool {
+	return subtle.ConstantTimeCompare([]byte(hashed_key), []byte(HashAPIKey(key))) == 1
+}
@@ -0,0 +1,136 @@
+package utils
+
+import (
+	"sync"
+	"time"
+
+	"semay.com/configs"
+)
+
+// LockoutPolicy decides how long failed logins keep an account or address waiting
+type LockoutPolicy struct {
+	// failures after which the temporary lockout starts
+	MaxAttempts int
+	// failures tolerated before any delay is imposed
+	FreeAttempts int
+	// delay after the first delayed failure, doubled on every following one
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	Lockout   time.Duration
+}
+
+// LockoutPolicyFromEnv reads the LOGIN_* settings
+func LockoutPolicyFromEnv() LockoutPolicy {
+	return LockoutPolicy{
+		MaxAttempts: configs.AppConfig.GetIntOrDefault("LOGIN_MAX_ATTEMPTS", 5),
+		BaseDelay:   time.Duration(configs.AppConfig.GetIntOrDefault("LOGIN_BASE_DELAY", 1)) * time.Second,
+		MaxDelay:    time.Duration(configs.AppConfig.GetIntOrDefault("LOGIN_MAX_DELAY", 30)) * time.Second,
+		Lockout:     time.Duration(configs.AppConfig.GetIntOrDefault("LOGIN_LOCKOUT_DURATION", 15)) * time.Minute,
+	}
+}
+
+// Delay returns how long to wait before the next attempt after failures failed logins
+func (p LockoutPolicy) Delay(failures int) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	if p.MaxAttempts > 0 && failures >= p.MaxAttempts {
+		return p.Lockout
+	}
+
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+
+	delay := p.BaseDelay
+	for i := p.FreeAttempts + 1; i < failures && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	return delay
+}
+
+type throttleEntry struct {
+	failures    int
+	lockedUntil time.Time
+	lastFailure time.Time
+}
+
+// LoginThrottle tracks failed logins per key (e.g. the client address) in memory
+type LoginThrottle struct {
+	policy LockoutPolicy
+	// failures older than this are forgotten
+	window time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*throttleEntry
+}
+
+// NewLoginThrottle creates a throttle purging forgotten entries every purge_every
+func NewLoginThrottle(policy LockoutPolicy, window time.Duration, purge_every time.Duration) *LoginThrottle {
+	throttle := &LoginThrottle{
+		policy:  policy,
+		window:  window,
+		entries: make(map[string]*throttleEntry),
+	}
+	go func() {
+		for range time.Tick(purge_every) {
+			throttle.purge()
+		}
+	}()
+	return throttle
+}
+
+// Wait returns how long the key still has to wait before it may try again
+func (t *LoginThrottle) Wait(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	entry, ok := t.entries[key]
+	if !ok {
+		return 0
+	}
+	if wait := time.Until(entry.lockedUntil); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// Fail records a failed login and returns the delay now imposed on the key
+func (t *LoginThrottle) Fail(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := t.entries[key]
+	if !ok || now.Sub(entry.lastFailure) > t.window {
+		entry = &throttleEntry{}
+		t.entries[key] = entry
+	}
+	entry.failures++
+	entry.lastFailure = now
+	delay := t.policy.Delay(entry.failures)
+	entry.lockedUntil = now.Add(delay)
+	return delay
+}
+
+// Reset forgets the failures of a key, after a successful login or an unlock
+func (t *LoginThrottle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.entries, key)
+}
+
+func (t *LoginThrottle) purge() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, entry := range t.entries {
+		if now.Sub(entry.lastFailure) > t.window && now.After(entry.lockedUntil) {
+			delete(t.entries, key)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+
+	"semay.com/configs"
+)
+
+// PasswordPolicyError lists every rule a password broke
+type PasswordPolicyError struct {
+	Violations []string
+}
+
+func (e *PasswordPolicyError) Error() string {
+	return "password does not meet the policy: " + strings.Join(e.Violations, ", ")
+}
+
+// PasswordPolicy are the rules new passwords are checked against
+type PasswordPolicy struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// file with one known breached password per line
+	BreachedListFile string
+	// number of previous password hashes that can not be reused
+	History int
+}
+
+// PasswordPolicyFromEnv reads the PASSWORD_* settings
+func PasswordPolicyFromEnv() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:        configs.AppConfig.GetIntOrDefault("PASSWORD_MIN_LENGTH", 8),
+		RequireUpper:     configs.AppConfig.GetBoolOrDefault("PASSWORD_REQUIRE_UPPER", true),
+		RequireLower:     configs.AppConfig.GetBoolOrDefault("PASSWORD_REQUIRE_LOWER", true),
+		RequireDigit:     configs.AppConfig.GetBoolOrDefault("PASSWORD_REQUIRE_DIGIT", true),
+		RequireSymbol:    configs.AppConfig.GetBoolOrDefault("PASSWORD_REQUIRE_SYMBOL", false),
+		BreachedListFile: configs.AppConfig.Get("PASSWORD_BREACHED_LIST"),
+		History:          configs.AppConfig.GetIntOrDefault("PASSWORD_HISTORY", 5),
+	}
+}
+
+// Validate checks a plain password against the rules, previous_hashes are the hashes
+// of the passwords the user had before, the most recent first
+func (p PasswordPolicy) Validate(password string, previous_hashes []string) error {
+	violations := make([]string, 0)
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("at least %d characters", p.MinLength))
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, char := range password {
+		switch {
+		case unicode.IsUpper(char):
+			upper = true
+		case unicode.IsLower(char):
+			lower = true
+		case unicode.IsDigit(char):
+			digit = true
+		case unicode.IsPunct(char) || unicode.IsSymbol(char) || unicode.IsSpace(char):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "an upper case letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "a lower case letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "a symbol")
+	}
+
+	if p.BreachedListFile != "" {
+		breached, err := loadBreachedList(p.BreachedListFile)
+		if err != nil {
+			return err
+		}
+		if _, found := breached[strings.ToLower(password)]; found {
+			violations = append(violations, "not a known breached password")
+		}
+	}
+
+	if p.History > 0 {
+		if len(previous_hashes) > p.History {
+			previous_hashes = previous_hashes[:p.History]
+		}
+		for _, hash := range previous_hashes {
+			if PasswordsMatch(hash, password) {
+				violations = append(violations, fmt.Sprintf("not one of the last %d passwords", p.History))
+				break
+			}
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// breached lists are read once per file, they can be large
+var (
+	breachedMu    sync.Mutex
+	breachedLists = make(map[string]map[string]struct{})
+)
+
+func loadBreachedList(path string) (map[string]struct{}, error) {
+	breachedMu.Lock()
+	defer breachedMu.Unlock()
+
+	if list, ok := breachedLists[path]; ok {
+		return list, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening breached password list: %v", err)
+	}
+	defer file.Close()
+
+	list := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			list[strings.ToLower(line)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading breached password list: %v", err)
+	}
+
+	breachedLists[path] = list
+	return list, nil
+}
@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"semay.com/models"
+)
+
+// ErrTokenRevoked is returned by ParseJWTToken for logged out or invalidated tokens
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevocationStore keeps track of revoked access tokens.
+// Single tokens are revoked by jti until they expire, all tokens of a user are revoked
+// by bumping the user's token generation, tokens carrying an older generation are rejected.
+type RevocationStore interface {
+	Revoke(jti string, expires_at time.Time) error
+	IsRevoked(jti string) (bool, error)
+	Generation(uuid string) (uint, error)
+	RevokeAll(uuid string) (uint, error)
+	Purge() error
+}
+
+// TokenRevocations is the store consulted by CreateJWTToken and ParseJWTToken
+var TokenRevocations RevocationStore = NewMemoryRevocationStore(time.Minute)
+
+// startJanitor purges expired entries of the store every interval
+func startJanitor(store RevocationStore, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			store.Purge()
+		}
+	}()
+}
+
+// ##########################################################################
+// MemoryRevocationStore keeps revocations in process memory, they are lost on restart
+type MemoryRevocationStore struct {
+	mu          sync.RWMutex
+	revoked     map[string]time.Time
+	generations map[string]uint
+}
+
+func NewMemoryRevocationStore(purge_interval time.Duration) *MemoryRevocationStore {
+	store := &MemoryRevocationStore{
+		revoked:     make(map[string]time.Time),
+		generations: make(map[string]uint),
+	}
+	startJanitor(store, purge_interval)
+	return store
+}
+
+func (s *MemoryRevocationStore) Revoke(jti string, expires_at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.revoked[jti] = expires_at
+	return nil
+}
+
+func (s *MemoryRevocationStore) IsRevoked(jti string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, ok := s.revoked[jti]
+	return ok, nil
+}
+
+func (s *MemoryRevocationStore) Generation(uuid string) (uint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.generations[uuid], nil
+}
+
+func (s *MemoryRevocationStore) RevokeAll(uuid string) (uint, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.generations[uuid]++
+	return s.generations[uuid], nil
+}
+
+// Purge drops revoked jtis whose token has expired on its own
+func (s *MemoryRevocationStore) Purge() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	for jti, expires_at := range s.revoked {
+		if expires_at.Before(now) {
+			delete(s.revoked, jti)
+		}
+	}
+	return nil
+}
+
+// ##########################################################################
+// DBRevocationStore keeps revoked jtis in the revoked_tokens table and
+// the generation counter on the users table, so revocations survive restarts
+// and are shared between instances
+type DBRevocationStore struct {
+	db *gorm.DB
+}
+
+func NewDBRevocationStore(db *gorm.DB, purge_interval time.Duration) *DBRevocationStore {
+	store := &DBRevocationStore{db: db}
+	startJanitor(store, purge_interval)
+	return store
+}
+
+func (s *DBRevocationStore) Revoke(jti string, expires_at time.Time) error {
+	return s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.RevokedToken{
+		JTI:       jti,
+		ExpiresAt: expires_at.UTC(),
+	}).Error
+}
+
+func (s *DBRevocationStore) IsRevoked(jti string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
+
+// Generation reports ErrTokenRevoked for a user that no longer exists, so its tokens die with its row
+func (s *DBRevocationStore) Generation(uuid string) (uint, error) {
+	var generations []uint
+	err := s.db.Model(&models.User{}).Where("uuid = ?", uuid).Pluck("token_generation", &generations).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(generations) == 0 {
+		return 0, ErrTokenRevoked
+	}
+	return generations[0], nil
+}
+
+func (s *DBRevocationStore) RevokeAll(uuid string) (uint, error) {
+	err := s.db.Model(&models.User{}).Where("uuid = ?", uuid).
+		UpdateColumn("token_generation", gorm.Expr("token_generation + ?", 1)).Error
+	if err != nil {
+		return 0, err
+	}
+	return s.Generation(uuid)
+}
+
+// Purge drops revoked jtis whose token has expired on its own
+func (s *DBRevocationStore) Purge() error {
+	return s.db.Where("expires_at < ?", time.Now().UTC()).Delete(&models.RevokedToken{}).Error
+}
@@ -3,21 +3,32 @@ package utils
 import (
 	"crypto/sha512"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	guuid "github.com/google/uuid"
 
 	"semay.com/configs"
 )
 
 // var key = config.Config("TOKEN_SALT")
 
+// subjects telling full access tokens from tokens waiting for the MFA step
+const (
+	AccessTokenSubject = "UI Authentication Token"
+	MFAPendingSubject  = "MFA Pending Token"
+)
+
 type UserClaim struct {
 	jwt.RegisteredClaims
-	Email string   `json:"email"`
-	Roles []string `json:"roles"`
-	UUID  string   `json:"uuid"`
+	Email      string   `json:"email"`
+	Roles      []string `json:"roles"`
+	UUID       string   `json:"uuid"`
+	Generation uint     `json:"gen"`
+	// preferred language of the user's messages
+	Locale string `json:"locale,omitempty"`
 }
 
 // Combine password and salt then hash them using the SHA-512
@@ -53,19 +64,38 @@ func PasswordsMatch(hashedPassword, currPassword string) bool {
 
 // source of this token encode decode functions
 // https://github.com/gurleensethi/go-jwt-tutorial/blob/main/main.go
-func CreateJWTToken(email string, uuid string, roles []string, duration int) (string, error) {
+func CreateJWTToken(email string, uuid string, roles []string, duration int, locale string) (string, error) {
+	return signJWTToken(email, uuid, roles, duration, locale, AccessTokenSubject)
+}
+
+// CreateMFAPendingToken issues the short lived token proving the password step of a login,
+// it carries no roles and is only accepted by the MFA endpoints
+func CreateMFAPendingToken(email string, uuid string, duration int) (string, error) {
+	return signJWTToken(email, uuid, []string{}, duration, "", MFAPendingSubject)
+}
+
+func signJWTToken(email string, uuid string, roles []string, duration int, locale string, subject string) (string, error) {
+	// tokens carry the current generation of the user, bumping it revokes them all
+	generation, err := TokenRevocations.Generation(uuid)
+	if err != nil {
+		return "", fmt.Errorf("error reading token generation: %v", err)
+	}
+
 	my_claim := UserClaim{
 		RegisteredClaims: jwt.RegisteredClaims{},
 		Email:            email,
 		Roles:            roles,
 		UUID:             uuid,
+		Generation:       generation,
+		Locale:           locale,
 	}
 
 	salt_a := configs.AppConfig.Get("SECRETE_SALT")
 	exp := time.Now().UTC().Add(time.Duration(duration) * time.Minute)
 	my_claim.ExpiresAt = jwt.NewNumericDate(exp)
 	my_claim.Issuer = "Blue Admin"
-	my_claim.Subject = "UI Authentication Token"
+	my_claim.Subject = subject
+	my_claim.ID = guuid.New().String()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS512, my_claim)
 	signedString, err := token.SignedString([]byte(salt_a))
 	if err != nil {
@@ -75,7 +105,17 @@ func CreateJWTToken(email string, uuid string, roles []string, duration int) (st
 	return signedString, nil
 }
 
+// ParseJWTToken parses and checks an access token
 func ParseJWTToken(jwtToken string) (UserClaim, error) {
+	return parseJWTToken(jwtToken, AccessTokenSubject)
+}
+
+// ParseMFAPendingToken parses and checks a token issued by CreateMFAPendingToken
+func ParseMFAPendingToken(jwtToken string) (UserClaim, error) {
+	return parseJWTToken(jwtToken, MFAPendingSubject)
+}
+
+func parseJWTToken(jwtToken string, subject string) (UserClaim, error) {
 	salt_a := configs.AppConfig.Get("SECRETE_SALT")
 	salt_b := configs.AppConfig.Get("SECRETE_SALT")
 	response_a := UserClaim{}
@@ -93,14 +133,56 @@ func ParseJWTToken(jwtToken string) (UserClaim, error) {
 	}
 
 	// check token validity, for example token might have been expired
+	response := response_a
 	if !token_a.Valid {
 		if !token_b.Valid {
 			return UserClaim{}, fmt.Errorf("invalid token with second salt")
 		}
-		return response_b, nil
+		response = response_b
+	}
+
+	// pending and access tokens are not interchangeable
+	if response.Subject != subject {
+		return UserClaim{}, fmt.Errorf("unexpected token subject %v", response.Subject)
+	}
+
+	// finally checking the token was not logged out or invalidated for the user
+	if err := checkRevocation(response); err != nil {
+		return UserClaim{}, err
+	}
+	return response, nil
+
+}
+
+func checkRevocation(claim UserClaim) error {
+	revoked, err := TokenRevocations.IsRevoked(claim.ID)
+	if err != nil {
+		return fmt.Errorf("error checking token revocation: %v", err)
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+
+	generation, err := TokenRevocations.Generation(claim.UUID)
+	if errors.Is(err, ErrTokenRevoked) {
+		return ErrTokenRevoked
+	}
+	if err != nil {
+		return fmt.Errorf("error checking token generation: %v", err)
+	}
+	if claim.Generation < generation {
+		return ErrTokenRevoked
 	}
-	return response_a, nil
+	return nil
+}
 
+// RevokeJWTToken revokes a single token until it would have expired anyway
+func RevokeJWTToken(claim UserClaim) error {
+	expires_at := time.Now().UTC()
+	if claim.ExpiresAt != nil {
+		expires_at = claim.ExpiresAt.Time
+	}
+	return TokenRevocations.Revoke(claim.ID, expires_at)
 }
 
 // Return Unique values in list
@@ -116,10 +198,10 @@ func UniqueSlice(slice []string) []string {
 	return list
 }
 
-// Return Unique values in list
-func CheckValueExistsInSlice(slice []string, role_test string) bool {
-	for _, role := range slice {
-		if role == role_test || role == "superuser" {
+// Check value exists in list, exact match only
+func ValueInSlice(slice []string, value string) bool {
+	for _, entry := range slice {
+		if entry == value {
 			return true
 		}
 	}
@@ -0,0 +1,219 @@
+package validation
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/es"
+	"github.com/go-playground/locales/fr"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	es_translations "github.com/go-playground/validator/v10/translations/es"
+	fr_translations "github.com/go-playground/validator/v10/translations/fr"
+	"gorm.io/gorm"
+)
+
+// FieldError is one failed rule of a request field, named by its json name
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
+}
+
+// words of letters and digits with single separators between them
+var slugSafe = regexp.MustCompile(`^[\p{L}\p{N}]+(?:[ _.-][\p{L}\p{N}]+)*$`)
+
+// messages of the custom rules in every supported language, {0} is the field
+var customMessages = map[string]map[string]string{
+	"en": {
+		"slugsafe":           "{0} must be letters and digits with single spaces, '-', '_' or '.' between them",
+		"unique":             "{0} is already taken",
+		"bcp47_language_tag": "{0} must be a language tag such as en or pt-BR",
+	},
+	"fr": {
+		"slugsafe":           "{0} doit être composé de lettres et de chiffres séparés par un seul espace, '-', '_' ou '.'",
+		"unique":             "{0} est déjà utilisé",
+		"bcp47_language_tag": "{0} doit être une étiquette de langue comme en ou pt-BR",
+	},
+	"es": {
+		"slugsafe":           "{0} debe tener letras y dígitos separados por un solo espacio, '-', '_' o '.'",
+		"unique":             "{0} ya está en uso",
+		"bcp47_language_tag": "{0} debe ser una etiqueta de idioma como en o pt-BR",
+	},
+}
+
+var (
+	// engine is shared by every Validator, the database of the unique rule comes with each call
+	engine     = validator.New()
+	translator = ut.New(en.New(), en.New(), fr.New(), es.New())
+)
+
+func init() {
+	// fields are reported by the names clients send them with
+	engine.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return field.Name
+		}
+		return name
+	})
+	engine.RegisterValidation("slugsafe", func(field validator.FieldLevel) bool {
+		return slugSafe.MatchString(field.Field().String())
+	})
+	engine.RegisterValidationCtx("unique", unique)
+
+	defaults := map[string]func(*validator.Validate, ut.Translator) error{
+		"en": en_translations.RegisterDefaultTranslations,
+		"fr": fr_translations.RegisterDefaultTranslations,
+		"es": es_translations.RegisterDefaultTranslations,
+	}
+	for locale, register := range defaults {
+		trans, _ := translator.GetTranslator(locale)
+		if err := register(engine, trans); err != nil {
+			panic(err)
+		}
+		for rule, message := range customMessages[locale] {
+			rule, message := rule, message
+			err := engine.RegisterTranslation(rule, trans, func(trans ut.Translator) error {
+				return trans.Add(rule, message, true)
+			}, func(trans ut.Translator, field_error validator.FieldError) string {
+				translated, _ := trans.T(rule, field_error.Field())
+				return translated
+			})
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+type sessionKey struct{}
+
+// session opens the database of a validation only when a unique rule needs it
+type session struct {
+	open func() *gorm.DB
+	db   *gorm.DB
+}
+
+func (s *session) get() *gorm.DB {
+	if s.db == nil && s.open != nil {
+		s.db = s.open()
+	}
+	return s.db
+}
+
+// unique checks that no row of the table has the value, param is table.column.
+// The row of a sibling ID field is left out, so records keep their own values on updates.
+func unique(ctx context.Context, field validator.FieldLevel) bool {
+	database, _ := ctx.Value(sessionKey{}).(*session)
+	table, column, ok := strings.Cut(field.Param(), ".")
+	if database == nil || !ok || field.Field().IsZero() {
+		return true
+	}
+	db := database.get()
+	if db == nil {
+		return true
+	}
+
+	query := db.Table(table).Where(column+" = ?", field.Field().Interface())
+	if id := reflect.Indirect(field.Parent()).FieldByName("ID"); id.IsValid() && !id.IsZero() {
+		query = query.Where("id <> ?", id.Interface())
+	}
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		// the unique constraint still guards the write
+		return true
+	}
+	return count == 0
+}
+
+// Validator checks structs by their validate tags, it is the echo.Validator of the app
+type Validator struct {
+	db func() *gorm.DB
+}
+
+// New builds a Validator checking unique rules against the database db returns, nil skips them
+func New(db func() *gorm.DB) *Validator {
+	return &Validator{db: db}
+}
+
+// Validate returns validator.ValidationErrors when value breaks a rule
+func (v *Validator) Validate(value interface{}) error {
+	ctx := context.WithValue(context.Background(), sessionKey{}, &session{open: v.db})
+	return engine.StructCtx(ctx, value)
+}
+
+// Translator finds the translator of the first supported of the languages, English otherwise
+func Translator(languages ...string) ut.Translator {
+	trans, _ := translator.FindTranslator(languages...)
+	return trans
+}
+
+// Errors lists the failed rules of a validation error with messages in the language of trans,
+// nil when err is not a validation error
+func Errors(err error, trans ut.Translator) []FieldError {
+	var validation_errors validator.ValidationErrors
+	if !errors.As(err, &validation_errors) {
+		return nil
+	}
+	field_errors := make([]FieldError, 0, len(validation_errors))
+	for _, field_error := range validation_errors {
+		field_errors = append(field_errors, FieldError{
+			Field:   fieldPath(field_error),
+			Rule:    field_error.Tag(),
+			Param:   field_error.Param(),
+			Message: field_error.Translate(trans),
+		})
+	}
+	return field_errors
+}
+
+// fieldPath is the json path of a field below the validated struct, e.g. operations[0].op
+func fieldPath(field_error validator.FieldError) string {
+	_, path, found := strings.Cut(field_error.Namespace(), ".")
+	if !found {
+		return field_error.Field()
+	}
+	return path
+}
+
+// Messages lists the messages of the failed rules in the language of trans
+func Messages(err error, trans ut.Translator) []string {
+	field_errors := Errors(err, trans)
+	if field_errors == nil {
+		return []string{err.Error()}
+	}
+	messages := make([]string, 0, len(field_errors))
+	for _, field_error := range field_errors {
+		messages = append(messages, field_error.Message)
+	}
+	return messages
+}
+
+// Without drops the failures of the rules from a validation error, nil when none is left
+func Without(err error, rules ...string) error {
+	var validation_errors validator.ValidationErrors
+	if !errors.As(err, &validation_errors) {
+		return err
+	}
+	kept := make(validator.ValidationErrors, 0, len(validation_errors))
+	for _, field_error := range validation_errors {
+		if !slices.Contains(rules, field_error.Tag()) {
+			kept = append(kept, field_error)
+		}
+	}
+	if len(kept) == 0 {
+		return nil
+	}
+	return kept
+}